@@ -25,6 +25,7 @@ import (
 	"github.com/livepeer/go-livepeer/build"
 	"github.com/livepeer/go-livepeer/pm"
 	"github.com/livepeer/go-livepeer/server"
+	"github.com/livepeer/go-livepeer/verification"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -85,6 +86,8 @@ func main() {
 	rtmpAddr := flag.String("rtmpAddr", "127.0.0.1:"+RtmpPort, "Address to bind for RTMP commands")
 	cliAddr := flag.String("cliAddr", "127.0.0.1:"+CliPort, "Address to bind for  CLI commands")
 	httpAddr := flag.String("httpAddr", "", "Address to bind for HTTP commands")
+	srtAddr := flag.String("srtAddr", "", "Broadcaster only. Address to bind for SRT ingest; disabled if empty")
+	srtLatency := flag.Duration("srtLatency", server.SRTLatency, "How long SRT ingest waits for lost packets to be resent")
 	serviceAddr := flag.String("serviceAddr", "", "Orchestrator only. Overrides the on-chain serviceURI that broadcasters can use to contact this node; may be an IP or hostname.")
 	orchAddr := flag.String("orchAddr", "", "Orchestrator to connect to as a standalone transcoder")
 
@@ -92,11 +95,22 @@ func main() {
 	orchestrator := flag.Bool("orchestrator", false, "Set to true to be an orchestrator")
 	transcoder := flag.Bool("transcoder", false, "Set to true to be a transcoder")
 	broadcaster := flag.Bool("broadcaster", false, "Set to true to be a broadcaster")
-	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder")
-	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job")
+	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder, or a transcoder token issued by the orchestrator")
+	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job, or path to a JSON file of custom profiles")
 	maxSessions := flag.Int("maxSessions", 10, "Maximum number of concurrent transcoding sessions for Orchestrator, maximum number or RTMP streams for Broadcaster, or maximum capacity for transcoder")
+	streamConcurrency := flag.Int("streamConcurrency", core.MaxStreamConcurrency, "Maximum number of segments of a single stream an orchestrator transcodes at once")
+	transcoderTimeout := flag.Duration("transcoderTimeout", core.RemoteTranscoderTimeout, "Time an orchestrator waits for a standalone transcoder to return a segment")
+	transcoderRetries := flag.Int("transcoderRetries", core.RemoteTranscoderRetries, "Number of times an orchestrator reassigns a timed out segment to another standalone transcoder")
+	transcoderMaxTimeouts := flag.Int("transcoderMaxTimeouts", core.RemoteTranscoderMaxTimeouts, "Number of consecutive timeouts after which an orchestrator disconnects a standalone transcoder")
 	currentManifest := flag.Bool("currentManifest", false, "Expose the currently active ManifestID as \"/stream/current.m3u8\"")
 	nvidia := flag.String("nvidia", "", "Comma-separated list of Nvidia GPU device IDs to use for transcoding")
+	transcoderProfiles := flag.String("transcoderProfiles", "", "Comma-separated names of the profiles a standalone transcoder accepts. Any by default")
+	maxResolution := flag.String("maxResolution", "", "Largest output resolution a standalone transcoder accepts, eg 1920x1080. No limit by default")
+	segmentCache := flag.String("segmentCache", "", "Where a standalone transcoder keeps segments it fetches ahead of time: memory or disk. Off by default")
+	segmentAttempts := flag.Int("segmentAttempts", server.SegmentRetry.MaxAttempts, "Maximum number of attempts to transcode a segment before dropping it from the renditions. 0 for no limit")
+	segmentDeadline := flag.Float64("segmentDeadline", server.SegmentRetry.DeadlineFactor, "Stop retrying a segment after this multiple of its duration has elapsed. 0 for no limit")
+	verifySegments := flag.Float64("verifySegments", 0, "Fraction of transcoded segments to verify, between 0 and 1")
+	verifiers := flag.String("verifiers", strings.Join(verification.DefaultVerifiers, ","), "Checks to run on verified segments. Comma-separated list of resolution, frames, duration, codec, pixels and phash")
 
 	// Onchain:
 	ethAcctAddr := flag.String("ethAcctAddr", "", "Existing Eth account address")
@@ -131,10 +145,19 @@ func main() {
 	s3creds := flag.String("s3creds", "", "S3 credentials (in form ACCESSKEYID/ACCESSKEY)")
 	gsBucket := flag.String("gsbucket", "", "Google storage bucket")
 	gsKey := flag.String("gskey", "", "Google Storage private key file name (in json format)")
+	localStorage := flag.Bool("localStorage", false, "Store segments on disk under the data directory instead of in memory")
+	localStorageRetention := flag.Duration("localStorageRetention", 0, "How long to keep segments stored on disk (e.g. 24h). 0 keeps them indefinitely")
+	record := flag.Bool("record", false, "Keep all segments of a stream and write VOD playlists when it ends. Requires localStorage, s3bucket or gsbucket")
 
 	// API
 	authWebhookURL := flag.String("authWebhookUrl", "", "RTMP authentication webhook URL")
+	authWebhookTimeout := flag.Duration("authWebhookTimeout", 5*time.Second, "How long to wait for the auth webhook to respond")
+	authWebhookCacheTTL := flag.Duration("authWebhookCacheTTL", 0, "How long to reuse auth webhook responses for the same stream URL. 0 disables caching")
+	authWebhookFailOpen := flag.Bool("authWebhookFailOpen", false, "Accept streams when the auth webhook can't be reached, instead of denying them")
 	orchWebhookURL := flag.String("orchWebhookUrl", "", "Orchestrator discovery callback URL")
+	streamEventsURL := flag.String("streamEventsUrl", "", "URL to post stream lifecycle events to")
+	streamEventsSecret := flag.String("streamEventsSecret", "", "Secret used to sign stream lifecycle events")
+	streamEventsQueue := flag.Int("streamEventsQueue", 1000, "Maximum number of stream lifecycle events waiting to be sent")
 
 	flag.Parse()
 	vFlag.Value.Set(*verbosity)
@@ -153,6 +176,14 @@ func main() {
 		glog.Fatal("-maxSessions must be greater than zero")
 		return
 	}
+	if *streamConcurrency <= 0 {
+		glog.Fatal("-streamConcurrency must be greater than zero")
+		return
+	}
+	if *transcoderTimeout <= 0 || *transcoderRetries < 0 || *transcoderMaxTimeouts <= 0 {
+		glog.Fatal("-transcoderTimeout and -transcoderMaxTimeouts must be greater than zero, -transcoderRetries must not be negative")
+		return
+	}
 
 	type NetworkConfig struct {
 		ethUrl        string
@@ -278,8 +309,29 @@ func main() {
 		if n.OrchSecret == "" {
 			glog.Fatal("Missing -orchSecret")
 		}
+		var profileNames []string
+		if *transcoderProfiles != "" {
+			profileNames = strings.Split(*transcoderProfiles, ",")
+		}
+		caps, err := core.NewTranscoderCapabilities(*nvidia != "", *maxResolution, profileNames)
+		if err != nil {
+			glog.Fatalf("Invalid -maxResolution: %v", err)
+		}
+		var cache *server.SegmentCache
+		switch *segmentCache {
+		case "":
+		case "memory":
+			cache, err = server.NewSegmentCache("")
+		case "disk":
+			cache, err = server.NewSegmentCache(filepath.Join(*datadir, "segmentcache"))
+		default:
+			glog.Fatalf("Invalid -segmentCache %v; expected memory or disk", *segmentCache)
+		}
+		if err != nil {
+			glog.Fatalf("Error creating segment cache: %v", err)
+		}
 		if len(orchURLs) > 0 {
-			server.RunTranscoder(n, orchURLs[0].Host, *maxSessions)
+			server.RunTranscoder(n, orchURLs[0].Host, *maxSessions, caps, cache)
 		} else {
 			glog.Fatal("Missing -orchAddr")
 		}
@@ -606,6 +658,16 @@ func main() {
 		return
 	}
 
+	if *localStorage && (*s3bucket != "" || *gsBucket != "") {
+		glog.Error("Should specify only one of localStorage, s3bucket or gsbucket")
+		return
+	}
+
+	if *record && !*localStorage && *s3bucket == "" && *gsBucket == "" {
+		glog.Error("Recording requires one of localStorage, s3bucket or gsbucket")
+		return
+	}
+
 	// XXX get s3 credentials from local env vars?
 	if *s3bucket != "" && *s3creds != "" {
 		br := strings.Split(*s3bucket, "/")
@@ -623,6 +685,10 @@ func main() {
 	}
 
 	core.MaxSessions = *maxSessions
+	core.MaxStreamConcurrency = *streamConcurrency
+	core.RemoteTranscoderTimeout = *transcoderTimeout
+	core.RemoteTranscoderRetries = *transcoderRetries
+	core.RemoteTranscoderMaxTimeouts = *transcoderMaxTimeouts
 	if lpmon.Enabled {
 		lpmon.MaxSessions(core.MaxSessions)
 	}
@@ -663,6 +729,25 @@ func main() {
 		if server.AuthWebhookURL, err = getAuthWebhookURL(*authWebhookURL); err != nil {
 			glog.Fatal("Error setting auth webhook URL ", err)
 		}
+		server.AuthWebhook = server.AuthWebhookPolicy{
+			Timeout:  *authWebhookTimeout,
+			CacheTTL: *authWebhookCacheTTL,
+			FailOpen: *authWebhookFailOpen,
+		}
+		if u, err := getStreamEventsURL(*streamEventsURL); err != nil {
+			glog.Fatal("Error setting stream events URL ", err)
+		} else if u != "" {
+			server.StreamEvents = server.NewEventWebhook(u, *streamEventsSecret, *streamEventsQueue)
+		}
+		server.RecordStreams = *record
+		server.SRTLatency = *srtLatency
+		server.SegmentRetry.MaxAttempts = *segmentAttempts
+		server.SegmentRetry.DeadlineFactor = *segmentDeadline
+		if *verifySegments > 0 {
+			if server.SegmentVerifier, err = verification.NewPolicy(*verifySegments, strings.Split(*verifiers, ",")); err != nil {
+				glog.Fatal("Error setting up segment verification: ", err)
+			}
+		}
 	} else if n.NodeType == core.OrchestratorNode {
 		suri, err := getServiceURI(n, *serviceAddr)
 		if err != nil {
@@ -674,11 +759,24 @@ func main() {
 		*httpAddr = defaultAddr(*httpAddr, "", n.GetServiceURI().Port())
 
 		if !*transcoder && n.OrchSecret == "" {
-			glog.Fatal("Running an orchestrator requires an -orchSecret for standalone mode or -transcoder for orchestrator+transcoder mode")
+			glog.Info("No -orchSecret set; standalone transcoders need a token from the /issueTranscoderToken CLI endpoint")
 		}
 	}
 	*cliAddr = defaultAddr(*cliAddr, "127.0.0.1", CliPort)
 
+	if *localStorage {
+		storageDir := filepath.Join(*datadir, "segments")
+		fsos, err := drivers.NewFSDriver(n.GetServiceURI(), storageDir, *localStorageRetention)
+		if err != nil {
+			glog.Error("Error creating local storage driver:", err)
+			return
+		}
+		glog.Infof("Storing segments in %v", storageDir)
+		go fsos.StartCleanup()
+		defer fsos.StopCleanup()
+		drivers.NodeStorage = fsos
+	}
+
 	if drivers.NodeStorage == nil {
 		// base URI will be empty for broadcasters; that's OK
 		drivers.NodeStorage = drivers.NewMemoryDriver(n.GetServiceURI())
@@ -688,6 +786,7 @@ func main() {
 
 	//Set up the media server
 	s := server.NewLivepeerServer(*rtmpAddr, n)
+	s.SRTAddr = *srtAddr
 	ec := make(chan error)
 	tc := make(chan struct{})
 	wc := make(chan struct{})
@@ -741,6 +840,9 @@ func main() {
 	case core.BroadcasterNode:
 		glog.Infof("***Livepeer Running in Broadcaster Mode***")
 		glog.Infof("Video Ingest Endpoint - rtmp://%v", *rtmpAddr)
+		if *srtAddr != "" {
+			glog.Infof("Video Ingest Endpoint - srt://%v", *srtAddr)
+		}
 	case core.TranscoderNode:
 		glog.Infof("**Liveepeer Running in Transcoder Mode***")
 	}
@@ -759,6 +861,9 @@ func main() {
 		return
 	case <-tc:
 		glog.Infof("Orchestrator server shut down")
+	case <-n.Drained():
+		glog.Infof("Orchestrator drained; exiting")
+		return
 	case <-wc:
 		glog.Infof("CLI webserver shut down")
 		return
@@ -799,6 +904,21 @@ func getAuthWebhookURL(u string) (string, error) {
 	return u, nil
 }
 
+func getStreamEventsURL(u string) (string, error) {
+	if u == "" {
+		return "", nil
+	}
+	p, err := url.ParseRequestURI(u)
+	if err != nil {
+		return "", err
+	}
+	if p.Scheme != "http" && p.Scheme != "https" {
+		return "", errors.New("Stream events URL should be HTTP or HTTPS")
+	}
+	glog.Infof("Sending stream events to %s", u)
+	return u, nil
+}
+
 // ServiceURI checking steps:
 // If passed in via -serviceAddr: return that
 // Else: get inferred address.
@@ -37,6 +37,9 @@ type DB struct {
 	findLatestMiniHeader             *sql.Stmt
 	findAllMiniHeadersSortedByNumber *sql.Stmt
 	deleteMiniHeader                 *sql.Stmt
+	insertTranscoderToken            *sql.Stmt
+	deleteTranscoderToken            *sql.Stmt
+	selectTranscoderToken            *sql.Stmt
 }
 
 // DBOrch is the type binding for a row result from the orchestrators table
@@ -121,6 +124,12 @@ var schema = `
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_blockheaders_number ON blockheaders(number);
+
+	CREATE TABLE IF NOT EXISTS transcoderTokens (
+		name STRING PRIMARY KEY,
+		tokenHash STRING UNIQUE NOT NULL,
+		createdAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
 `
 
 func NewDBOrch(ethereumAddr string, serviceURI string, pricePerPixel int64, activationRound int64, deactivationRound int64, stake string) *DBOrch {
@@ -312,6 +321,29 @@ func InitDB(dbPath string) (*DB, error) {
 	}
 	d.deleteMiniHeader = stmt
 
+	// Transcoder token prepared statements
+	stmt, err = db.Prepare("INSERT INTO transcoderTokens(name, tokenHash) VALUES(?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertTranscoderToken ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertTranscoderToken = stmt
+	stmt, err = db.Prepare("DELETE FROM transcoderTokens WHERE name=?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteTranscoderToken ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteTranscoderToken = stmt
+	stmt, err = db.Prepare("SELECT name FROM transcoderTokens WHERE tokenHash=?")
+	if err != nil {
+		glog.Error("Unable to prepare selectTranscoderToken ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectTranscoderToken = stmt
+
 	glog.V(DEBUG).Info("Initialized DB node")
 	return &d, nil
 }
@@ -357,6 +389,15 @@ func (db *DB) Close() {
 	if db.deleteMiniHeader != nil {
 		db.deleteMiniHeader.Close()
 	}
+	if db.insertTranscoderToken != nil {
+		db.insertTranscoderToken.Close()
+	}
+	if db.deleteTranscoderToken != nil {
+		db.deleteTranscoderToken.Close()
+	}
+	if db.selectTranscoderToken != nil {
+		db.selectTranscoderToken.Close()
+	}
 	if db.dbh != nil {
 		db.dbh.Close()
 	}
@@ -799,6 +840,64 @@ func (db *DB) DeleteMiniHeader(hash ethcommon.Hash) error {
 	return nil
 }
 
+// InsertTranscoderToken stores the hash of a token issued to a named transcoder
+func (db *DB) InsertTranscoderToken(name string, tokenHash string) error {
+	_, err := db.insertTranscoderToken.Exec(name, tokenHash)
+	if err != nil {
+		glog.Errorf("db: Unable to insert transcoder token name=%s err=%v", name, err)
+	}
+	return err
+}
+
+// DeleteTranscoderToken removes the token of a named transcoder. Returns
+// whether there was a token to remove.
+func (db *DB) DeleteTranscoderToken(name string) (bool, error) {
+	res, err := db.deleteTranscoderToken.Exec(name)
+	if err != nil {
+		glog.Errorf("db: Unable to delete transcoder token name=%s err=%v", name, err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// TranscoderTokenName returns the name of the transcoder a token hash was
+// issued to, or an empty string if there is none
+func (db *DB) TranscoderTokenName(tokenHash string) (string, error) {
+	var name string
+	err := db.selectTranscoderToken.QueryRow(tokenHash).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve transcoder token from database: %v", err)
+	}
+	return name, nil
+}
+
+// TranscoderTokenNames returns the names of the transcoders holding a token
+func (db *DB) TranscoderTokenNames() ([]string, error) {
+	rows, err := db.dbh.Query("SELECT name FROM transcoderTokens ORDER BY name")
+	if err != nil {
+		glog.Error("db: Unable to select transcoder tokens ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			glog.Error("db: Unable to fetch transcoder token ", err)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 func encodeLogsJSON(logs []types.Log) ([]byte, error) {
 	logsEnc, err := json.Marshal(logs)
 	if err != nil {
@@ -1101,3 +1101,44 @@ func defaultMiniHeader() *blockwatch.MiniHeader {
 	block.Logs = []types.Log{log}
 	return block
 }
+
+func TestDBTranscoderTokens(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	assert := assert.New(t)
+	require := require.New(t)
+	require.Nil(err)
+
+	names, err := dbh.TranscoderTokenNames()
+	require.Nil(err)
+	assert.Empty(names)
+
+	require.Nil(dbh.InsertTranscoderToken("gpu1", "hash1"))
+	require.Nil(dbh.InsertTranscoderToken("cpu1", "hash2"))
+
+	// names and hashes are unique
+	assert.NotNil(dbh.InsertTranscoderToken("gpu1", "hash3"))
+	assert.NotNil(dbh.InsertTranscoderToken("gpu2", "hash1"))
+
+	names, err = dbh.TranscoderTokenNames()
+	require.Nil(err)
+	assert.Equal([]string{"cpu1", "gpu1"}, names)
+
+	name, err := dbh.TranscoderTokenName("hash1")
+	require.Nil(err)
+	assert.Equal("gpu1", name)
+	name, err = dbh.TranscoderTokenName("nope")
+	require.Nil(err)
+	assert.Empty(name)
+
+	deleted, err := dbh.DeleteTranscoderToken("gpu1")
+	require.Nil(err)
+	assert.True(deleted)
+	deleted, err = dbh.DeleteTranscoderToken("gpu1")
+	require.Nil(err)
+	assert.False(deleted)
+	name, err = dbh.TranscoderTokenName("hash1")
+	require.Nil(err)
+	assert.Empty(name)
+}
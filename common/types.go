@@ -1,6 +1,7 @@
 package common
 
 import (
+	"math/big"
 	"net/url"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
@@ -14,7 +15,9 @@ type Broadcaster interface {
 
 type OrchestratorPool interface {
 	GetURLs() []*url.URL
-	GetOrchestrators(int) ([]*net.OrchestratorInfo, error)
+	// GetOrchestrators leaves out orchestrators charging more than maxPrice,
+	// which takes the place of the broadcaster's max price when set
+	GetOrchestrators(numOrchestrators int, maxPrice *big.Rat) ([]*net.OrchestratorInfo, error)
 	Size() int
 }
 
@@ -3,17 +3,20 @@ package common
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"math/rand"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/net"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 	"google.golang.org/grpc/peer"
 )
@@ -128,16 +131,163 @@ func BytesToVideoProfile(txData []byte) ([]ffmpeg.VideoProfile, error) {
 	return profiles, nil
 }
 
+// ProfilesToTranscodeOpts concatenates the IDs of the profiles, sorted by ffmpeg.ByName.
+// Presets are identified by their name. Custom profiles are identified by all
+// their parameters, so a signature over the IDs also covers the parameters.
 func ProfilesToTranscodeOpts(profiles []ffmpeg.VideoProfile) []byte {
 	//Sort profiles first
 	sort.Sort(ffmpeg.ByName(profiles))
 	transOpts := []byte{}
 	for _, prof := range profiles {
-		transOpts = append(transOpts, crypto.Keccak256([]byte(prof.Name))[0:4]...)
+		transOpts = append(transOpts, profileID(prof)...)
 	}
 	return transOpts
 }
 
+func profileID(p ffmpeg.VideoProfile) []byte {
+	if isPresetProfile(p) {
+		return crypto.Keccak256([]byte(p.Name))[0:VideoProfileIDBytes]
+	}
+	params := fmt.Sprintf("%s|%s|%s|%d|%s", p.Name, p.Resolution, p.Bitrate, p.Framerate, p.AspectRatio)
+	return crypto.Keccak256([]byte(params))[0:VideoProfileIDBytes]
+}
+
+func isPresetProfile(p ffmpeg.VideoProfile) bool {
+	preset, ok := ffmpeg.VideoProfileLookup[p.Name]
+	return ok && preset == p
+}
+
+// HasCustomProfiles returns true if any of the profiles is not a preset.
+// Custom profiles can't be looked up by ID and have to be sent in full.
+func HasCustomProfiles(profiles []ffmpeg.VideoProfile) bool {
+	for _, p := range profiles {
+		if !isPresetProfile(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func ProfilesToNetProfiles(profiles []ffmpeg.VideoProfile) []*net.VideoProfile {
+	netProfiles := make([]*net.VideoProfile, 0, len(profiles))
+	for _, p := range profiles {
+		netProfiles = append(netProfiles, &net.VideoProfile{
+			Name:        p.Name,
+			Resolution:  p.Resolution,
+			Bitrate:     p.Bitrate,
+			Fps:         uint32(p.Framerate),
+			AspectRatio: p.AspectRatio,
+		})
+	}
+	return netProfiles
+}
+
+func NetProfilesToProfiles(netProfiles []*net.VideoProfile) ([]ffmpeg.VideoProfile, error) {
+	profiles := make([]ffmpeg.VideoProfile, 0, len(netProfiles))
+	for _, np := range netProfiles {
+		p := ffmpeg.VideoProfile{
+			Name:        np.Name,
+			Resolution:  np.Resolution,
+			Bitrate:     np.Bitrate,
+			Framerate:   uint(np.Fps),
+			AspectRatio: np.AspectRatio,
+		}
+		if err := validateProfile(p); err != nil {
+			glog.Errorf("Invalid video profile %+v: %v", p, err)
+			return nil, ErrProfile
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// DecodeProfiles returns the profiles a segment should be transcoded into.
+// Full profiles take precedence; otherwise the profiles are looked up by ID.
+func DecodeProfiles(ids []byte, fullProfiles []*net.VideoProfile) ([]ffmpeg.VideoProfile, error) {
+	if len(fullProfiles) > 0 {
+		return NetProfilesToProfiles(fullProfiles)
+	}
+	return BytesToVideoProfile(ids)
+}
+
+// Profile names end up in storage paths, so keep them to a safe set of
+// characters
+var profileNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func validateProfile(p ffmpeg.VideoProfile) error {
+	if p.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if !profileNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("invalid name %q", p.Name)
+	}
+	if w, h, err := ffmpeg.VideoProfileResolution(p); err != nil || w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid resolution %q", p.Resolution)
+	}
+	if p.Bitrate == "" {
+		return fmt.Errorf("missing bitrate")
+	}
+	if p.Framerate == 0 {
+		return fmt.Errorf("missing framerate")
+	}
+	return nil
+}
+
+// JSONProfile is the JSON representation of a custom transcoding profile.
+// Bitrate is in bits per second.
+type JSONProfile struct {
+	Name        string `json:"name"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Bitrate     int    `json:"bitrate"`
+	FPS         uint   `json:"fps"`
+	AspectRatio string `json:"aspectRatio,omitempty"`
+}
+
+// JSONProfilesToProfiles converts JSON profiles into video profiles.
+// Names have to be unique since they identify the renditions.
+func JSONProfilesToProfiles(jsonProfiles []JSONProfile) ([]ffmpeg.VideoProfile, error) {
+	profiles := make([]ffmpeg.VideoProfile, 0, len(jsonProfiles))
+	names := make(map[string]bool)
+	for _, jp := range jsonProfiles {
+		if jp.Width <= 0 || jp.Height <= 0 {
+			return nil, fmt.Errorf("invalid resolution for profile %q", jp.Name)
+		}
+		if jp.Bitrate <= 0 {
+			return nil, fmt.Errorf("invalid bitrate for profile %q", jp.Name)
+		}
+		p := ffmpeg.VideoProfile{
+			Name:        jp.Name,
+			Resolution:  fmt.Sprintf("%dx%d", jp.Width, jp.Height),
+			Bitrate:     strconv.Itoa(jp.Bitrate),
+			Framerate:   jp.FPS,
+			AspectRatio: jp.AspectRatio,
+		}
+		if err := validateProfile(p); err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %v", jp.Name, err)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate profile name %q", p.Name)
+		}
+		names[p.Name] = true
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// ParseProfilesJSON parses a JSON array of profiles, eg
+// [{"name":"720p","width":1280,"height":720,"bitrate":3000000,"fps":30}]
+func ParseProfilesJSON(data []byte) ([]ffmpeg.VideoProfile, error) {
+	var jsonProfiles []JSONProfile
+	if err := json.Unmarshal(data, &jsonProfiles); err != nil {
+		return nil, err
+	}
+	if len(jsonProfiles) == 0 {
+		return nil, fmt.Errorf("no profiles")
+	}
+	return JSONProfilesToProfiles(jsonProfiles)
+}
+
 func ProfilesToHex(profiles []ffmpeg.VideoProfile) string {
 	return hex.EncodeToString(ProfilesToTranscodeOpts(profiles))
 }
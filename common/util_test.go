@@ -65,6 +65,100 @@ func TestProfilesToHex(t *testing.T) {
 	compare([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9})
 }
 
+func TestCustomProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	custom := ffmpeg.VideoProfile{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}
+	assert.False(HasCustomProfiles([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P720p30fps16x9}))
+	assert.True(HasCustomProfiles([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, custom}))
+
+	// Presets are still identified by name
+	assert.Equal("c0a6517a", ProfilesToHex([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}))
+
+	// A preset with modified parameters is a custom profile
+	modified := ffmpeg.P240p30fps16x9
+	modified.Bitrate = "100k"
+	assert.True(HasCustomProfiles([]ffmpeg.VideoProfile{modified}))
+	assert.NotEqual(ProfilesToHex([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}), ProfilesToHex([]ffmpeg.VideoProfile{modified}))
+
+	// Custom profile IDs cover every parameter
+	id := ProfilesToHex([]ffmpeg.VideoProfile{custom})
+	for _, change := range []func(p *ffmpeg.VideoProfile){
+		func(p *ffmpeg.VideoProfile) { p.Name = "other" },
+		func(p *ffmpeg.VideoProfile) { p.Resolution = "1280x719" },
+		func(p *ffmpeg.VideoProfile) { p.Bitrate = "3000001" },
+		func(p *ffmpeg.VideoProfile) { p.Framerate = 60 },
+		func(p *ffmpeg.VideoProfile) { p.AspectRatio = "16:9" },
+	} {
+		p := custom
+		change(&p)
+		assert.NotEqual(id, ProfilesToHex([]ffmpeg.VideoProfile{p}))
+	}
+
+	// Custom profile IDs can't be looked up
+	_, err := BytesToVideoProfile(ProfilesToTranscodeOpts([]ffmpeg.VideoProfile{custom}))
+	assert.Equal(ErrProfile, err)
+
+	// Full profiles round trip
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, custom}
+	decoded, err := DecodeProfiles(nil, ProfilesToNetProfiles(profiles))
+	assert.Nil(err)
+	assert.Equal(profiles, decoded)
+	assert.Equal(ProfilesToTranscodeOpts(profiles), ProfilesToTranscodeOpts(decoded))
+
+	// Preset IDs are used without full profiles
+	decoded, err = DecodeProfiles(ProfilesToTranscodeOpts([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}), nil)
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}, decoded)
+
+	// Invalid full profiles
+	invalid := ProfilesToNetProfiles([]ffmpeg.VideoProfile{custom})
+	invalid[0].Resolution = "foo"
+	_, err = DecodeProfiles(nil, invalid)
+	assert.Equal(ErrProfile, err)
+	invalid = ProfilesToNetProfiles([]ffmpeg.VideoProfile{custom})
+	invalid[0].Fps = 0
+	_, err = DecodeProfiles(nil, invalid)
+	assert.Equal(ErrProfile, err)
+
+	// Names that could escape the storage path
+	for _, name := range []string{"../foo", "foo/bar", "..", "foo bar", "foo\\bar"} {
+		invalid = ProfilesToNetProfiles([]ffmpeg.VideoProfile{custom})
+		invalid[0].Name = name
+		_, err = DecodeProfiles(nil, invalid)
+		assert.Equal(ErrProfile, err, name)
+	}
+}
+
+func TestParseProfilesJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles, err := ParseProfilesJSON([]byte(`[
+		{"name":"720p","width":1280,"height":720,"bitrate":3000000,"fps":30},
+		{"name":"sq","width":480,"height":480,"bitrate":500000,"fps":15,"aspectRatio":"1:1"}
+	]`))
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{
+		{Name: "720p", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30},
+		{Name: "sq", Resolution: "480x480", Bitrate: "500000", Framerate: 15, AspectRatio: "1:1"},
+	}, profiles)
+
+	for _, data := range []string{
+		``,
+		`{}`,
+		`[]`,
+		`[{"width":1280,"height":720,"bitrate":3000000,"fps":30}]`,
+		`[{"name":"a","height":720,"bitrate":3000000,"fps":30}]`,
+		`[{"name":"a","width":1280,"height":720,"fps":30}]`,
+		`[{"name":"a","width":1280,"height":720,"bitrate":3000000}]`,
+		`[{"name":"a","width":1280,"height":720,"bitrate":3000000,"fps":30},{"name":"a","width":640,"height":360,"bitrate":1000000,"fps":30}]`,
+		`[{"name":"../a","width":1280,"height":720,"bitrate":3000000,"fps":30}]`,
+	} {
+		_, err := ParseProfilesJSON([]byte(data))
+		assert.Error(err, data)
+	}
+}
+
 func TestPriceToFixed(t *testing.T) {
 	assert := assert.New(t)
 
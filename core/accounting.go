@@ -178,7 +178,8 @@ func (b *Balances) Balance(id ManifestID) *big.Rat {
 	if b.balances[id] == nil {
 		return nil
 	}
-	return b.balances[id].amount
+	// Copy, as the amount is updated in place
+	return new(big.Rat).Set(b.balances[id].amount)
 }
 
 func (b *Balances) cleanup() {
@@ -71,6 +71,9 @@ type LivepeerNode struct {
 	priceInfo    *big.Rat
 	serviceURI   url.URL
 	segmentMutex *sync.RWMutex
+	// Drain mode; guarded by segmentMutex
+	draining bool
+	drained  chan struct{}
 }
 
 //NewLivepeerNode creates a new Livepeer Node. Eth can be nil.
@@ -82,6 +85,7 @@ func NewLivepeerNode(e eth.LivepeerEthClient, wd string, dbh *common.DB) (*Livep
 		Database:     dbh,
 		SegmentChans: make(map[ManifestID]SegmentChan),
 		segmentMutex: &sync.RWMutex{},
+		drained:      make(chan struct{}),
 	}, nil
 }
 
@@ -19,6 +19,8 @@ type StubTranscoder struct {
 	Profiles      []ffmpeg.VideoProfile
 	SegCount      int
 	FailTranscode bool
+	// Returns no data for this profile
+	FailProfile string
 }
 
 func (t *StubTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
@@ -30,6 +32,10 @@ func (t *StubTranscoder) Transcode(job string, fname string, profiles []ffmpeg.V
 
 	segments := make([]*TranscodedSegmentData, 0)
 	for _, p := range t.Profiles {
+		if p.Name == t.FailProfile {
+			segments = append(segments, &TranscodedSegmentData{})
+			continue
+		}
 		segments = append(segments, &TranscodedSegmentData{Data: []byte(fmt.Sprintf("Transcoded_%v", p.Name))})
 	}
 
@@ -98,6 +104,41 @@ func TestTranscodeAndBroadcast(t *testing.T) {
 	tr.Profiles = p
 }
 
+func TestTranscodeSeg_PartialResults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	p := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}
+	tr := &StubTranscoder{Profiles: p, FailProfile: p[0].Name}
+	storage := drivers.NewMemoryDriver(nil).NewSession("")
+	config := transcodeConfig{LocalOS: storage, OS: storage}
+	tmpdir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpdir)
+	n, err := NewLivepeerNode(nil, tmpdir, nil)
+	require.Nil(err)
+	n.Transcoder = tr
+
+	// Fails as a whole unless the broadcaster accepts partial results
+	md := &SegTranscodingMetadata{Profiles: p}
+	res := n.transcodeSeg(config, StubSegment(), md)
+	assert.EqualError(res.Err, "ZeroSegments")
+
+	md.PartialResults = true
+	res = n.transcodeSeg(config, StubSegment(), md)
+	require.Nil(res.Err)
+	segs := res.TranscodeData.Segments
+	require.Len(segs, 2)
+	assert.EqualError(segs[0].Err, "ZeroSegments")
+	assert.Nil(segs[0].Data)
+	assert.Nil(segs[1].Err)
+	assert.Equal([]byte("Transcoded_P144p30fps16x9"), segs[1].Data)
+
+	// Nothing to return if every profile failed
+	tr.Profiles = p[:1]
+	md.Profiles = p[:1]
+	res = n.transcodeSeg(config, StubSegment(), md)
+	assert.EqualError(res.Err, "ZeroSegments")
+}
+
 func TestServiceURIChange(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
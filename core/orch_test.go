@@ -7,13 +7,18 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"path"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/livepeer/go-livepeer/pm"
 
@@ -21,6 +26,7 @@ import (
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
 
 	"github.com/livepeer/go-livepeer/net"
 )
@@ -71,7 +77,7 @@ func TestServeTranscoder(t *testing.T) {
 	strm := &StubTranscoderServer{}
 
 	// test that a transcoder was created
-	go n.serveTranscoder(strm, 5)
+	go n.serveTranscoder(strm, 5, nil, "", false)
 	time.Sleep(1 * time.Second)
 
 	tc, ok := n.TranscoderManager.liveTranscoders[strm]
@@ -94,7 +100,8 @@ func TestRemoteTranscoder(t *testing.T) {
 	m := NewRemoteTranscoderManager()
 	initTranscoder := func() (*RemoteTranscoder, *StubTranscoderServer) {
 		strm := &StubTranscoderServer{manager: m}
-		tc := NewRemoteTranscoder(m, strm, 5)
+		tc := NewRemoteTranscoder(m, strm, 5, nil, "", false)
+		strm.ID = tc.id
 		return tc, strm
 	}
 
@@ -105,6 +112,21 @@ func TestRemoteTranscoder(t *testing.T) {
 		t.Error("Error transcoding ", err)
 	}
 
+	if strm.LastNotify.FullProfiles != nil {
+		t.Error("Unexpected full profiles ", strm.LastNotify.FullProfiles)
+	}
+
+	// custom profiles are sent in full, in ffmpeg.ByName order
+	tc, strm = initTranscoder()
+	custom := ffmpeg.VideoProfile{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}
+	if _, err := tc.Transcode("", "", []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, custom}); err != nil {
+		t.Error("Error transcoding ", err)
+	}
+	profiles, err := common.DecodeProfiles(strm.LastNotify.Profiles, strm.LastNotify.FullProfiles)
+	if err != nil || len(profiles) != 2 || profiles[0] != custom || profiles[1] != ffmpeg.P144p30fps16x9 {
+		t.Error("Unexpected profiles ", profiles, err)
+	}
+
 	// error on remote while transcoding
 	tc, strm = initTranscoder()
 	strm.TranscodeError = fmt.Errorf("TranscodeError")
@@ -166,7 +188,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that transcoder is added to liveTranscoders and remoteTranscoders
 	wg1 := newWg(1)
-	go func() { m.Manage(strm, 5); wg1.Done() }()
+	go func() { m.Manage(strm, 5, nil, "", false); wg1.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -180,7 +202,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that additional transcoder is added to liveTranscoders and remoteTranscoders
 	wg2 := newWg(1)
-	go func() { m.Manage(strm2, 4); wg2.Done() }()
+	go func() { m.Manage(strm2, 4, nil, "", false); wg2.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -219,9 +241,9 @@ func TestSelectTranscoder(t *testing.T) {
 
 	// register transcoders, which adds transcoder to liveTranscoders and remoteTranscoders
 	wg := newWg(1)
-	go func() { m.Manage(strm, 2) }()
+	go func() { m.Manage(strm, 2, nil, "", false) }()
 	time.Sleep(1 * time.Millisecond) // allow time for first stream to register
-	go func() { m.Manage(strm2, 1); wg.Done() }()
+	go func() { m.Manage(strm2, 1, nil, "", false); wg.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow time for second stream to register
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -231,23 +253,23 @@ func TestSelectTranscoder(t *testing.T) {
 	// assert transcoder is returned from selectTranscoder
 	t1 := m.liveTranscoders[strm]
 	t2 := m.liveTranscoders[strm2]
-	currentTranscoder := m.selectTranscoder()
+	currentTranscoder := m.selectTranscoder(nil, nil)
 	assert.Equal(t2, currentTranscoder)
 	assert.Equal(1, t2.load)
 	assert.NotNil(m.liveTranscoders[strm])
 	assert.Len(m.remoteTranscoders, 2)
 
 	// assert transcoder with less load selected
-	currentTranscoder2 := m.selectTranscoder()
+	currentTranscoder2 := m.selectTranscoder(nil, nil)
 	assert.Equal(t1, currentTranscoder2)
 	assert.Equal(1, t1.load)
 
-	currentTranscoder3 := m.selectTranscoder()
+	currentTranscoder3 := m.selectTranscoder(nil, nil)
 	assert.Equal(t1, currentTranscoder3)
 	assert.Equal(2, t1.load)
 
 	// assert no transcoder returned if all at they capacity
-	noTrans := m.selectTranscoder()
+	noTrans := m.selectTranscoder(nil, nil)
 	assert.Nil(noTrans)
 
 	m.completeTranscoders(t1)
@@ -261,7 +283,7 @@ func TestSelectTranscoder(t *testing.T) {
 	assert.NotNil(m.liveTranscoders[strm])
 
 	// assert t1 is selected and t2 drained
-	currentTranscoder = m.selectTranscoder()
+	currentTranscoder = m.selectTranscoder(nil, nil)
 	assert.Equal(t1, currentTranscoder)
 	assert.Equal(1, t1.load)
 	assert.NotNil(m.liveTranscoders[strm])
@@ -291,7 +313,7 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.Equal(err.Error(), "No transcoders available")
 
 	wg := newWg(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, 5, nil, "", false); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity
@@ -327,23 +349,392 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.Len(m.remoteTranscoders, 0) // retries drain the list
 	s.SendError = nil
 
-	// fatal error should not retry
+	// timeout should not retry by default, nor remove from list
 	wg.Add(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, 5, nil, "", false); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity check
 	assert.Len(m.liveTranscoders, 1)
 	s.WithholdResults = true
 	RemoteTranscoderTimeout = 1 * time.Millisecond
+	defer func() { RemoteTranscoderTimeout = 8 * time.Second }()
 	_, err = m.Transcode("", "", nil)
-	_, fatal := err.(RemoteTranscoderFatalError)
-	wg.Wait()
-	assert.True(fatal)
+	assert.Equal(ErrRemoteTranscoderTimeout, err)
+	assert.Len(m.liveTranscoders, 1)
+	assert.Equal(0, m.remoteTranscoders[0].load)
+	assert.Equal(1, m.remoteTranscoders[0].timeouts)
+
+	// a result resets the timeout count
+	s.WithholdResults = false
+	_, err = m.Transcode("", "", nil)
+	assert.Nil(err)
+	assert.Equal(0, m.remoteTranscoders[0].timeouts)
+
+	// repeated timeouts should remove from list
+	s.WithholdResults = true
+	for i := 0; i < RemoteTranscoderMaxTimeouts; i++ {
+		_, err = m.Transcode("", "", nil)
+		assert.Equal(ErrRemoteTranscoderTimeout, err)
+	}
+	assert.True(wgWait(wg))
 	assert.Len(m.liveTranscoders, 0)
 	assert.Len(m.remoteTranscoders, 1) // no retries, so don't drain
 	s.WithholdResults = false
-	RemoteTranscoderTimeout = 8 * time.Second
+}
+
+func TestTranscoderManagerReassign(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	s1 := &StubTranscoderServer{manager: m, WithholdResults: true}
+	s2 := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	go m.Manage(s1, 5, nil, "", false)
+	go m.Manage(s2, 10, nil, "", false)
+	time.Sleep(1 * time.Millisecond)
+	require.Len(t, m.liveTranscoders, 2)
+	// make sure the withholding transcoder is selected first
+	m.RTmutex.Lock()
+	m.liveTranscoders[s2].load = 1
+	sort.Sort(byLoadFactor(m.remoteTranscoders))
+	m.RTmutex.Unlock()
+
+	RemoteTranscoderTimeout = 5 * time.Millisecond
+	RemoteTranscoderRetries = 1
+	defer func() {
+		RemoteTranscoderTimeout = 8 * time.Second
+		RemoteTranscoderRetries = 0
+	}()
+
+	res, err := m.Transcode("", "fname", nil)
+	assert.Nil(err)
+	require.NotNil(t, res)
+	assert.Len(res.Segments, 1)
+	assert.Equal("fname", s1.LastNotify.Url)
+	assert.Equal("fname", s2.LastNotify.Url)
+	assert.NotEqual(s1.LastNotify.TaskId, s2.LastNotify.TaskId)
+	assert.Equal(1, m.liveTranscoders[s1].timeouts)
+	assert.Equal(0, m.liveTranscoders[s1].load)
+	assert.Equal(1, m.liveTranscoders[s2].load)
+
+	// late result from the original transcoder is ignored
+	m.transcoderResults(s1.LastNotify.TaskId, s1.ID, &RemoteTranscoderResult{})
+	m.taskMutex.RLock()
+	assert.Empty(m.taskChans)
+	m.taskMutex.RUnlock()
+
+	// out of transcoders to reassign to; original error is returned
+	s2.WithholdResults = true
+	RemoteTranscoderRetries = 5
+	_, err = m.Transcode("", "fname", nil)
+	assert.Equal(ErrRemoteTranscoderTimeout, err)
+	assert.Equal(2, m.liveTranscoders[s1].timeouts)
+	assert.Equal(1, m.liveTranscoders[s2].timeouts)
+}
+
+func TestTranscoderManagerStats(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	strm := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	go m.Manage(strm, 5, nil, "gpu1", false)
+	time.Sleep(1 * time.Millisecond)
+	require.Equal(t, 1, m.RegisteredTranscodersCount())
+
+	info := m.RegisteredTranscodersInfo()
+	require.Len(t, info, 1)
+	assert.Equal("gpu1", info[0].Name)
+	assert.False(info[0].LastSeen.IsZero())
+	connected := info[0].LastSeen
+
+	_, err := m.Transcode("", "fname", nil)
+	assert.Nil(err)
+	assert.Empty(strm.LastNotify.PrefetchUrls)
+	_, err = m.Transcode("", "https://127.0.0.1:8935/stream/abc/5.ts", nil)
+	assert.Nil(err)
+	// upcoming segments are hinted
+	assert.Equal([]string{"https://127.0.0.1:8935/stream/abc/6.ts", "https://127.0.0.1:8935/stream/abc/7.ts"}, strm.LastNotify.PrefetchUrls)
+
+	strm.TranscodeError = fmt.Errorf("TranscodeError")
+	_, err = m.Transcode("", "fname", nil)
+	assert.NotNil(err)
+
+	strm.WithholdResults = true
+	RemoteTranscoderTimeout = 5 * time.Millisecond
+	defer func() { RemoteTranscoderTimeout = 8 * time.Second }()
+	_, err = m.Transcode("", "fname", nil)
+	assert.Equal(ErrRemoteTranscoderTimeout, err)
+
+	info = m.RegisteredTranscodersInfo()
+	require.Len(t, info, 1)
+	assert.Equal(2, info[0].Completed)
+	assert.Equal(1, info[0].Failures)
+	assert.Equal(1, info[0].Timeouts)
+	assert.Equal(0, info[0].Load)
+	assert.True(info[0].AvgTranscodeTime > 0)
+	assert.True(info[0].LastSeen.After(connected))
+
+	// metrics are labelled by token name; shared secret transcoders share a label
+	for _, rt := range m.liveTranscoders {
+		assert.Equal("gpu1", rt.label())
+	}
+	assert.Equal("shared", (&RemoteTranscoder{addr: "10.0.0.5:41234"}).label())
+
+	// a transcoder is dropped by its connection ID, leaving others that
+	// connected from the same address
+	go m.Manage(&StubTranscoderServer{manager: m}, 5, nil, "gpu2", false)
+	time.Sleep(1 * time.Millisecond)
+	require.Equal(t, 2, m.RegisteredTranscodersCount())
+	assert.NotEmpty(info[0].ID)
+	assert.False(m.DisconnectTranscoder("nobody"))
+	assert.False(m.DisconnectTranscoder("TestAddress"))
+	assert.True(m.DisconnectTranscoder(info[0].ID))
+	time.Sleep(1 * time.Millisecond)
+	info = m.RegisteredTranscodersInfo()
+	require.Len(t, info, 1)
+	assert.Equal("gpu2", info[0].Name)
+}
+
+func TestTranscoderManagerHeartbeat(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	alive := &StubTranscoderServer{manager: m}
+	silent := &StubTranscoderServer{manager: m, IgnorePings: true}
+	legacy := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	RemoteTranscoderPingInterval = 5 * time.Millisecond
+	RemoteTranscoderPingTimeout = 5 * time.Millisecond
+	defer func() {
+		RemoteTranscoderPingInterval = 10 * time.Second
+		RemoteTranscoderPingTimeout = 5 * time.Second
+	}()
+
+	silentDone, aliveDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		m.Manage(alive, 5, nil, "", true)
+		close(aliveDone)
+	}()
+	go func() {
+		m.Manage(silent, 5, nil, "", true)
+		close(silentDone)
+	}()
+	go m.Manage(legacy, 5, nil, "", false)
+
+	// the transcoder that doesn't answer is dropped
+	select {
+	case <-silentDone:
+	case <-time.After(time.Second):
+		assert.Fail("silent transcoder not disconnected")
+	}
+	time.Sleep(20 * time.Millisecond)
+	m.RTmutex.Lock()
+	assert.Len(m.liveTranscoders, 2)
+	assert.NotNil(m.liveTranscoders[alive])
+	assert.NotNil(m.liveTranscoders[legacy])
+	m.RTmutex.Unlock()
+	assert.True(atomic.LoadInt32(&alive.pings) > 1)
+	assert.Equal(int32(1), atomic.LoadInt32(&silent.pings))
+	assert.Equal(int32(0), atomic.LoadInt32(&legacy.pings))
+
+	// pings aren't mistaken for segments
+	assert.Nil(alive.LastNotify)
+	m.taskMutex.RLock()
+	assert.Empty(m.taskChans)
+	m.taskMutex.RUnlock()
+
+	// stop pinging before the intervals are restored
+	m.RTmutex.Lock()
+	m.liveTranscoders[alive].done()
+	m.RTmutex.Unlock()
+	<-aliveDone
+}
+
+func TestTranscoderPong(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	rt := &RemoteTranscoder{manager: m, id: "conn1", pong: make(chan int64, 1)}
+	assert := assert.New(t)
+
+	pingID := m.addPing(rt)
+	assert.NotEqual(int64(0), pingID)
+	assert.Equal(ErrTranscoderTaskMismatch, m.transcoderPong(pingID, "conn2"))
+	assert.Nil(m.transcoderPong(pingID, "conn1"))
+	assert.Equal(pingID, <-rt.pong)
+
+	// late answer is ignored
+	m.removePing(pingID)
+	assert.Nil(m.transcoderPong(pingID, "conn1"))
+	assert.Empty(rt.pong)
+}
+
+func TestTranscoderManagerCapabilities(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	s1 := &StubTranscoderServer{manager: m}
+	s2 := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	go m.Manage(s1, 5, &net.TranscoderCapabilities{MaxWidth: 640, MaxHeight: 360}, "", false)
+	go m.Manage(s2, 1, &net.TranscoderCapabilities{Codecs: []string{CodecH264}, Acceleration: "nvidia"}, "", false)
+	time.Sleep(1 * time.Millisecond)
+	require.Len(t, m.liveTranscoders, 2)
+
+	// only s2 can handle 720p
+	hd := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P240p30fps16x9}
+	_, err := m.Transcode("", "hd", hd)
+	assert.Nil(err)
+	assert.Nil(s1.LastNotify)
+	assert.Equal("hd", s2.LastNotify.Url)
+
+	// s2 is at capacity; s1 can't handle 720p
+	trans := m.selectTranscoder(hd, nil)
+	assert.Equal(m.liveTranscoders[s2], trans)
+	_, err = m.Transcode("", "hd", hd)
+	assert.Equal(ErrNoTranscodersAvailable, err)
+
+	// s1 can handle 360p
+	sd := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	_, err = m.Transcode("", "sd", sd)
+	assert.Nil(err)
+	assert.Equal("sd", s1.LastNotify.Url)
+	m.completeTranscoders(trans)
+
+	// capabilities are reported
+	infos := m.RegisteredTranscodersInfo()
+	assert.Len(infos, 2)
+	for _, info := range infos {
+		assert.NotNil(info.Capabilities)
+	}
+}
+
+func TestRemoteTranscoderSupports(t *testing.T) {
+	assert := assert.New(t)
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P360p30fps16x9}
+	custom := ffmpeg.VideoProfile{Name: "custom", Bitrate: "1k", Framerate: 30, Resolution: "1080x1920"}
+
+	rt := &RemoteTranscoder{}
+	assert.True(rt.supports(profiles))
+	assert.True(rt.supports([]ffmpeg.VideoProfile{custom}))
+
+	rt.caps = &net.TranscoderCapabilities{}
+	assert.True(rt.supports(profiles))
+
+	// codecs
+	rt.caps = &net.TranscoderCapabilities{Codecs: []string{"VP9"}}
+	assert.False(rt.supports(profiles))
+	rt.caps.Codecs = append(rt.caps.Codecs, CodecH264)
+	assert.True(rt.supports(profiles))
+
+	// resolution
+	rt.caps = &net.TranscoderCapabilities{MaxWidth: 1280, MaxHeight: 720}
+	assert.True(rt.supports(profiles))
+	assert.False(rt.supports([]ffmpeg.VideoProfile{custom}))
+	rt.caps = &net.TranscoderCapabilities{MaxHeight: 360}
+	assert.False(rt.supports(profiles))
+	assert.True(rt.supports(profiles[1:]))
+
+	// profile names
+	rt.caps = &net.TranscoderCapabilities{Profiles: []string{ffmpeg.P360p30fps16x9.Name}}
+	assert.False(rt.supports(profiles))
+	assert.True(rt.supports(profiles[1:]))
+}
+
+func TestTranscoderTokens(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n, _ := NewLivepeerNode(nil, "", nil)
+	_, err := n.IssueTranscoderToken("gpu1")
+	assert.Equal(ErrMissingDatabase, err)
+	_, ok := n.authenticateTranscoder("foo")
+	assert.False(ok)
+
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+	n.Database = dbh
+	n.OrchSecret = "secret"
+	n.TranscoderManager = NewRemoteTranscoderManager()
+
+	token, err := n.IssueTranscoderToken("gpu1")
+	require.Nil(err)
+	assert.Len(token, 64)
+	_, err = n.IssueTranscoderToken("gpu1")
+	assert.NotNil(err)
+	_, err = n.IssueTranscoderToken("")
+	assert.NotNil(err)
+
+	names, err := n.TranscoderTokens()
+	require.Nil(err)
+	assert.Equal([]string{"gpu1"}, names)
+
+	// tokens and the shared secret authenticate
+	name, ok := n.authenticateTranscoder(token)
+	assert.True(ok)
+	assert.Equal("gpu1", name)
+	name, ok = n.authenticateTranscoder("secret")
+	assert.True(ok)
+	assert.Empty(name)
+	_, ok = n.authenticateTranscoder("foo")
+	assert.False(ok)
+	_, ok = n.authenticateTranscoder("")
+	assert.False(ok)
+
+	// empty shared secret is disabled
+	n.OrchSecret = ""
+	_, ok = n.authenticateTranscoder("")
+	assert.False(ok)
+
+	// revoking disconnects the transcoder
+	strm := &StubTranscoderServer{}
+	wg := newWg(1)
+	go func() { n.TranscoderManager.Manage(strm, 5, nil, "gpu1", false); wg.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	require.Nil(n.RevokeTranscoderToken("gpu1"))
+	assert.True(wgWait(wg))
+	_, ok = n.authenticateTranscoder(token)
+	assert.False(ok)
+	assert.Equal(ErrUnknownTranscoder, n.RevokeTranscoderToken("gpu1"))
+}
+
+func TestTranscoderResultsOwner(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	s1 := &StubTranscoderServer{manager: m}
+	s2 := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	// both use the shared secret
+	go m.Manage(s1, 5, nil, "", false)
+	go m.Manage(s2, 5, nil, "", false)
+	time.Sleep(1 * time.Millisecond)
+	m.RTmutex.Lock()
+	rt1 := m.liveTranscoders[s1]
+	m.RTmutex.Unlock()
+	require.NotNil(t, rt1)
+	assert.NotEmpty(s1.ID)
+	assert.NotEqual(s1.ID, s2.ID)
+
+	// results posted over another connection are rejected
+	taskID, taskChan := m.addTaskChan(rt1)
+	assert.Equal(ErrTranscoderTaskMismatch, m.transcoderResults(taskID, s2.ID, &RemoteTranscoderResult{}))
+	assert.Equal(ErrTranscoderTaskMismatch, m.transcoderResults(taskID, "", &RemoteTranscoderResult{}))
+	assert.Nil(m.transcoderResults(taskID, s1.ID, &RemoteTranscoderResult{}))
+	assert.Len(taskChan, 1)
+	m.removeTaskChan(taskID)
+
+	// unknown tasks are ignored
+	assert.Nil(m.transcoderResults(taskID, s1.ID, &RemoteTranscoderResult{}))
+
+	RemoteTranscoderTimeout = 5 * time.Millisecond
+	defer func() { RemoteTranscoderTimeout = 8 * time.Second }()
+	id1, id2 := s1.ID, s2.ID
+	s1.ID, s2.ID = id2, id1
+	_, err := m.Transcode("", "", nil)
+	assert.Equal(ErrRemoteTranscoderTimeout, err)
+
+	s1.ID, s2.ID = id1, id2
+	res, err := m.Transcode("", "", nil)
+	assert.Nil(err)
+	assert.Len(res.Segments, 1)
 }
 
 func TestTaskChan(t *testing.T) {
@@ -359,7 +750,7 @@ func TestTaskChan(t *testing.T) {
 	// Adding task chans
 	const MaxTasks = 1000
 	for i := 0; i < MaxTasks; i++ {
-		go n.addTaskChan() // hopefully concurrently...
+		go n.addTaskChan(nil) // hopefully concurrently...
 	}
 	for j := 0; j < 10; j++ {
 		n.taskMutex.RLock()
@@ -420,11 +811,31 @@ type StubTranscoderServer struct {
 	SendError       error
 	TranscodeError  error
 	WithholdResults bool
+	LastNotify      *net.NotifySegment
+	// ID the results are posted with, as sent by the manager
+	ID          string
+	IgnorePings bool
+	pings       int32
 
 	common.StubServerStream
 }
 
+func (s *StubTranscoderServer) SendHeader(md metadata.MD) error {
+	if v := md.Get(TranscoderIDKey); len(v) > 0 {
+		s.ID = v[0]
+	}
+	return nil
+}
+
 func (s *StubTranscoderServer) Send(n *net.NotifySegment) error {
+	if n.PingId != 0 {
+		atomic.AddInt32(&s.pings, 1)
+		if !s.IgnorePings {
+			s.manager.transcoderPong(n.PingId, s.ID)
+		}
+		return s.SendError
+	}
+	s.LastNotify = n
 	res := RemoteTranscoderResult{
 		TranscodeData: &TranscodeData{
 			Segments: []*TranscodedSegmentData{
@@ -434,7 +845,7 @@ func (s *StubTranscoderServer) Send(n *net.NotifySegment) error {
 		Err: s.TranscodeError,
 	}
 	if !s.WithholdResults {
-		s.manager.transcoderResults(n.TaskId, &res)
+		s.manager.transcoderResults(n.TaskId, s.ID, &res)
 	}
 	return s.SendError
 }
@@ -526,6 +937,258 @@ func TestOrchCheckCapacity(t *testing.T) {
 	assert.Nil(o.CheckCapacity(md.ManifestID))
 }
 
+func TestOrchDrain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n)
+	oldTimeout, oldCap := transcodeLoopTimeout, MaxSessions
+	defer func() { transcodeLoopTimeout, MaxSessions = oldTimeout, oldCap }()
+	transcodeLoopTimeout = 100 * time.Millisecond
+	MaxSessions = 10
+
+	isDrained := func() bool {
+		select {
+		case <-n.Drained():
+			return true
+		default:
+			return false
+		}
+	}
+
+	md := StubSegTranscodingMetadata()
+	_, err := n.getSegmentChan(md)
+	require.Nil(err)
+
+	n.SetDraining(true)
+	draining, sessions := n.IsDraining()
+	assert.True(draining)
+	assert.Equal(1, sessions)
+
+	// existing sessions continue; new ones are rejected
+	assert.Nil(o.CheckCapacity(md.ManifestID))
+	_, err = n.getSegmentChan(md)
+	assert.Nil(err)
+	other := StubSegTranscodingMetadata()
+	other.ManifestID = ManifestID(t.Name())
+	assert.Equal(ErrOrchDraining, o.CheckCapacity(other.ManifestID))
+	_, err = n.getSegmentChan(other)
+	assert.Equal(ErrOrchDraining, err)
+	assert.False(isDrained())
+
+	// drained once the transcode loop times out
+	select {
+	case <-n.Drained():
+	case <-time.After(time.Second):
+		t.Error("orchestrator did not drain")
+	}
+	_, sessions = n.IsDraining()
+	assert.Zero(sessions)
+
+	// leaving drain mode accepts new sessions again
+	n.SetDraining(false)
+	assert.False(isDrained())
+	assert.Nil(o.CheckCapacity(other.ManifestID))
+
+	// draining without sessions completes immediately
+	n.SetDraining(true)
+	assert.True(isDrained())
+}
+
+// blockingTranscoder blocks each segment until it is released by name
+type blockingTranscoder struct {
+	mu        sync.Mutex
+	calls     map[string]int
+	release   map[string]chan struct{}
+	active    int
+	maxActive int
+}
+
+func newBlockingTranscoder() *blockingTranscoder {
+	return &blockingTranscoder{calls: make(map[string]int), release: make(map[string]chan struct{})}
+}
+
+func (bt *blockingTranscoder) releaseChan(name string) chan struct{} {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if _, ok := bt.release[name]; !ok {
+		bt.release[name] = make(chan struct{})
+	}
+	return bt.release[name]
+}
+
+func (bt *blockingTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+	name := path.Base(fname)
+	bt.mu.Lock()
+	bt.calls[name]++
+	bt.active++
+	if bt.active > bt.maxActive {
+		bt.maxActive = bt.active
+	}
+	bt.mu.Unlock()
+
+	<-bt.releaseChan(name)
+
+	bt.mu.Lock()
+	bt.active--
+	bt.mu.Unlock()
+	segments := make([]*TranscodedSegmentData, 0)
+	for _, p := range profiles {
+		segments = append(segments, &TranscodedSegmentData{Data: []byte(fmt.Sprintf("Transcoded_%v_%v", p.Name, name))})
+	}
+	return &TranscodeData{Segments: segments}, nil
+}
+
+func (bt *blockingTranscoder) stats(name string) (calls, active, maxActive int) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.calls[name], bt.active, bt.maxActive
+}
+
+func TestTranscodeLoop_Concurrency(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	tmpdir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpdir)
+	n, _ := NewLivepeerNode(nil, tmpdir, nil)
+	tr := newBlockingTranscoder()
+	n.Transcoder = tr
+	oldConcurrency, oldCap := MaxStreamConcurrency, MaxSessions
+	defer func() { MaxStreamConcurrency, MaxSessions = oldConcurrency, oldCap }()
+	MaxStreamConcurrency = 2
+	MaxSessions = 10
+
+	type result struct {
+		seq int64
+		res *TranscodeResult
+		err error
+	}
+	results := make(chan result, 10)
+	send := func(seq int64) {
+		md := StubSegTranscodingMetadata()
+		md.Seq = seq
+		seg := &stream.HLSSegment{SeqNo: uint64(seq), Data: []byte("data")}
+		go func() {
+			res, err := n.sendToTranscodeLoop(md, seg)
+			results <- result{seq, res, err}
+		}()
+	}
+	waitCalls := func(name string, calls int) {
+		for i := 0; i < 100; i++ {
+			if c, _, _ := tr.stats(name); c >= calls {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("segment %v was not transcoded", name)
+	}
+
+	// two segments are transcoded at once
+	send(1)
+	waitCalls("1.ts", 1)
+	send(2)
+	waitCalls("2.ts", 1)
+	_, active, _ := tr.stats("")
+	assert.Equal(2, active)
+
+	// the next segment waits for a slot and one more is queued; any more
+	// are rejected
+	send(3)
+	time.Sleep(20 * time.Millisecond)
+	send(4)
+	time.Sleep(50 * time.Millisecond)
+	md := StubSegTranscodingMetadata()
+	md.Seq = 5
+	_, err := n.sendToTranscodeLoop(md, &stream.HLSSegment{SeqNo: 5, Data: []byte("data")})
+	assert.Equal(ErrOrchBusy, err)
+
+	// results are returned in order
+	close(tr.releaseChan("2.ts"))
+	waitCalls("3.ts", 1)
+	select {
+	case r := <-results:
+		t.Errorf("Unexpected result for segment %d before segment 1", r.seq)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a repeated segment waits for the in-flight one
+	send(3)
+	close(tr.releaseChan("1.ts"))
+	waitCalls("4.ts", 1)
+	time.Sleep(50 * time.Millisecond)
+	close(tr.releaseChan("3.ts"))
+	close(tr.releaseChan("4.ts"))
+	seqs := []int64{}
+	for i := 0; i < 5; i++ {
+		r := <-results
+		require.Nil(r.err)
+		assert.Equal(fmt.Sprintf("Transcoded_P144p30fps16x9_%d.ts", r.seq), string(r.res.TranscodeData.Segments[0].Data))
+		seqs = append(seqs, r.seq)
+	}
+	assert.ElementsMatch([]int64{1, 2, 3, 3, 4}, seqs)
+
+	calls, _, maxActive := tr.stats("3.ts")
+	assert.Equal(1, calls, "In-flight segment was transcoded again")
+	assert.Equal(2, maxActive)
+}
+
+func TestTranscodeLoop_StoreAhead(t *testing.T) {
+	assert := assert.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	tmpdir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpdir)
+	n, _ := NewLivepeerNode(nil, tmpdir, nil)
+	tr := newBlockingTranscoder()
+	n.Transcoder = tr
+	oldCap := MaxSessions
+	defer func() { MaxSessions = oldCap }()
+	MaxSessions = 10
+
+	results := make(chan error, 2)
+	send := func(seq uint64, data string) {
+		md := StubSegTranscodingMetadata()
+		md.Seq = int64(seq)
+		go func() {
+			_, err := n.sendToTranscodeLoop(md, &stream.HLSSegment{SeqNo: seq, Data: []byte(data)})
+			results <- err
+		}()
+	}
+
+	send(1, "data1")
+	time.Sleep(20 * time.Millisecond)
+	send(2, "data2")
+	time.Sleep(20 * time.Millisecond)
+
+	// segment 2 is stored while segment 1 is transcoded
+	calls, active, _ := tr.stats("2.ts")
+	assert.Equal(0, calls)
+	assert.Equal(1, active)
+	sess := drivers.NodeStorage.(*drivers.MemoryOS).GetSession("abcdef")
+	assert.Equal([]byte("data2"), sess.GetData("/stream/abcdef/2.ts"))
+
+	close(tr.releaseChan("1.ts"))
+	close(tr.releaseChan("2.ts"))
+	assert.Nil(<-results)
+	assert.Nil(<-results)
+	calls, _, _ = tr.stats("2.ts")
+	assert.Equal(1, calls)
+}
+
+func TestNextSegmentURLs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"https://127.0.0.1:8935/stream/abc/6.ts", "https://127.0.0.1:8935/stream/abc/7.ts"},
+		nextSegmentURLs("https://127.0.0.1:8935/stream/abc/5.ts", 2))
+	assert.Equal([]string{"/stream/abc/10.ts"}, nextSegmentURLs("/stream/abc/9.ts", 1))
+	assert.Nil(nextSegmentURLs("https://127.0.0.1:8935/stream/abc/5.ts", 0))
+	assert.Nil(nextSegmentURLs("https://bucket.s3.amazonaws.com/abc/source/seg.ts", 2))
+	assert.Nil(nextSegmentURLs("/tmp/abc.ts", 2))
+}
+
 func TestProcessPayment_GivenRecipientError_ReturnsNil(t *testing.T) {
 	n, _ := NewLivepeerNode(nil, "", nil)
 	n.Balances = NewAddressBalances(5 * time.Second)
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	ogErrors "errors"
 	"fmt"
 	"io/ioutil"
@@ -9,7 +11,9 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
@@ -31,6 +36,10 @@ import (
 
 var transcodeLoopTimeout = 1 * time.Minute
 
+// MaxStreamConcurrency is the maximum number of segments of a single stream
+// that are transcoded at once
+var MaxStreamConcurrency = 1
+
 // Transcoder / orchestrator RPC interface implementation
 type orchestrator struct {
 	address ethcommon.Address
@@ -71,12 +80,19 @@ func (orch *orchestrator) TranscoderSecret() string {
 	return orch.node.OrchSecret
 }
 
+func (orch *orchestrator) AuthenticateTranscoder(creds string) (string, bool) {
+	return orch.node.authenticateTranscoder(creds)
+}
+
 func (orch *orchestrator) CheckCapacity(mid ManifestID) error {
 	orch.node.segmentMutex.RLock()
 	defer orch.node.segmentMutex.RUnlock()
 	if _, ok := orch.node.SegmentChans[mid]; ok {
 		return nil
 	}
+	if orch.node.draining {
+		return ErrOrchDraining
+	}
 	if len(orch.node.SegmentChans) >= MaxSessions {
 		return ErrOrchCap
 	}
@@ -87,12 +103,16 @@ func (orch *orchestrator) TranscodeSeg(md *SegTranscodingMetadata, seg *stream.H
 	return orch.node.sendToTranscodeLoop(md, seg)
 }
 
-func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
-	orch.node.serveTranscoder(stream, capacity)
+func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) {
+	orch.node.serveTranscoder(stream, capacity, caps, name, heartbeat)
 }
 
-func (orch *orchestrator) TranscoderResults(tcID int64, res *RemoteTranscoderResult) {
-	orch.node.TranscoderManager.transcoderResults(tcID, res)
+func (orch *orchestrator) TranscoderResults(tcID int64, transcoderID string, res *RemoteTranscoderResult) error {
+	return orch.node.TranscoderManager.transcoderResults(tcID, transcoderID, res)
+}
+
+func (orch *orchestrator) TranscoderPong(pingID int64, transcoderID string) error {
+	return orch.node.TranscoderManager.transcoderPong(pingID, transcoderID)
 }
 
 func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID ManifestID) error {
@@ -331,6 +351,7 @@ func NewOrchestrator(n *LivepeerNode) *orchestrator {
 
 var ErrOrchBusy = ogErrors.New("OrchestratorBusy")
 var ErrOrchCap = ogErrors.New("OrchestratorCapped")
+var ErrOrchDraining = ogErrors.New("OrchestratorDraining")
 
 type TranscodeResult struct {
 	Err           error
@@ -349,6 +370,7 @@ type TranscodeData struct {
 type TranscodedSegmentData struct {
 	Data   []byte
 	Pixels int64 // Encoded pixels
+	Err    error // Set if this profile failed in a partial result
 }
 
 type SegChanData struct {
@@ -368,6 +390,33 @@ type TranscoderChan chan *RemoteTranscoderResult
 type transcodeConfig struct {
 	OS      drivers.OSSession
 	LocalOS drivers.OSSession
+	// Segments stored in LocalOS ahead of being transcoded
+	stored *storedSegments
+}
+
+// storedSegments tracks the URLs of segments the transcode loop stored for
+// remote transcoders while waiting to transcode them
+type storedSegments struct {
+	mu   sync.Mutex
+	urls map[uint64]string
+}
+
+func (s *storedSegments) put(seq uint64, url string) {
+	s.mu.Lock()
+	s.urls[seq] = url
+	s.mu.Unlock()
+}
+
+// take returns the URL the segment was stored at, if any
+func (s *storedSegments) take(seq uint64) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url := s.urls[seq]
+	delete(s.urls, seq)
+	return url
 }
 
 func (rtm *RemoteTranscoderManager) getTaskChan(taskID int64) (TranscoderChan, error) {
@@ -379,7 +428,14 @@ func (rtm *RemoteTranscoderManager) getTaskChan(taskID int64) (TranscoderChan, e
 	return nil, fmt.Errorf("No transcoder channel")
 }
 
-func (rtm *RemoteTranscoderManager) addTaskChan() (int64, TranscoderChan) {
+func (rtm *RemoteTranscoderManager) getTaskOwner(taskID int64) *RemoteTranscoder {
+	rtm.taskMutex.RLock()
+	defer rtm.taskMutex.RUnlock()
+	return rtm.taskOwners[taskID]
+}
+
+// addTaskChan creates a task for the transcoder
+func (rtm *RemoteTranscoderManager) addTaskChan(rt *RemoteTranscoder) (int64, TranscoderChan) {
 	rtm.taskMutex.Lock()
 	defer rtm.taskMutex.Unlock()
 	taskID := rtm.taskCount
@@ -390,9 +446,45 @@ func (rtm *RemoteTranscoderManager) addTaskChan() (int64, TranscoderChan) {
 		return taskID, tc
 	}
 	rtm.taskChans[taskID] = make(TranscoderChan, 1)
+	rtm.taskOwners[taskID] = rt
 	return taskID, rtm.taskChans[taskID]
 }
 
+func (rtm *RemoteTranscoderManager) addPing(rt *RemoteTranscoder) int64 {
+	rtm.taskMutex.Lock()
+	defer rtm.taskMutex.Unlock()
+	// zero marks segments, so start from one
+	rtm.pingCount++
+	rtm.pings[rtm.pingCount] = rt
+	return rtm.pingCount
+}
+
+func (rtm *RemoteTranscoderManager) removePing(pingID int64) {
+	rtm.taskMutex.Lock()
+	defer rtm.taskMutex.Unlock()
+	delete(rtm.pings, pingID)
+}
+
+// transcoderPong hands the answer to a ping to the pinging goroutine. Answers
+// that arrive after the deadline are ignored.
+func (rtm *RemoteTranscoderManager) transcoderPong(pingID int64, transcoderID string) error {
+	rtm.taskMutex.RLock()
+	rt, ok := rtm.pings[pingID]
+	rtm.taskMutex.RUnlock()
+	if !ok {
+		glog.V(common.DEBUG).Infof("Ignoring late pong for pingId=%d", pingID)
+		return nil
+	}
+	if rt.id != transcoderID {
+		return ErrTranscoderTaskMismatch
+	}
+	select {
+	case rt.pong <- pingID:
+	default:
+	}
+	return nil
+}
+
 func (rtm *RemoteTranscoderManager) removeTaskChan(taskID int64) {
 	rtm.taskMutex.Lock()
 	defer rtm.taskMutex.Unlock()
@@ -401,6 +493,7 @@ func (rtm *RemoteTranscoderManager) removeTaskChan(taskID int64) {
 		return
 	}
 	delete(rtm.taskChans, taskID)
+	delete(rtm.taskOwners, taskID)
 }
 
 func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan, error) {
@@ -410,6 +503,9 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 	if sc, ok := n.SegmentChans[md.ManifestID]; ok {
 		return sc, nil
 	}
+	if n.draining {
+		return nil, ErrOrchDraining
+	}
 	if len(n.SegmentChans) >= MaxSessions {
 		return nil, ErrOrchCap
 	}
@@ -425,6 +521,53 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 	return sc, nil
 }
 
+// SetDraining toggles drain mode. While draining, the orchestrator rejects
+// new streams and lets existing ones run until their transcode loops time out.
+func (n *LivepeerNode) SetDraining(draining bool) {
+	n.segmentMutex.Lock()
+	defer n.segmentMutex.Unlock()
+	if !draining && n.isDrained() {
+		// Drain already completed; start over
+		n.drained = make(chan struct{})
+	}
+	n.draining = draining
+	n.checkDrained()
+}
+
+// IsDraining returns whether the node is in drain mode, along with the number
+// of sessions still running
+func (n *LivepeerNode) IsDraining() (bool, int) {
+	n.segmentMutex.RLock()
+	defer n.segmentMutex.RUnlock()
+	return n.draining, len(n.SegmentChans)
+}
+
+// Drained returns a channel that is closed once the node is draining and
+// the last session has ended
+func (n *LivepeerNode) Drained() <-chan struct{} {
+	n.segmentMutex.RLock()
+	defer n.segmentMutex.RUnlock()
+	return n.drained
+}
+
+// checkDrained closes the drained channel if there is nothing left to drain.
+// Must be called with segmentMutex held.
+func (n *LivepeerNode) checkDrained() {
+	if n.draining && len(n.SegmentChans) == 0 && !n.isDrained() {
+		glog.Info("Orchestrator drained; no sessions left")
+		close(n.drained)
+	}
+}
+
+func (n *LivepeerNode) isDrained() bool {
+	select {
+	case <-n.drained:
+		return true
+	default:
+		return false
+	}
+}
+
 func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
 	glog.V(common.DEBUG).Infof("Starting to transcode segment manifest=%s seqNo=%d", string(md.ManifestID), md.Seq)
 	ch, err := n.getSegmentChan(md)
@@ -455,8 +598,9 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	}
 
 	// Prevent unnecessary work, check for replayed sequence numbers.
-	// NOTE: If we ever process segments from the same job concurrently,
-	// we may still end up doing work multiple times. But this is OK for now.
+	// NOTE: The transcode loop doesn't dispatch a segment that is already in
+	// flight, but a segment replayed after its result was returned is
+	// transcoded again. This is OK for now.
 
 	//Assume d is in the right format, write it to disk
 	inName := common.RandName() + ".ts"
@@ -490,6 +634,9 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 		// We're using a remote TC and segment is already in our own OS
 		// Incurs an additional download for topologies with T on local network!
 		url = seg.Name
+	} else if stored := config.stored.take(seg.SeqNo); stored != "" {
+		url = stored
+		seg.Name = url
 	} else {
 		// Need to store segment in our local OS
 		var err error
@@ -524,18 +671,26 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 
 	// Prepare the result object
 	var tr TranscodeResult
-	segHashes := make([][]byte, len(tSegments))
+	segHashes := make([][]byte, 0, len(tSegments))
 
 	for i := range md.Profiles {
 		if tSegments[i].Data == nil || len(tSegments[i].Data) < 25 {
-			glog.Errorf("Cannot find transcoded segment for manifest=%s seqNo=%d dataLength=%d",
-				string(md.ManifestID), seg.SeqNo, len(tSegments[i].Data))
-			return terr(fmt.Errorf("ZeroSegments"))
+			glog.Errorf("Cannot find transcoded segment for manifest=%s seqNo=%d profile=%s dataLength=%d",
+				string(md.ManifestID), seg.SeqNo, md.Profiles[i].Name, len(tSegments[i].Data))
+			if !md.PartialResults {
+				return terr(fmt.Errorf("ZeroSegments"))
+			}
+			// Leave the profile out of the result and the signature
+			tSegments[i] = &TranscodedSegmentData{Err: fmt.Errorf("ZeroSegments")}
+			continue
 		}
 		glog.V(common.DEBUG).Infof("Transcoded segment manifest=%s seqNo=%d profile=%s len=%d",
 			string(md.ManifestID), seg.SeqNo, md.Profiles[i].Name, len(tSegments[i].Data))
 		hash := crypto.Keccak256(tSegments[i].Data)
-		segHashes[i] = hash
+		segHashes = append(segHashes, hash)
+	}
+	if len(segHashes) == 0 {
+		return terr(fmt.Errorf("ZeroSegments"))
 	}
 	os.Remove(fname)
 	tr.OS = config.OS
@@ -573,48 +728,225 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 	config := transcodeConfig{
 		OS:      os,
 		LocalOS: los,
+		stored:  &storedSegments{urls: make(map[uint64]string)},
 	}
-	go func() {
-		for {
-			// XXX make context timeout configurable
-			ctx, cancel := context.WithTimeout(context.Background(), transcodeLoopTimeout)
-			select {
-			case <-ctx.Done():
-				// timeout; clean up goroutine here
-				os.EndSession()
-				los.EndSession()
-				glog.V(common.DEBUG).Info("Segment loop timed out; closing ", md.ManifestID)
-				n.segmentMutex.Lock()
-				if _, ok := n.SegmentChans[md.ManifestID]; ok {
-					close(n.SegmentChans[md.ManifestID])
-					delete(n.SegmentChans, md.ManifestID)
-					if lpmon.Enabled {
-						lpmon.CurrentSessions(len(n.SegmentChans))
-					}
+	go n.runTranscodeLoop(md.ManifestID, config, segChan, MaxStreamConcurrency)
+	return nil
+}
+
+// transcodeTask tracks a segment being transcoded by the transcode loop
+type transcodeTask struct {
+	hash ethcommon.Hash
+	// Result channels of the requests waiting on this segment
+	res []chan *TranscodeResult
+	// Closed once the previously dispatched segment has returned its result
+	prev chan struct{}
+	// Closed once this segment has returned its result
+	done chan struct{}
+}
+
+// runTranscodeLoop transcodes up to `concurrency` segments of a stream at
+// once. Results are returned in the order the segments came in. Segments are
+// not transcoded again while already in flight; repeated requests wait for the
+// in-flight result instead.
+func (n *LivepeerNode) runTranscodeLoop(mid ManifestID, config transcodeConfig, segChan SegmentChan, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		inFlight = make(map[int64]*transcodeTask)
+		slots    = make(chan struct{}, concurrency)
+		prev     = make(chan struct{})
+	)
+	close(prev)
+
+	for {
+		// XXX make context timeout configurable
+		ctx, cancel := context.WithTimeout(context.Background(), transcodeLoopTimeout)
+		select {
+		case <-ctx.Done():
+			cancel()
+			// timeout; clean up goroutine here once in-flight segments are done
+			wg.Wait()
+			config.OS.EndSession()
+			config.LocalOS.EndSession()
+			glog.V(common.DEBUG).Info("Segment loop timed out; closing ", mid)
+			n.segmentMutex.Lock()
+			if _, ok := n.SegmentChans[mid]; ok {
+				close(n.SegmentChans[mid])
+				delete(n.SegmentChans, mid)
+				if lpmon.Enabled {
+					lpmon.CurrentSessions(len(n.SegmentChans))
 				}
-				n.segmentMutex.Unlock()
-				return
-			case chanData := <-segChan:
-				chanData.res <- n.transcodeSeg(config, chanData.seg, chanData.md)
 			}
+			n.checkDrained()
+			n.segmentMutex.Unlock()
+			// Segments submitted while shutting down won't be transcoded
+			for chanData := range segChan {
+				chanData.res <- &TranscodeResult{Err: ErrOrchBusy}
+			}
+			return
+		case chanData := <-segChan:
 			cancel()
+			seq, hash := chanData.md.Seq, chanData.md.Hash
+			mu.Lock()
+			if task, ok := inFlight[seq]; ok && task.hash == hash {
+				task.res = append(task.res, chanData.res)
+				mu.Unlock()
+				glog.V(common.DEBUG).Infof("Segment already in flight; waiting for result manifestID=%s seqNo=%d", mid, seq)
+				continue
+			}
+			task := &transcodeTask{
+				hash: hash,
+				res:  []chan *TranscodeResult{chanData.res},
+				prev: prev,
+				done: make(chan struct{}),
+			}
+			if _, ok := inFlight[seq]; !ok {
+				inFlight[seq] = task
+			}
+			mu.Unlock()
+			prev = task.done
+
+			n.storeAhead(config, chanData.seg)
+			// Wait for a free slot before transcoding
+			slots <- struct{}{}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res := n.transcodeSeg(config, chanData.seg, chanData.md)
+				<-slots
+				// Keep results in order
+				<-task.prev
+				mu.Lock()
+				if inFlight[seq] == task {
+					delete(inFlight, seq)
+				}
+				waiting := task.res
+				mu.Unlock()
+				for _, ch := range waiting {
+					ch <- res
+				}
+				close(task.done)
+			}()
 		}
-	}()
-	return nil
+	}
 }
 
-func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+// storeAhead stores a segment for remote transcoders as soon as it comes in,
+// so they can fetch it while it waits for a free slot. Transcoders are told
+// where to expect upcoming segments; see nextSegmentURLs.
+func (n *LivepeerNode) storeAhead(config transcodeConfig, seg *stream.HLSSegment) {
+	if config.stored == nil || n.Transcoder == nil {
+		return
+	}
+	if _, isLocal := n.Transcoder.(*LocalTranscoder); isLocal || drivers.IsOwnExternal(seg.Name) {
+		return
+	}
+	url, err := config.LocalOS.SaveData(fmt.Sprintf("%d.ts", seg.SeqNo), seg.Data)
+	if err != nil {
+		// transcodeSeg tries again
+		glog.Errorf("Error storing segment seqNo=%d err=%v", seg.SeqNo, err)
+		return
+	}
+	config.stored.put(seg.SeqNo, url)
+}
+
+func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) {
 	from := common.GetConnectionAddr(stream.Context())
-	n.TranscoderManager.Manage(stream, capacity)
+	n.TranscoderManager.Manage(stream, capacity, caps, name, heartbeat)
 	glog.V(common.DEBUG).Infof("Closing transcoder=%s channel", from)
 }
 
-func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, res *RemoteTranscoderResult) {
+// IssueTranscoderToken creates a credential for the named standalone
+// transcoder. Only a hash of the token is kept, so it can't be retrieved later.
+func (n *LivepeerNode) IssueTranscoderToken(name string) (string, error) {
+	if n.Database == nil {
+		return "", ErrMissingDatabase
+	}
+	if name == "" {
+		return "", errors.New("Missing transcoder name")
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := n.Database.InsertTranscoderToken(name, hashTranscoderToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeTranscoderToken removes the credential of the named transcoder and
+// disconnects any transcoder using it
+func (n *LivepeerNode) RevokeTranscoderToken(name string) error {
+	if n.Database == nil {
+		return ErrMissingDatabase
+	}
+	deleted, err := n.Database.DeleteTranscoderToken(name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrUnknownTranscoder
+	}
+	if n.TranscoderManager != nil {
+		n.TranscoderManager.disconnectTranscoders(name)
+	}
+	return nil
+}
+
+// TranscoderTokens returns the names of transcoders that were issued a token
+func (n *LivepeerNode) TranscoderTokens() ([]string, error) {
+	if n.Database == nil {
+		return nil, ErrMissingDatabase
+	}
+	return n.Database.TranscoderTokenNames()
+}
+
+// authenticateTranscoder returns the name of the transcoder the credentials
+// were issued to. Transcoders using the shared secret have an empty name.
+func (n *LivepeerNode) authenticateTranscoder(creds string) (string, bool) {
+	if creds == "" {
+		return "", false
+	}
+	if n.OrchSecret != "" && creds == n.OrchSecret {
+		return "", true
+	}
+	if n.Database == nil {
+		return "", false
+	}
+	name, err := n.Database.TranscoderTokenName(hashTranscoderToken(creds))
+	if err != nil || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+func hashTranscoderToken(token string) string {
+	return crypto.Keccak256Hash([]byte(token)).Hex()
+}
+
+// transcoderResults hands the results of a task to the waiting Transcode call.
+// Results have to come over the connection the task was assigned to, as
+// identified by the ID it was given when registering.
+func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, transcoderID string, res *RemoteTranscoderResult) error {
 	remoteChan, err := rtm.getTaskChan(tcID)
 	if err != nil {
-		return // do we need to return anything?
+		// task timed out and may have been reassigned; drop the late result
+		glog.V(common.DEBUG).Infof("Ignoring result for unknown taskId=%d", tcID)
+		return nil
+	}
+	if owner := rtm.getTaskOwner(tcID); owner == nil || owner.id != transcoderID {
+		glog.Errorf("Rejecting result for taskId=%d from a transcoder it wasn't assigned to", tcID)
+		return ErrTranscoderTaskMismatch
 	}
 	remoteChan <- res
+	return nil
 }
 
 type RemoteTranscoder struct {
@@ -624,6 +956,38 @@ type RemoteTranscoder struct {
 	addr     string
 	capacity int
 	load     int
+	// consecutive timed out tasks
+	timeouts int
+	// nil if the transcoder didn't advertise any
+	caps *net.TranscoderCapabilities
+	// name of the credentials used; empty for the shared secret
+	name string
+	// random ID of the connection, sent to the transcoder when it registers.
+	// Results and pongs have to carry it.
+	id string
+	// lifetime counters, guarded by the manager's RTmutex
+	stats remoteTranscoderStats
+	// whether the transcoder answers pings
+	heartbeat bool
+	pong      chan int64
+	sendLock  sync.Mutex
+}
+
+type remoteTranscoderStats struct {
+	completed     int
+	failures      int
+	timeouts      int
+	transcodeTime time.Duration
+	lastSeen      time.Time
+}
+
+// label identifies the transcoder in metrics. Transcoders using the shared
+// secret all share one label, as their addresses change on every reconnect.
+func (rt *RemoteTranscoder) label() string {
+	if rt.name != "" {
+		return rt.name
+	}
+	return "shared"
 }
 
 // RemoteTranscoderFatalError wraps error to indicate that error is fatal
@@ -639,6 +1003,32 @@ func NewRemoteTranscoderFatalError(err error) error {
 
 var RemoteTranscoderTimeout = 8 * time.Second
 var ErrRemoteTranscoderTimeout = errors.New("Remote transcoder took too long")
+var ErrNoTranscodersAvailable = errors.New("No transcoders available")
+var ErrUnknownTranscoder = errors.New("Unknown transcoder")
+var ErrMissingDatabase = errors.New("Missing database")
+var ErrTranscoderTaskMismatch = errors.New("Task assigned to another transcoder")
+var ErrRemoteTranscoderPingTimeout = errors.New("Remote transcoder didn't answer ping")
+
+// TranscoderIDKey is the gRPC metadata key the ID of a transcoder's
+// connection is sent under when it registers
+const TranscoderIDKey = "transcoder-id"
+
+// RemoteTranscoderPrefetchHints is the number of upcoming segment URLs sent
+// along with each segment, for transcoders to fetch ahead of time
+var RemoteTranscoderPrefetchHints = 2
+
+// How often transcoders that support it are pinged, and how long they have
+// to answer before being disconnected
+var RemoteTranscoderPingInterval = 10 * time.Second
+var RemoteTranscoderPingTimeout = 5 * time.Second
+
+// RemoteTranscoderRetries is the number of times a timed out task is
+// reassigned to another transcoder before giving up
+var RemoteTranscoderRetries = 0
+
+// RemoteTranscoderMaxTimeouts is the number of consecutive timeouts after
+// which a transcoder is disconnected
+var RemoteTranscoderMaxTimeouts = 3
 
 func (rt *RemoteTranscoder) done() {
 	// select so we don't block indefinitely if there's no listener
@@ -650,7 +1040,7 @@ func (rt *RemoteTranscoder) done() {
 
 // Transcode do actual transcoding by sending work to remote transcoder and waiting for the result
 func (rt *RemoteTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	taskID, taskChan := rt.manager.addTaskChan()
+	taskID, taskChan := rt.manager.addTaskChan(rt)
 	defer rt.manager.removeTaskChan(taskID)
 	signalEOF := func(err error) (*TranscodeData, error) {
 		rt.done()
@@ -663,7 +1053,11 @@ func (rt *RemoteTranscoder) Transcode(job string, fname string, profiles []ffmpe
 		TaskId:   taskID,
 		Profiles: common.ProfilesToTranscodeOpts(profiles),
 	}
-	err := rt.stream.Send(msg)
+	if common.HasCustomProfiles(profiles) {
+		msg.FullProfiles = common.ProfilesToNetProfiles(profiles)
+	}
+	msg.PrefetchUrls = nextSegmentURLs(fname, RemoteTranscoderPrefetchHints)
+	err := rt.send(msg)
 	if err != nil {
 		return signalEOF(err)
 	}
@@ -671,21 +1065,118 @@ func (rt *RemoteTranscoder) Transcode(job string, fname string, profiles []ffmpe
 	defer cancel()
 	select {
 	case <-ctx.Done():
-		return signalEOF(ErrRemoteTranscoderTimeout)
+		glog.Errorf("Timed out waiting for remote transcoder=%s taskId=%d fname=%s", rt.addr, taskID, fname)
+		return nil, ErrRemoteTranscoderTimeout
 	case chanData := <-taskChan:
 		glog.Infof("Successfully received results from remote transcoder=%s segments=%d taskId=%d fname=%s err=%v",
 			rt.addr, len(chanData.TranscodeData.Segments), taskID, fname, chanData.Err)
 		return chanData.TranscodeData, chanData.Err
 	}
 }
-func NewRemoteTranscoder(m *RemoteTranscoderManager, stream net.Transcoder_RegisterTranscoderServer, capacity int) *RemoteTranscoder {
+
+var segmentURLPattern = regexp.MustCompile(`^(.*/)(\d+)\.ts$`)
+
+// nextSegmentURLs guesses where the segments following the one at segURL
+// will be. Segments are stored for remote transcoders under their sequence
+// number, see storeAhead. Returns nil for URLs named otherwise.
+func nextSegmentURLs(segURL string, count int) []string {
+	m := segmentURLPattern.FindStringSubmatch(segURL)
+	if m == nil || count <= 0 {
+		return nil
+	}
+	seq, err := strconv.ParseUint(m[2], 10, 64)
+	if err != nil {
+		return nil
+	}
+	urls := make([]string, 0, count)
+	for i := uint64(1); i <= uint64(count); i++ {
+		urls = append(urls, fmt.Sprintf("%s%d.ts", m[1], seq+i))
+	}
+	return urls
+}
+
+// send serializes messages to the transcoder; the stream isn't safe for
+// concurrent use
+func (rt *RemoteTranscoder) send(msg *net.NotifySegment) error {
+	rt.sendLock.Lock()
+	defer rt.sendLock.Unlock()
+	return rt.stream.Send(msg)
+}
+
+// ping checks that the transcoder is still responsive
+func (rt *RemoteTranscoder) ping() error {
+	pingID := rt.manager.addPing(rt)
+	defer rt.manager.removePing(pingID)
+	if err := rt.send(&net.NotifySegment{PingId: pingID}); err != nil {
+		return err
+	}
+	timer := time.NewTimer(RemoteTranscoderPingTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return ErrRemoteTranscoderPingTimeout
+		case id := <-rt.pong:
+			if id == pingID {
+				return nil
+			}
+			// late answer to an earlier ping
+		}
+	}
+}
+
+func NewRemoteTranscoder(m *RemoteTranscoderManager, stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) *RemoteTranscoder {
+	id := make([]byte, 16)
+	rand.Read(id)
 	return &RemoteTranscoder{
-		manager:  m,
-		stream:   stream,
-		eof:      make(chan struct{}, 1),
-		capacity: capacity,
-		addr:     common.GetConnectionAddr(stream.Context()),
+		manager:   m,
+		stream:    stream,
+		eof:       make(chan struct{}, 1),
+		capacity:  capacity,
+		addr:      common.GetConnectionAddr(stream.Context()),
+		caps:      caps,
+		name:      name,
+		id:        hex.EncodeToString(id),
+		heartbeat: heartbeat,
+		pong:      make(chan int64, 1),
+	}
+}
+
+// supports checks whether the transcoder can handle all of the profiles.
+// Transcoders that don't advertise capabilities are assumed to handle any.
+func (rt *RemoteTranscoder) supports(profiles []ffmpeg.VideoProfile) bool {
+	caps := rt.caps
+	if caps == nil {
+		return true
+	}
+	if len(caps.Codecs) > 0 && !containsString(caps.Codecs, CodecH264) {
+		return false
+	}
+	for _, p := range profiles {
+		if len(caps.Profiles) > 0 && !containsString(caps.Profiles, p.Name) {
+			return false
+		}
+		if caps.MaxWidth == 0 && caps.MaxHeight == 0 {
+			continue
+		}
+		w, h, err := ffmpeg.VideoProfileResolution(p)
+		if err != nil {
+			return false
+		}
+		if (caps.MaxWidth > 0 && w > int(caps.MaxWidth)) || (caps.MaxHeight > 0 && h > int(caps.MaxHeight)) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
+	return false
 }
 
 func NewRemoteTranscoderManager() *RemoteTranscoderManager {
@@ -694,8 +1185,10 @@ func NewRemoteTranscoderManager() *RemoteTranscoderManager {
 		liveTranscoders:   map[net.Transcoder_RegisterTranscoderServer]*RemoteTranscoder{},
 		RTmutex:           &sync.Mutex{},
 
-		taskMutex: &sync.RWMutex{},
-		taskChans: make(map[int64]TranscoderChan),
+		taskMutex:  &sync.RWMutex{},
+		taskChans:  make(map[int64]TranscoderChan),
+		taskOwners: make(map[int64]*RemoteTranscoder),
+		pings:      make(map[int64]*RemoteTranscoder),
 	}
 }
 
@@ -717,9 +1210,14 @@ type RemoteTranscoderManager struct {
 	RTmutex           *sync.Mutex
 
 	// For tracking tasks assigned to remote transcoders
-	taskMutex *sync.RWMutex
-	taskChans map[int64]TranscoderChan
-	taskCount int64
+	taskMutex  *sync.RWMutex
+	taskChans  map[int64]TranscoderChan
+	taskOwners map[int64]*RemoteTranscoder
+	taskCount  int64
+
+	// Outstanding pings, also guarded by taskMutex
+	pings     map[int64]*RemoteTranscoder
+	pingCount int64
 }
 
 // RegisteredTranscodersCount returns number of registered transcoders
@@ -734,16 +1232,35 @@ func (rtm *RemoteTranscoderManager) RegisteredTranscodersInfo() []net.RemoteTran
 	rtm.RTmutex.Lock()
 	res := make([]net.RemoteTranscoderInfo, 0, len(rtm.liveTranscoders))
 	for _, transcoder := range rtm.liveTranscoders {
-		res = append(res, net.RemoteTranscoderInfo{Address: transcoder.addr, Capacity: transcoder.capacity})
+		info := net.RemoteTranscoderInfo{
+			ID:           transcoder.id,
+			Address:      transcoder.addr,
+			Capacity:     transcoder.capacity,
+			Capabilities: transcoder.caps,
+			Name:         transcoder.name,
+			Load:         transcoder.load,
+			Completed:    transcoder.stats.completed,
+			Failures:     transcoder.stats.failures,
+			Timeouts:     transcoder.stats.timeouts,
+			LastSeen:     transcoder.stats.lastSeen,
+		}
+		if transcoder.stats.completed > 0 {
+			info.AvgTranscodeTime = transcoder.stats.transcodeTime.Seconds() / float64(transcoder.stats.completed)
+		}
+		res = append(res, info)
 	}
 	rtm.RTmutex.Unlock()
 	return res
 }
 
 // Manage adds transcoder to list of live transcoders. Doesn't return untill transcoder disconnects
-func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) {
 	from := common.GetConnectionAddr(stream.Context())
-	transcoder := NewRemoteTranscoder(rtm, stream, capacity)
+	transcoder := NewRemoteTranscoder(rtm, stream, capacity, caps, name, heartbeat)
+	if err := stream.SendHeader(metadata.Pairs(TranscoderIDKey, transcoder.id)); err != nil {
+		glog.Errorf("Could not send ID to transcoder=%s err=%v", from, err)
+		return
+	}
 	go func() {
 		ctx := stream.Context()
 		<-ctx.Done()
@@ -753,6 +1270,7 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 	}()
 
 	rtm.RTmutex.Lock()
+	transcoder.stats.lastSeen = time.Now()
 	rtm.liveTranscoders[transcoder.stream] = transcoder
 	rtm.remoteTranscoders = append(rtm.remoteTranscoders, transcoder)
 	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
@@ -765,7 +1283,13 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 		monitor.SetTranscodersNumberAndLoad(totalLoad, totalCapacity, liveTranscodersNum)
 	}
 
+	quit := make(chan struct{})
+	if heartbeat {
+		go rtm.heartbeat(transcoder, quit)
+	}
+
 	<-transcoder.eof
+	close(quit)
 	glog.Infof("Got transcoder=%s eof, removing from live transcoders map", from)
 
 	rtm.RTmutex.Lock()
@@ -779,7 +1303,9 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 	}
 }
 
-func (rtm *RemoteTranscoderManager) selectTranscoder() *RemoteTranscoder {
+// selectTranscoder picks the least loaded transcoder able to handle the
+// profiles, skipping any in exclude
+func (rtm *RemoteTranscoderManager) selectTranscoder(profiles []ffmpeg.VideoProfile, exclude map[*RemoteTranscoder]bool) *RemoteTranscoder {
 	rtm.RTmutex.Lock()
 	defer rtm.RTmutex.Unlock()
 
@@ -795,8 +1321,16 @@ func (rtm *RemoteTranscoderManager) selectTranscoder() *RemoteTranscoder {
 			rtm.remoteTranscoders = rtm.remoteTranscoders[:last]
 			continue
 		}
+		break
+	}
+
+	for i := len(rtm.remoteTranscoders) - 1; i >= 0; i-- {
+		currentTranscoder := rtm.remoteTranscoders[i]
+		if _, ok := rtm.liveTranscoders[currentTranscoder.stream]; !ok || exclude[currentTranscoder] || !currentTranscoder.supports(profiles) {
+			continue
+		}
 		if currentTranscoder.load == currentTranscoder.capacity {
-			// Head of queue is at capacity, so the rest must be too. Exit early
+			// Remaining transcoders are at least as loaded. Exit early
 			return nil
 		}
 		currentTranscoder.load++
@@ -816,9 +1350,109 @@ func (rtm *RemoteTranscoderManager) completeTranscoders(trans *RemoteTranscoder)
 		return
 	}
 	t.load--
+	t.timeouts = 0
 	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
 }
 
+// heartbeat pings the transcoder until quit is closed. A transcoder that
+// doesn't answer in time is disconnected, so it is dropped from the live
+// transcoders before a segment gets lost on it.
+func (rtm *RemoteTranscoderManager) heartbeat(rt *RemoteTranscoder, quit chan struct{}) {
+	ticker := time.NewTicker(RemoteTranscoderPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+		if err := rt.ping(); err != nil {
+			glog.Errorf("Disconnecting unresponsive transcoder=%s err=%v", rt.addr, err)
+			rt.done()
+			return
+		}
+		rtm.RTmutex.Lock()
+		rt.stats.lastSeen = time.Now()
+		rtm.RTmutex.Unlock()
+	}
+}
+
+// DisconnectTranscoder disconnects the live transcoder with the given
+// connection ID. Returns false if there is no such transcoder.
+// The transcoder is free to connect again right away.
+func (rtm *RemoteTranscoderManager) DisconnectTranscoder(id string) bool {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	for _, t := range rtm.liveTranscoders {
+		if t.id == id {
+			glog.Infof("Disconnecting transcoder=%s id=%s", t.addr, id)
+			t.done()
+			return true
+		}
+	}
+	return false
+}
+
+// disconnectTranscoders disconnects the transcoders using the named credentials
+func (rtm *RemoteTranscoderManager) disconnectTranscoders(name string) {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	for _, t := range rtm.liveTranscoders {
+		if t.name == name {
+			glog.Infof("Disconnecting transcoder=%s name=%s", t.addr, name)
+			t.done()
+		}
+	}
+}
+
+// timeoutTranscoder releases a task that timed out. The transcoder is
+// disconnected after RemoteTranscoderMaxTimeouts consecutive timeouts.
+func (rtm *RemoteTranscoderManager) timeoutTranscoder(trans *RemoteTranscoder) {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+
+	t, ok := rtm.liveTranscoders[trans.stream]
+	if !ok {
+		return
+	}
+	t.load--
+	t.timeouts++
+	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
+	if t.timeouts >= RemoteTranscoderMaxTimeouts {
+		glog.Errorf("Disconnecting transcoder=%s after timeouts=%d", t.addr, t.timeouts)
+		t.done()
+	}
+}
+
+// recordTask updates the counters of a transcoder once a task is over
+func (rtm *RemoteTranscoderManager) recordTask(trans *RemoteTranscoder, err error, took time.Duration) {
+	var errCode string
+	rtm.RTmutex.Lock()
+	_, fatal := err.(RemoteTranscoderFatalError)
+	switch {
+	case err == ErrRemoteTranscoderTimeout:
+		errCode = "Timeout"
+		trans.stats.timeouts++
+	case fatal:
+		errCode = "Disconnected"
+		trans.stats.failures++
+	case err != nil:
+		errCode = "TranscodeError"
+		trans.stats.failures++
+		trans.stats.lastSeen = time.Now()
+	default:
+		trans.stats.completed++
+		trans.stats.transcodeTime += took
+		trans.stats.lastSeen = time.Now()
+	}
+	load := trans.load
+	rtm.RTmutex.Unlock()
+
+	if monitor.Enabled {
+		monitor.RemoteTranscoderTaskDone(trans.label(), load, took, errCode)
+	}
+}
+
 // Caller of this function should hold RTmutex lock
 func (rtm *RemoteTranscoderManager) totalLoadAndCapacity() (int, int, int) {
 	var load, capacity int
@@ -831,20 +1465,42 @@ func (rtm *RemoteTranscoderManager) totalLoadAndCapacity() (int, int, int) {
 
 // Transcode does actual transcoding using remote transcoder from the pool
 func (rtm *RemoteTranscoderManager) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	currentTranscoder := rtm.selectTranscoder()
+	return rtm.transcode(job, fname, profiles, map[*RemoteTranscoder]bool{})
+}
+
+// transcode runs the task on a transcoder that hasn't timed out on it yet.
+// Timed out tasks are reassigned up to RemoteTranscoderRetries times; late
+// results from the original transcoder are dropped since its task is gone.
+func (rtm *RemoteTranscoderManager) transcode(job string, fname string, profiles []ffmpeg.VideoProfile, timedOut map[*RemoteTranscoder]bool) (*TranscodeData, error) {
+	currentTranscoder := rtm.selectTranscoder(profiles, timedOut)
 	if currentTranscoder == nil {
-		return nil, errors.New("No transcoders available")
+		return nil, ErrNoTranscodersAvailable
 	}
+	start := time.Now()
 	res, err := currentTranscoder.Transcode(job, fname, profiles)
-	_, fatal := err.(RemoteTranscoderFatalError)
-	if fatal {
-		// Don't retry if we've timed out; broadcaster likely to have moved on
-		// XXX problematic for VOD when we *should* retry
-		if err.(RemoteTranscoderFatalError).error == ErrRemoteTranscoderTimeout {
+	took := time.Since(start)
+	if err == ErrRemoteTranscoderTimeout {
+		rtm.timeoutTranscoder(currentTranscoder)
+		rtm.recordTask(currentTranscoder, err, took)
+		// Live broadcasters are likely to have moved on, so retries are opt-in
+		if len(timedOut) >= RemoteTranscoderRetries {
+			return res, err
+		}
+		timedOut[currentTranscoder] = true
+		glog.Infof("Reassigning fname=%s after timeout from transcoder=%s", fname, currentTranscoder.addr)
+		res, retryErr := rtm.transcode(job, fname, profiles, timedOut)
+		if retryErr == ErrNoTranscodersAvailable {
+			// nobody else to try; report the original timeout
 			return res, err
 		}
-		return rtm.Transcode(job, fname, profiles)
+		return res, retryErr
+	}
+	_, fatal := err.(RemoteTranscoderFatalError)
+	if fatal {
+		rtm.recordTask(currentTranscoder, err, took)
+		return rtm.transcode(job, fname, profiles, timedOut)
 	}
 	rtm.completeTranscoders(currentTranscoder)
+	rtm.recordTask(currentTranscoder, err, took)
 	return res, err
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/golang/glog"
@@ -12,6 +13,10 @@ import (
 
 const LIVE_LIST_LENGTH uint = 6
 
+// Names of the VOD playlists written into the OS session when a recorded stream ends
+const VOD_MASTER_PLAYLIST = "index.m3u8"
+const VOD_MEDIA_PLAYLIST = "%v.m3u8"
+
 //	PlaylistManager manages playlists and data for one video stream, backed by one object storage.
 type PlaylistManager interface {
 	ManifestID() ManifestID
@@ -35,6 +40,16 @@ type BasicPlaylistManager struct {
 	masterPList *m3u8.MasterPlaylist
 	mediaLists  map[string]*m3u8.MediaPlaylist
 	mapSync     *sync.RWMutex
+
+	// Full history of each rendition, kept only when recording
+	recording bool
+	records   map[string]*recording
+	recordOrd []string
+}
+
+type recording struct {
+	profile  ffmpeg.VideoProfile
+	segments map[uint64]*m3u8.MediaSegment
 }
 
 // NewBasicPlaylistManager create new BasicPlaylistManager struct
@@ -51,11 +66,29 @@ func NewBasicPlaylistManager(manifestID ManifestID,
 	return bplm
 }
 
+// NewRecordingPlaylistManager creates a BasicPlaylistManager that additionally
+// retains every inserted segment. When the stream is cleaned up, a VOD media
+// playlist per rendition and a master playlist referencing them are saved
+// into the storage session.
+func NewRecordingPlaylistManager(manifestID ManifestID,
+	storageSession drivers.OSSession) *BasicPlaylistManager {
+
+	bplm := NewBasicPlaylistManager(manifestID, storageSession)
+	bplm.recording = true
+	bplm.records = make(map[string]*recording)
+	return bplm
+}
+
 func (mgr *BasicPlaylistManager) ManifestID() ManifestID {
 	return mgr.manifestID
 }
 
 func (mgr *BasicPlaylistManager) Cleanup() {
+	if mgr.recording {
+		if err := mgr.saveRecording(); err != nil {
+			glog.Errorf("Error saving recording manifestID=%s err=%v", mgr.manifestID, err)
+		}
+	}
 	mgr.storageSession.EndSession()
 }
 
@@ -96,6 +129,9 @@ func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile,
 		return err
 	}
 	mseg := newMediaSegment(uri, duration)
+	if mgr.recording {
+		mgr.record(profile, seqNo, uri, duration)
+	}
 	if mpl.Count() >= mpl.WinSize() {
 		mpl.Remove()
 	}
@@ -116,6 +152,76 @@ func (mgr *BasicPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.Med
 	return mgr.getPL(rendition)
 }
 
+func (mgr *BasicPlaylistManager) record(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	rec, ok := mgr.records[profile.Name]
+	if !ok {
+		rec = &recording{
+			profile:  *profile,
+			segments: make(map[uint64]*m3u8.MediaSegment),
+		}
+		mgr.records[profile.Name] = rec
+		mgr.recordOrd = append(mgr.recordOrd, profile.Name)
+	}
+	if _, exists := rec.segments[seqNo]; exists {
+		return
+	}
+	mseg := newMediaSegment(uri, duration)
+	mseg.SeqId = seqNo
+	rec.segments[seqNo] = mseg
+}
+
+// saveRecording writes out the VOD playlists for all recorded renditions
+func (mgr *BasicPlaylistManager) saveRecording() error {
+	mgr.mapSync.RLock()
+	defer mgr.mapSync.RUnlock()
+	if mgr.storageSession == nil || len(mgr.recordOrd) == 0 {
+		return nil
+	}
+	masterPL := m3u8.NewMasterPlaylist()
+	for _, name := range mgr.recordOrd {
+		rec := mgr.records[name]
+		mpl, err := rec.mediaPlaylist()
+		if err != nil {
+			return err
+		}
+		plName := fmt.Sprintf(VOD_MEDIA_PLAYLIST, name)
+		if _, err := mgr.storageSession.SaveData(plName, mpl.Encode().Bytes()); err != nil {
+			return err
+		}
+		masterPL.Append(plName, mpl, ffmpeg.VideoProfileToVariantParams(rec.profile))
+	}
+	uri, err := mgr.storageSession.SaveData(VOD_MASTER_PLAYLIST, masterPL.Encode().Bytes())
+	if err != nil {
+		return err
+	}
+	glog.Infof("Saved recording manifestID=%s uri=%s", mgr.manifestID, uri)
+	return nil
+}
+
+func (rec *recording) mediaPlaylist() (*m3u8.MediaPlaylist, error) {
+	seqNos := make([]uint64, 0, len(rec.segments))
+	for seqNo := range rec.segments {
+		seqNos = append(seqNos, seqNo)
+	}
+	sort.Slice(seqNos, func(i, j int) bool { return seqNos[i] < seqNos[j] })
+
+	mpl, err := m3u8.NewMediaPlaylist(uint(len(seqNos)), uint(len(seqNos)))
+	if err != nil {
+		return nil, err
+	}
+	mpl.MediaType = m3u8.VOD
+	mpl.Live = false
+	for _, seqNo := range seqNos {
+		if err := mpl.InsertSegment(seqNo, rec.segments[seqNo]); err != nil {
+			return nil, err
+		}
+	}
+	mpl.SeqNo = seqNos[0]
+	return mpl, nil
+}
+
 func newMediaSegment(uri string, duration float64) *m3u8.MediaSegment {
 	return &m3u8.MediaSegment{
 		URI:      uri,
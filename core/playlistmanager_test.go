@@ -2,7 +2,11 @@ package core
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/livepeer/go-livepeer/drivers"
@@ -186,3 +190,93 @@ func TestCleanup(t *testing.T) {
 		t.Fatal("Data should be cleaned up")
 	}
 }
+
+func TestRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	osd, err := drivers.NewFSDriver(nil, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := RandomManifestID()
+	c := NewRecordingPlaylistManager(mid, osd.NewSession(string(mid)))
+	src := &ffmpeg.VideoProfile{Name: "source", Resolution: "1280x720", Bitrate: "4000k"}
+	vProfile := &ffmpeg.P144p30fps16x9
+
+	// Insert more segments than the live window holds, somewhat out of order
+	total := int(LIVE_LIST_LENGTH) * 2
+	for i := total - 1; i >= 0; i-- {
+		seqNo := uint64(i)
+		if err := c.InsertHLSSegment(src, seqNo, fmt.Sprintf("/stream/%s/source/%d.ts", mid, i), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < total; i++ {
+		seqNo := uint64(i)
+		if err := c.InsertHLSSegment(vProfile, seqNo, fmt.Sprintf("/stream/%s/%s/%d.ts", mid, vProfile.Name, i), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Duplicates are ignored
+	c.InsertHLSSegment(vProfile, 0, "dup", 2)
+
+	// Live playlist remains a sliding window
+	if cnt := c.GetHLSMediaPlaylist(vProfile.Name).Count(); cnt != LIVE_LIST_LENGTH {
+		t.Errorf("Expected %d segments in live playlist, got %d", LIVE_LIST_LENGTH, cnt)
+	}
+
+	c.Cleanup()
+
+	// Media playlists contain every segment and are terminated
+	for _, p := range []*ffmpeg.VideoProfile{src, vProfile} {
+		data := osd.GetData(fmt.Sprintf("%s/%s.m3u8", mid, p.Name))
+		if data == nil {
+			t.Fatalf("Missing media playlist for %s", p.Name)
+		}
+		mpl, err := m3u8.NewMediaPlaylist(uint(total), uint(total))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mpl.Decode(*bytes.NewBuffer(data), true); err != nil {
+			t.Fatal(err)
+		}
+		if mpl.Count() != uint(total) || mpl.Live || mpl.MediaType != m3u8.VOD {
+			t.Errorf("Unexpected playlist properties for %s: %s", p.Name, data)
+		}
+		for i := 0; i < total; i++ {
+			expected := fmt.Sprintf("/stream/%s/%s/%d.ts", mid, p.Name, i)
+			if mpl.Segments[i].URI != expected {
+				t.Errorf("Expected %s, got %s", expected, mpl.Segments[i].URI)
+			}
+		}
+		if !strings.HasSuffix(string(data), "#EXT-X-ENDLIST\n") {
+			t.Errorf("Expected ENDLIST in %s", data)
+		}
+	}
+
+	// Master playlist references the media playlists
+	data := osd.GetData(fmt.Sprintf("%s/index.m3u8", mid))
+	master := m3u8.NewMasterPlaylist()
+	if err := master.Decode(*bytes.NewBuffer(data), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(master.Variants) != 2 || master.Variants[0].URI != "source.m3u8" || master.Variants[1].URI != vProfile.Name+".m3u8" {
+		t.Errorf("Unexpected master playlist %s", data)
+	}
+	if master.Variants[1].Resolution != vProfile.Resolution {
+		t.Errorf("Expected resolution %s, got %s", vProfile.Resolution, master.Variants[1].Resolution)
+	}
+
+	// No recording without segments, and none for a non recording manager
+	c = NewRecordingPlaylistManager(mid, osd.NewSession("empty"))
+	c.Cleanup()
+	c = NewBasicPlaylistManager(mid, osd.NewSession("live"))
+	c.InsertHLSSegment(vProfile, 1, "abc", 2)
+	c.Cleanup()
+	if osd.GetData("empty/index.m3u8") != nil || osd.GetData("live/index.m3u8") != nil {
+		t.Error("Unexpected recording")
+	}
+}
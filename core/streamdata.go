@@ -26,6 +26,8 @@ type SegTranscodingMetadata struct {
 	Hash       ethcommon.Hash
 	Profiles   []ffmpeg.VideoProfile
 	OS         *net.OSInfo
+	// Return the profiles that transcoded even if others failed
+	PartialResults bool
 }
 
 func (md *SegTranscodingMetadata) Flatten() []byte {
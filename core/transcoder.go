@@ -12,11 +12,37 @@ import (
 
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/ffmpeg"
 
 	"github.com/golang/glog"
 )
 
+// CodecH264 is the output codec of transcoded segments
+const CodecH264 = "H264"
+
+// NewTranscoderCapabilities describes what a standalone transcoder can do.
+// maxResolution is formatted as WIDTHxHEIGHT, or empty for no limit. An empty
+// list of profile names means any profile is accepted.
+func NewTranscoderCapabilities(nvidia bool, maxResolution string, profiles []string) (*net.TranscoderCapabilities, error) {
+	caps := &net.TranscoderCapabilities{
+		Codecs:       []string{CodecH264},
+		Acceleration: "software",
+		Profiles:     profiles,
+	}
+	if nvidia {
+		caps.Acceleration = "nvidia"
+	}
+	if maxResolution != "" {
+		var w, h uint32
+		if _, err := fmt.Sscanf(maxResolution, "%dx%d", &w, &h); err != nil || w == 0 || h == 0 {
+			return nil, fmt.Errorf("invalid resolution %q", maxResolution)
+		}
+		caps.MaxWidth, caps.MaxHeight = w, h
+	}
+	return caps, nil
+}
+
 type Transcoder interface {
 	Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error)
 }
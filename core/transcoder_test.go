@@ -199,6 +199,30 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 	}
 }
 
+func TestNewTranscoderCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	caps, err := NewTranscoderCapabilities(false, "", nil)
+	assert.Nil(err)
+	assert.Equal([]string{CodecH264}, caps.Codecs)
+	assert.Equal("software", caps.Acceleration)
+	assert.Zero(caps.MaxWidth)
+	assert.Zero(caps.MaxHeight)
+	assert.Empty(caps.Profiles)
+
+	caps, err = NewTranscoderCapabilities(true, "1920x1080", []string{"P720p30fps16x9"})
+	assert.Nil(err)
+	assert.Equal("nvidia", caps.Acceleration)
+	assert.Equal(uint32(1920), caps.MaxWidth)
+	assert.Equal(uint32(1080), caps.MaxHeight)
+	assert.Equal([]string{"P720p30fps16x9"}, caps.Profiles)
+
+	for _, res := range []string{"1080p", "0x1080", "x"} {
+		_, err = NewTranscoderCapabilities(false, res, nil)
+		assert.NotNil(err, res)
+	}
+}
+
 func TestAudioCopy(t *testing.T) {
 	assert := assert.New(t)
 	dir, _ := ioutil.TempDir("", "")
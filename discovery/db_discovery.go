@@ -72,10 +72,10 @@ func NewDBOrchestratorPoolCache(ctx context.Context, node *core.LivepeerNode, rm
 	return dbo, nil
 }
 
-func (dbo *DBOrchestratorPoolCache) getURLs() ([]*url.URL, error) {
+func (dbo *DBOrchestratorPoolCache) getURLs(maxPrice *big.Rat) ([]*url.URL, error) {
 	orchs, err := dbo.store.SelectOrchs(
 		&common.DBOrchFilter{
-			MaxPrice:     server.BroadcastCfg.MaxPrice(),
+			MaxPrice:     maxPrice,
 			CurrentRound: dbo.rm.LastInitializedRound(),
 		},
 	)
@@ -93,33 +93,27 @@ func (dbo *DBOrchestratorPoolCache) getURLs() ([]*url.URL, error) {
 }
 
 func (dbo *DBOrchestratorPoolCache) GetURLs() []*url.URL {
-	uris, _ := dbo.getURLs()
+	uris, _ := dbo.getURLs(server.BroadcastCfg.MaxPrice())
 	return uris
 }
 
-func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
-	uris, err := dbo.getURLs()
+func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int, maxPrice *big.Rat) ([]*net.OrchestratorInfo, error) {
+	if maxPrice == nil {
+		maxPrice = server.BroadcastCfg.MaxPrice()
+	}
+	uris, err := dbo.getURLs(maxPrice)
 	if err != nil || len(uris) <= 0 {
 		return nil, err
 	}
 
 	pred := func(info *net.OrchestratorInfo) bool {
-
-		if err := dbo.ticketParamsValidator.ValidateTicketParams(pmTicketParams(info.TicketParams)); err != nil {
-			return false
-		}
-
-		// check if O's price is below B's max price
-		price := server.BroadcastCfg.MaxPrice()
-		if price != nil {
-			return big.NewRat(info.PriceInfo.PricePerUnit, info.PriceInfo.PixelsPerUnit).Cmp(price) <= 0
-		}
-		return true
+		return dbo.ticketParamsValidator.ValidateTicketParams(pmTicketParams(info.TicketParams)) == nil
 	}
 
 	orchPool := NewOrchestratorPoolWithPred(dbo.bcast, uris, pred)
 
-	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators)
+	// Prices may have changed since they were cached, so check them again
+	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators, maxPrice)
 	if err != nil || len(orchInfos) <= 0 {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package discovery
 import (
 	"context"
 	"math"
+	"math/big"
 	"math/rand"
 	"net/url"
 	"sync"
@@ -53,7 +54,7 @@ func (o *orchestratorPool) GetURLs() []*url.URL {
 	return o.uris
 }
 
-func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+func (o *orchestratorPool) GetOrchestrators(numOrchestrators int, maxPrice *big.Rat) ([]*net.OrchestratorInfo, error) {
 	numAvailableOrchs := len(o.uris)
 	numOrchestrators = int(math.Min(float64(numAvailableOrchs), float64(numOrchestrators)))
 	ctx, cancel := context.WithTimeout(context.Background(), getOrchestratorsTimeoutLoop)
@@ -68,7 +69,7 @@ func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.Orches
 		respLock.Lock()
 		defer respLock.Unlock()
 		numResp++
-		if err == nil && (o.pred == nil || o.pred(info)) {
+		if err == nil && (o.pred == nil || o.pred(info)) && (maxPrice == nil || withinPrice(info, maxPrice)) {
 			orchInfos = append(orchInfos, info)
 			numSuccessResp++
 		}
@@ -111,3 +112,12 @@ func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.Orches
 func (o *orchestratorPool) Size() int {
 	return len(o.uris)
 }
+
+// withinPrice is whether the orchestrator charges no more than maxPrice
+func withinPrice(info *net.OrchestratorInfo, maxPrice *big.Rat) bool {
+	price := info.GetPriceInfo()
+	if price == nil || price.PixelsPerUnit <= 0 {
+		return false
+	}
+	return big.NewRat(price.PricePerUnit, price.PixelsPerUnit).Cmp(maxPrice) <= 0
+}
@@ -67,7 +67,7 @@ func TestDeadLock(t *testing.T) {
 	uris := stringsToURIs(addresses)
 	assert := assert.New(t)
 	pool := NewOrchestratorPool(nil, uris)
-	infos, err := pool.GetOrchestrators(1)
+	infos, err := pool.GetOrchestrators(1, nil)
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 1, "Should return one orchestrator")
 	assert.Equal("transcoderfromtestserver", infos[0].Transcoder)
@@ -109,7 +109,7 @@ func TestDeadLock_NewOrchestratorPoolWithPred(t *testing.T) {
 	}
 
 	pool := NewOrchestratorPoolWithPred(nil, uris, pred)
-	infos, err := pool.GetOrchestrators(1)
+	infos, err := pool.GetOrchestrators(1, nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 1, "Should return one orchestrator")
@@ -225,7 +225,7 @@ func TestNewDBOrchestratorPoolCache_GivenListOfOrchs_CreatesPoolCacheCorrectly(t
 	pool, err := NewDBOrchestratorPoolCache(ctx, node, &stubRoundsManager{})
 	require.NoError(err)
 	assert.Equal(pool.Size(), 3)
-	orchs, err := pool.GetOrchestrators(pool.Size())
+	orchs, err := pool.GetOrchestrators(pool.Size(), nil)
 	for _, o := range orchs {
 		assert.Equal(o.PriceInfo, expPriceInfo)
 		assert.Equal(o.Transcoder, expTranscoder)
@@ -480,6 +480,30 @@ func TestNewOrchestratorPoolWithPred_TestPredicate(t *testing.T) {
 	assert.False(t, pool.pred(oInfo))
 }
 
+func TestOrchestratorPool_GetOrchestrators_MaxPrice(t *testing.T) {
+	assert := assert.New(t)
+	serverGetOrchInfo = func(ctx context.Context, bcast common.Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
+		if orchestratorServer.Port() == "8936" {
+			return &net.OrchestratorInfo{Transcoder: "cheap", PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}}, nil
+		}
+		if orchestratorServer.Port() == "8937" {
+			return &net.OrchestratorInfo{Transcoder: "unpriced"}, nil
+		}
+		return &net.OrchestratorInfo{Transcoder: "expensive", PriceInfo: &net.PriceInfo{PricePerUnit: 5, PixelsPerUnit: 1}}, nil
+	}
+	pool := NewOrchestratorPool(nil, stringsToURIs([]string{"https://127.0.0.1:8936", "https://127.0.0.1:8937", "https://127.0.0.1:8938"}))
+
+	infos, err := pool.GetOrchestrators(3, nil)
+	assert.Nil(err)
+	assert.Len(infos, 3)
+
+	infos, err = pool.GetOrchestrators(3, big.NewRat(2, 1))
+	assert.Nil(err)
+	if assert.Len(infos, 1) {
+		assert.Equal("cheap", infos[0].Transcoder)
+	}
+}
+
 func TestCachedPool_AllOrchestratorsTooExpensive_ReturnsEmptyList(t *testing.T) {
 	// Test setup
 	expPriceInfo := &net.PriceInfo{
@@ -564,7 +588,7 @@ func TestCachedPool_AllOrchestratorsTooExpensive_ReturnsEmptyList(t *testing.T)
 
 	urls := pool.GetURLs()
 	assert.Len(urls, 0)
-	infos, err := pool.GetOrchestrators(len(addresses))
+	infos, err := pool.GetOrchestrators(len(addresses), nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 0)
@@ -658,7 +682,7 @@ func TestCachedPool_GetOrchestrators_MaxBroadcastPriceNotSet(t *testing.T) {
 	for _, url := range urls {
 		assert.Contains(addresses, url.String())
 	}
-	infos, err := pool.GetOrchestrators(50)
+	infos, err := pool.GetOrchestrators(50, nil)
 	for _, info := range infos {
 		assert.Equal(info.PriceInfo, expPriceInfo)
 		assert.Equal(info.Transcoder, expTranscoder)
@@ -771,13 +795,18 @@ func TestCachedPool_N_OrchestratorsGoodPricing_ReturnsNOrchestrators(t *testing.
 		assert.Contains(addresses[25:], url.String())
 	}
 
-	infos, err := pool.GetOrchestrators(len(orchestrators))
+	infos, err := pool.GetOrchestrators(len(orchestrators), nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 25)
 	for _, info := range infos {
 		assert.Equal(info.Transcoder, "goodPriceTranscoder")
 	}
+
+	// A stream's max price takes the place of the broadcaster's
+	infos, err = pool.GetOrchestrators(len(orchestrators), big.NewRat(1, 2))
+	assert.Nil(err)
+	assert.Len(infos, 0)
 }
 
 func TestCachedPool_GetOrchestrators_TicketParamsValidation(t *testing.T) {
@@ -834,7 +863,7 @@ func TestCachedPool_GetOrchestrators_TicketParamsValidation(t *testing.T) {
 	sender.On("ValidateTicketParams", mock.Anything).Return(errors.New("ValidateTicketParams error")).Times(25)
 	sender.On("ValidateTicketParams", mock.Anything).Return(nil).Times(25)
 
-	infos, err := pool.GetOrchestrators(len(addresses))
+	infos, err := pool.GetOrchestrators(len(addresses), nil)
 	assert.Nil(err)
 	assert.Len(infos, 25)
 	sender.AssertNumberOfCalls(t, "ValidateTicketParams", 50)
@@ -842,7 +871,7 @@ func TestCachedPool_GetOrchestrators_TicketParamsValidation(t *testing.T) {
 	// Test 0 out of 50 orchs pass ticket params validation
 	sender.On("ValidateTicketParams", mock.Anything).Return(errors.New("ValidateTicketParams error")).Times(50)
 
-	infos, err = pool.GetOrchestrators(len(addresses))
+	infos, err = pool.GetOrchestrators(len(addresses), nil)
 	assert.Nil(err)
 	assert.Len(infos, 0)
 	sender.AssertNumberOfCalls(t, "ValidateTicketParams", 100)
@@ -941,7 +970,7 @@ func TestCachedPool_GetOrchestrators_OnlyActiveOrchestrators(t *testing.T) {
 	for _, url := range urls {
 		assert.Contains(addresses[:25], url.String())
 	}
-	infos, err := pool.GetOrchestrators(50)
+	infos, err := pool.GetOrchestrators(50, nil)
 	for _, info := range infos {
 		assert.Equal(info.PriceInfo, expPriceInfo)
 		assert.Equal(info.Transcoder, expTranscoder)
@@ -979,7 +1008,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 
 	// assert that list is not refreshed if lastRequest is less than 1 min ago and hash is the same
 	lastReq := whpool.lastRequest
-	orchInfo, err := whpool.GetOrchestrators(2)
+	orchInfo, err := whpool.GetOrchestrators(2, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -995,7 +1024,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is not refreshed if lastRequest is more than 1 min ago and hash is the same
 	lastReq = time.Now().Add(-2 * time.Minute)
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -1015,7 +1044,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is not refreshed if lastRequest is less than 1 min ago and hash is not the same
 	lastReq = time.Now()
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -1032,7 +1061,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is refreshed if lastRequest is longer than 1 min ago and hash is not the same
 	lastReq = time.Now().Add(-2 * time.Minute)
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
@@ -49,6 +50,15 @@ func IsOwnExternal(uri string) bool {
 	return IsOwnStorageS3(uri) || IsOwnStorageGS(uri)
 }
 
+// IsSessionStorage returns true if uri points into the external storage of sess
+func IsSessionStorage(sess OSSession, uri string) bool {
+	if sess == nil || !sess.IsExternal() {
+		return false
+	}
+	info := sess.GetInfo()
+	return info != nil && info.S3Info != nil && strings.HasPrefix(uri, info.S3Info.Host+"/")
+}
+
 func GetSegmentData(uri string) ([]byte, error) {
 	return getSegmentDataHTTP(uri)
 }
@@ -0,0 +1,19 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSessionStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	sess := NewS3Driver("us-east-1", "customer", "key", "secret").NewSession("foo")
+	assert.True(IsSessionStorage(sess, "https://customer.s3.amazonaws.com/foo/P144p30fps16x9/1.ts"))
+	assert.False(IsSessionStorage(sess, "https://customer.s3.amazonaws.com.example/foo/1.ts"))
+	assert.False(IsSessionStorage(sess, "https://other.s3.amazonaws.com/foo/1.ts"))
+
+	assert.False(IsSessionStorage(NewMemoryDriver(nil).NewSession("foo"), "/stream/foo/1.ts"))
+	assert.False(IsSessionStorage(nil, "https://customer.s3.amazonaws.com/foo/1.ts"))
+}
@@ -0,0 +1,204 @@
+package drivers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// How often to check for expired data; capped at the retention period
+var fsCleanupInterval = 1 * time.Minute
+
+// FSOS local filesystem backed object storage driver. Data is written under
+// dir using the same layout as the URIs handed out by SaveData. Unlike the
+// memory driver, data outlives its session; anything older than the retention
+// period is removed by the cleanup loop. A zero retention keeps data forever.
+type FSOS struct {
+	baseURI   *url.URL
+	dir       string
+	retention time.Duration
+	quit      chan struct{}
+}
+
+type FSSession struct {
+	os    *FSOS
+	path  string
+	ended bool
+	lock  sync.RWMutex
+}
+
+// NewFSDriver creates the storage directory if necessary and returns a driver writing into it
+func NewFSDriver(baseURI *url.URL, dir string, retention time.Duration) (*FSOS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSOS{
+		baseURI:   baseURI,
+		dir:       dir,
+		retention: retention,
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+func (ostore *FSOS) NewSession(path string) OSSession {
+	return &FSSession{
+		os:   ostore,
+		path: path,
+	}
+}
+
+// GetData returns the stored data for a name, or nil if there is none.
+//
+// The name follows the same rules as MemorySession.GetData: it may be an
+// absolute URI prefixed by the base URI, or a relative URI with or without
+// the leading /stream/
+func (ostore *FSOS) GetData(name string) []byte {
+	prefix := ""
+	if ostore.baseURI != nil {
+		prefix += ostore.baseURI.String()
+	}
+	prefix += "/stream/"
+	name = strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/stream/")
+
+	data, err := ioutil.ReadFile(ostore.filePath(name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Error reading data name=%s err=%v", name, err)
+		}
+		return nil
+	}
+	return data
+}
+
+// filePath maps a name onto the storage directory. Cleaning the name as an
+// absolute path keeps it from escaping the directory.
+func (ostore *FSOS) filePath(name string) string {
+	return filepath.Join(ostore.dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// StartCleanup periodically removes data older than the retention period.
+// Returns immediately if there is no retention period. Blocks otherwise.
+func (ostore *FSOS) StartCleanup() {
+	if ostore.retention <= 0 {
+		return
+	}
+	interval := fsCleanupInterval
+	if ostore.retention < interval {
+		interval = ostore.retention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ostore.cleanup()
+		case <-ostore.quit:
+			return
+		}
+	}
+}
+
+// StopCleanup stops the cleanup loop
+func (ostore *FSOS) StopCleanup() {
+	close(ostore.quit)
+}
+
+func (ostore *FSOS) cleanup() {
+	expiry := time.Now().Add(-ostore.retention)
+	var dirs []string
+	err := filepath.Walk(ostore.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// file may have been removed from under us; carry on
+			return nil
+		}
+		if info.IsDir() {
+			if p != ostore.dir {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+		if info.ModTime().Before(expiry) {
+			if err := os.Remove(p); err != nil {
+				glog.Errorf("Error removing expired data file=%s err=%v", p, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Errorf("Error cleaning up storage dir=%s err=%v", ostore.dir, err)
+	}
+	// Remove emptied directories, deepest first. Non-empty ones fail to remove.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		os.Remove(d)
+	}
+}
+
+// EndSession stops further writes; stored data is left for the cleanup loop
+func (ostore *FSSession) EndSession() {
+	ostore.lock.Lock()
+	ostore.ended = true
+	ostore.lock.Unlock()
+}
+
+// GetData returns the stored data for a name; see FSOS.GetData
+func (ostore *FSSession) GetData(name string) []byte {
+	return ostore.os.GetData(name)
+}
+
+func (ostore *FSSession) IsExternal() bool {
+	return false
+}
+
+func (ostore *FSSession) GetInfo() *net.OSInfo {
+	return nil
+}
+
+func (ostore *FSSession) SaveData(name string, data []byte) (string, error) {
+	ostore.lock.RLock()
+	defer ostore.lock.RUnlock()
+
+	if ostore.ended {
+		return "", fmt.Errorf("Session ended")
+	}
+
+	fname := ostore.os.filePath(ostore.getAbsolutePath(name))
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temp file first so readers never see partial data
+	tmpName := fname + "." + common.RandName() + ".tmp"
+	if err := ioutil.WriteFile(tmpName, data, 0644); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+	if err := os.Rename(tmpName, fname); err != nil {
+		os.Remove(tmpName)
+		return "", err
+	}
+
+	return ostore.getAbsoluteURI(name), nil
+}
+
+func (ostore *FSSession) getAbsolutePath(name string) string {
+	return path.Clean(ostore.path + "/" + name)
+}
+
+func (ostore *FSSession) getAbsoluteURI(name string) string {
+	name = "/stream/" + ostore.getAbsolutePath(name)
+	if ostore.os.baseURI != nil {
+		return ostore.os.baseURI.String() + name
+	}
+	return name
+}
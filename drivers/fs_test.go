@@ -0,0 +1,120 @@
+package drivers
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSOS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("fake.com/url")
+	require.Nil(err)
+	fsos, err := NewFSDriver(u, dir, 0)
+	require.Nil(err)
+	sess := fsos.NewSession("sesspath").(*FSSession)
+
+	path, err := sess.SaveData("name1/1.ts", []byte("data1"))
+	assert.Nil(err)
+	assert.Equal("fake.com/url/stream/sesspath/name1/1.ts", path)
+	onDisk, err := ioutil.ReadFile(filepath.Join(dir, "sesspath", "name1", "1.ts"))
+	assert.Nil(err)
+	assert.Equal("data1", string(onDisk))
+
+	// Lookups with and without the prefix
+	assert.Equal("data1", string(sess.GetData(path)))
+	assert.Equal("data1", string(sess.GetData("/stream/sesspath/name1/1.ts")))
+	assert.Equal("data1", string(fsos.GetData("sesspath/name1/1.ts")))
+
+	// Overwrite
+	_, err = sess.SaveData("name1/1.ts", []byte("data2"))
+	assert.Nil(err)
+	assert.Equal("data2", string(sess.GetData("sesspath/name1/1.ts")))
+
+	// Nonexistent data
+	assert.Nil(sess.GetData("sesspath/name1/2.ts"))
+
+	// Paths can't escape the storage dir
+	assert.Equal(filepath.Join(dir, "etc", "passwd"), fsos.filePath("../../etc/passwd"))
+
+	// Data is still available after the session ends, but writes are rejected
+	sess.EndSession()
+	assert.Equal("data2", string(fsos.GetData("sesspath/name1/1.ts")))
+	_, err = sess.SaveData("name1/2.ts", []byte("data3"))
+	assert.EqualError(err, "Session ended")
+
+	// No base URI
+	fsos, err = NewFSDriver(nil, dir, 0)
+	require.Nil(err)
+	path, err = fsos.NewSession("sesspath").SaveData("name1/3.ts", []byte("data4"))
+	assert.Nil(err)
+	assert.Equal("/stream/sesspath/name1/3.ts", path)
+	assert.Equal("data4", string(fsos.GetData(path)))
+
+	// No stray temp files left behind
+	files, err := ioutil.ReadDir(filepath.Join(dir, "sesspath", "name1"))
+	require.Nil(err)
+	assert.Len(files, 2)
+}
+
+func TestFSOS_Cleanup(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	fsos, err := NewFSDriver(nil, dir, time.Hour)
+	require.Nil(err)
+	sess := fsos.NewSession("sesspath")
+	_, err = sess.SaveData("old/1.ts", []byte("old"))
+	require.Nil(err)
+	_, err = sess.SaveData("new/1.ts", []byte("new"))
+	require.Nil(err)
+
+	old := time.Now().Add(-2 * time.Hour)
+	require.Nil(os.Chtimes(filepath.Join(dir, "sesspath", "old", "1.ts"), old, old))
+
+	fsos.cleanup()
+	assert.Nil(fsos.GetData("sesspath/old/1.ts"))
+	assert.Equal("new", string(fsos.GetData("sesspath/new/1.ts")))
+	// Emptied directories are removed; the root is kept
+	_, err = os.Stat(filepath.Join(dir, "sesspath", "old"))
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(dir)
+	assert.Nil(err)
+
+	// Cleanup loop stops
+	oldInterval := fsCleanupInterval
+	fsCleanupInterval = time.Millisecond
+	defer func() { fsCleanupInterval = oldInterval }()
+	done := make(chan struct{})
+	go func() {
+		fsos.StartCleanup()
+		close(done)
+	}()
+	fsos.StopCleanup()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("cleanup loop did not stop")
+	}
+
+	// Zero retention returns immediately
+	fsos, err = NewFSDriver(nil, dir, 0)
+	require.Nil(err)
+	fsos.StartCleanup()
+}
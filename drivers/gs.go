@@ -73,18 +73,23 @@ func gsParseKey(key []byte) (*rsa.PrivateKey, error) {
 }
 
 func NewGoogleDriver(bucket, keyFileName string) (OSDriver, error) {
+	rawFile, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewGoogleDriverWithKey(bucket, rawFile)
+}
+
+// NewGoogleDriverWithKey takes the contents of the JSON key file
+func NewGoogleDriverWithKey(bucket string, key []byte) (OSDriver, error) {
 	os := &gsOS{
 		s3OS: s3OS{
 			host:   gsHost(bucket),
 			bucket: bucket,
 		},
 	}
-	rawFile, err := ioutil.ReadFile(keyFileName)
-	if err != nil {
-		return nil, err
-	}
 	var gsKey gsKeyJSON
-	if err := json.Unmarshal(rawFile, &gsKey); err != nil {
+	if err := json.Unmarshal(key, &gsKey); err != nil {
 		return nil, err
 	}
 	parsedKey, err := gsParseKey([]byte(gsKey.PrivateKey))
@@ -21,6 +21,7 @@ import (
 type (
 	SegmentUploadError    string
 	SegmentTranscodeError string
+	AuthWebhookDenial     string
 )
 
 const (
@@ -42,6 +43,15 @@ const (
 	SegmentTranscodeErrorSaveData           SegmentTranscodeError = "SaveData"
 	SegmentTranscodeErrorSessionEnded       SegmentTranscodeError = "SessionEnded"
 	SegmentTranscodeErrorPlaylist           SegmentTranscodeError = "Playlist"
+	SegmentTranscodeErrorMaxAttempts        SegmentTranscodeError = "MaxAttempts"
+	SegmentTranscodeErrorDeadlineExceeded   SegmentTranscodeError = "DeadlineExceeded"
+	SegmentTranscodeErrorPartial            SegmentTranscodeError = "Partial"
+	SegmentTranscodeErrorSigCheck           SegmentTranscodeError = "SigCheck"
+
+	AuthWebhookDenialStatus          AuthWebhookDenial = "Status"
+	AuthWebhookDenialInvalidResponse AuthWebhookDenial = "InvalidResponse"
+	AuthWebhookDenialUnavailable     AuthWebhookDenial = "Unavailable"
+	AuthWebhookDenialStreamOptions   AuthWebhookDenial = "StreamOptions"
 
 	numberOfSegmentsToCalcAverage = 30
 	gweiConversionFactor          = 1000000000
@@ -67,6 +77,8 @@ type (
 		kSender                       tag.Key
 		kRecipient                    tag.Key
 		kManifestID                   tag.Key
+		kTranscoder                   tag.Key
+		kVerifier                     tag.Key
 		mSegmentSourceAppeared        *stats.Int64Measure
 		mSegmentEmerged               *stats.Int64Measure
 		mSegmentEmergedUnprocessed    *stats.Int64Measure
@@ -89,6 +101,14 @@ type (
 		mTranscodersNumber            *stats.Int64Measure
 		mTranscodersCapacity          *stats.Int64Measure
 		mTranscodersLoad              *stats.Int64Measure
+		mRemoteTranscoderCompleted    *stats.Int64Measure
+		mRemoteTranscoderFailed       *stats.Int64Measure
+		mRemoteTranscoderLoad         *stats.Int64Measure
+		mRemoteTranscoderTime         *stats.Float64Measure
+		mSegmentVerified              *stats.Int64Measure
+		mSegmentVerificationFailed    *stats.Int64Measure
+		mAuthWebhookTime              *stats.Float64Measure
+		mAuthWebhookDenied            *stats.Int64Measure
 		mSuccessRate                  *stats.Float64Measure
 		mTranscodeTime                *stats.Float64Measure
 		mTranscodeLatency             *stats.Float64Measure
@@ -164,6 +184,8 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.kSender = tag.MustNewKey("sender")
 	census.kRecipient = tag.MustNewKey("recipient")
 	census.kManifestID = tag.MustNewKey("manifestID")
+	census.kTranscoder = tag.MustNewKey("transcoder")
+	census.kVerifier = tag.MustNewKey("verifier")
 	census.ctx, err = tag.New(context.Background(), tag.Insert(census.kNodeType, nodeType), tag.Insert(census.kNodeID, nodeID))
 	if err != nil {
 		glog.Fatal("Error creating context", err)
@@ -190,6 +212,14 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.mTranscodersNumber = stats.Int64("transcoders_number", "Number of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersCapacity = stats.Int64("transcoders_capacity", "Total advertised capacity of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersLoad = stats.Int64("transcoders_load", "Total load of transcoders currently connected to orchestrator", "tot")
+	census.mRemoteTranscoderCompleted = stats.Int64("remote_transcoder_completed_total", "Number of segments transcoded by a remote transcoder", "tot")
+	census.mRemoteTranscoderFailed = stats.Int64("remote_transcoder_failed_total", "Number of segments a remote transcoder failed or timed out on", "tot")
+	census.mRemoteTranscoderLoad = stats.Int64("remote_transcoder_load", "Load of a remote transcoder", "tot")
+	census.mRemoteTranscoderTime = stats.Float64("remote_transcoder_transcode_time_seconds", "Time taken by a remote transcoder to transcode a segment", "sec")
+	census.mSegmentVerified = stats.Int64("segment_verified_total", "Number of transcoded segments that were verified", "tot")
+	census.mSegmentVerificationFailed = stats.Int64("segment_verification_failed_total", "Number of transcoded segments that failed verification", "tot")
+	census.mAuthWebhookTime = stats.Float64("auth_webhook_time_seconds", "Time taken by the auth webhook to respond", "sec")
+	census.mAuthWebhookDenied = stats.Int64("auth_webhook_denied_total", "Number of streams denied by the auth webhook", "tot")
 	census.mSuccessRate = stats.Float64("success_rate", "Success rate", "per")
 	census.mTranscodeTime = stats.Float64("transcode_time_seconds", "Transcoding time", "sec")
 	census.mTranscodeLatency = stats.Float64("transcode_latency_seconds",
@@ -427,6 +457,62 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     baseTags,
 			Aggregation: view.LastValue(),
 		},
+		&view.View{
+			Name:        "remote_transcoder_completed_total",
+			Measure:     census.mRemoteTranscoderCompleted,
+			Description: "Number of segments transcoded by a remote transcoder",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "remote_transcoder_failed_total",
+			Measure:     census.mRemoteTranscoderFailed,
+			Description: "Number of segments a remote transcoder failed or timed out on",
+			TagKeys:     append([]tag.Key{census.kTranscoder, census.kErrorCode}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "remote_transcoder_load",
+			Measure:     census.mRemoteTranscoderLoad,
+			Description: "Load of a remote transcoder",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "remote_transcoder_transcode_time_seconds",
+			Measure:     census.mRemoteTranscoderTime,
+			Description: "Time taken by a remote transcoder to transcode a segment",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Distribution(0, .250, .500, .750, 1.000, 1.250, 1.500, 2.000, 2.500, 3.000, 3.500, 4.000, 4.500, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "segment_verified_total",
+			Measure:     census.mSegmentVerified,
+			Description: "Number of transcoded segments that were verified",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "segment_verification_failed_total",
+			Measure:     census.mSegmentVerificationFailed,
+			Description: "Number of transcoded segments that failed verification",
+			TagKeys:     append([]tag.Key{census.kVerifier}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "auth_webhook_time_seconds",
+			Measure:     census.mAuthWebhookTime,
+			Description: "Time taken by the auth webhook to respond",
+			TagKeys:     baseTags,
+			Aggregation: view.Distribution(0, .050, .100, .250, .500, .750, 1.000, 2.000, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "auth_webhook_denied_total",
+			Measure:     census.mAuthWebhookDenied,
+			Description: "Number of streams denied by the auth webhook",
+			TagKeys:     append([]tag.Key{census.kErrorCode}, baseTags...),
+			Aggregation: view.Sum(),
+		},
 
 		// Metrics for sending payments
 		&view.View{
@@ -763,6 +849,60 @@ func SetTranscodersNumberAndLoad(load, capacity, number int) {
 	stats.Record(census.ctx, census.mTranscodersNumber.M(int64(number)))
 }
 
+// RemoteTranscoderTaskDone records the outcome of a segment sent to a remote
+// transcoder, along with its load once the segment is done. errCode is empty
+// if the segment was transcoded.
+func RemoteTranscoderTaskDone(transcoder string, load int, took time.Duration, errCode string) {
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kTranscoder, transcoder))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, census.mRemoteTranscoderLoad.M(int64(load)))
+	if errCode != "" {
+		ctx, err = tag.New(ctx, tag.Insert(census.kErrorCode, errCode))
+		if err != nil {
+			glog.Error("Error creating context", err)
+			return
+		}
+		stats.Record(ctx, census.mRemoteTranscoderFailed.M(1))
+		return
+	}
+	stats.Record(ctx, census.mRemoteTranscoderCompleted.M(1), census.mRemoteTranscoderTime.M(took.Seconds()))
+}
+
+// SegmentVerified records the outcome of verifying a transcoded segment.
+// verifier is the check that failed, or empty if the segment passed.
+func SegmentVerified(nonce, seqNo uint64, verifier string) {
+	if verifier == "" {
+		stats.Record(census.ctx, census.mSegmentVerified.M(1))
+		return
+	}
+	glog.Errorf("Segment failed verification nonce=%d seqNo=%d verifier=%s", nonce, seqNo, verifier)
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kVerifier, verifier))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, census.mSegmentVerified.M(1), census.mSegmentVerificationFailed.M(1))
+}
+
+// AuthWebhookTime records how long a call to the auth webhook took
+func AuthWebhookTime(took time.Duration) {
+	stats.Record(census.ctx, census.mAuthWebhookTime.M(took.Seconds()))
+}
+
+// AuthWebhookDenied records a stream denied by the auth webhook, or because
+// the webhook couldn't be reached
+func AuthWebhookDenied(reason AuthWebhookDenial) {
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kErrorCode, string(reason)))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, census.mAuthWebhookDenied.M(1))
+}
+
 func SegmentEmerged(nonce, seqNo uint64, profilesNum int) {
 	glog.Infof("Logging SegmentEmerged... nonce=%d seqNo=%d", nonce, seqNo)
 	census.segmentEmerged(nonce, seqNo, profilesNum)
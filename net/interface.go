@@ -1,12 +1,25 @@
 package net
 
 import (
+	"time"
+
 	"github.com/livepeer/m3u8"
 )
 
 type RemoteTranscoderInfo struct {
-	Address  string
-	Capacity int
+	// ID of the connection, to disconnect it by
+	ID           string
+	Address      string
+	Capacity     int
+	Capabilities *TranscoderCapabilities `json:",omitempty"`
+	Name         string                  `json:",omitempty"`
+	Load         int
+	Completed    int
+	Failures     int
+	Timeouts     int
+	// average over completed segments, in seconds
+	AvgTranscodeTime float64
+	LastSeen         time.Time
 }
 
 type NodeStatus struct {
@@ -399,6 +399,84 @@ func (m *OrchestratorInfo) GetStorage() []*OSInfo {
 	return nil
 }
 
+// Parameters of a transcoding profile. Used for profiles that are not
+// among the presets known to every node.
+type VideoProfile struct {
+	// Name of the rendition
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Output resolution, as WIDTHxHEIGHT
+	Resolution string `protobuf:"bytes,2,opt,name=resolution,proto3" json:"resolution,omitempty"`
+	// Output bitrate, as accepted by ffmpeg (eg, 3000k)
+	Bitrate string `protobuf:"bytes,3,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	// Output framerate
+	Fps uint32 `protobuf:"varint,4,opt,name=fps,proto3" json:"fps,omitempty"`
+	// Output aspect ratio, eg 16:9. Optional.
+	AspectRatio          string   `protobuf:"bytes,5,opt,name=aspectRatio,proto3" json:"aspectRatio,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VideoProfile) Reset()         { *m = VideoProfile{} }
+func (m *VideoProfile) String() string { return proto.CompactTextString(m) }
+func (*VideoProfile) ProtoMessage()    {}
+func (*VideoProfile) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{6}
+}
+
+func (m *VideoProfile) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VideoProfile.Unmarshal(m, b)
+}
+func (m *VideoProfile) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VideoProfile.Marshal(b, m, deterministic)
+}
+func (m *VideoProfile) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VideoProfile.Merge(m, src)
+}
+func (m *VideoProfile) XXX_Size() int {
+	return xxx_messageInfo_VideoProfile.Size(m)
+}
+func (m *VideoProfile) XXX_DiscardUnknown() {
+	xxx_messageInfo_VideoProfile.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VideoProfile proto.InternalMessageInfo
+
+func (m *VideoProfile) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetResolution() string {
+	if m != nil {
+		return m.Resolution
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetBitrate() string {
+	if m != nil {
+		return m.Bitrate
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetFps() uint32 {
+	if m != nil {
+		return m.Fps
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetAspectRatio() string {
+	if m != nil {
+		return m.AspectRatio
+	}
+	return ""
+}
+
 // Data included by the broadcaster when submitting a segment for transcoding.
 type SegData struct {
 	// Manifest ID this segment belongs to
@@ -414,17 +492,23 @@ type SegData struct {
 	Sig []byte `protobuf:"bytes,5,opt,name=sig,proto3" json:"sig,omitempty"`
 	// Broadcaster's preferred storage medium(s)
 	// XXX should we include this in a sig somewhere until certs are authenticated?
-	Storage              []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+	Storage []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
+	// Full parameters of the transcoding profiles. Only set if some of the
+	// profiles are not presets; takes precedence over `profiles` if so.
+	FullProfiles []*VideoProfile `protobuf:"bytes,33,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
+	// Whether the broadcaster accepts results where only some of the profiles
+	// were transcoded. The failed profiles have their `error` field set.
+	PartialResults       bool     `protobuf:"varint,34,opt,name=partialResults,proto3" json:"partialResults,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *SegData) Reset()         { *m = SegData{} }
 func (m *SegData) String() string { return proto.CompactTextString(m) }
 func (*SegData) ProtoMessage()    {}
 func (*SegData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{6}
+	return fileDescriptor_034e29c79f9ba827, []int{7}
 }
 
 func (m *SegData) XXX_Unmarshal(b []byte) error {
@@ -487,12 +571,29 @@ func (m *SegData) GetStorage() []*OSInfo {
 	return nil
 }
 
+func (m *SegData) GetFullProfiles() []*VideoProfile {
+	if m != nil {
+		return m.FullProfiles
+	}
+	return nil
+}
+
+func (m *SegData) GetPartialResults() bool {
+	if m != nil {
+		return m.PartialResults
+	}
+	return false
+}
+
 // Individual transcoded segment data.
 type TranscodedSegmentData struct {
 	// URL where the transcoded data can be downloaded from.
 	Url string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
 	// Amount of pixels processed (output pixels)
-	Pixels               int64    `protobuf:"varint,2,opt,name=pixels,proto3" json:"pixels,omitempty"`
+	Pixels int64 `protobuf:"varint,2,opt,name=pixels,proto3" json:"pixels,omitempty"`
+	// Set if transcoding into this profile failed; there is no URL then.
+	// Only used if the broadcaster accepts partial results.
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -502,7 +603,7 @@ func (m *TranscodedSegmentData) Reset()         { *m = TranscodedSegmentData{} }
 func (m *TranscodedSegmentData) String() string { return proto.CompactTextString(m) }
 func (*TranscodedSegmentData) ProtoMessage()    {}
 func (*TranscodedSegmentData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{7}
+	return fileDescriptor_034e29c79f9ba827, []int{8}
 }
 
 func (m *TranscodedSegmentData) XXX_Unmarshal(b []byte) error {
@@ -537,11 +638,19 @@ func (m *TranscodedSegmentData) GetPixels() int64 {
 	return 0
 }
 
+func (m *TranscodedSegmentData) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
 // A set of transcoded segments following the profiles specified in the job.
 type TranscodeData struct {
 	// Transcoded data, in the order specified in the job options
 	Segments []*TranscodedSegmentData `protobuf:"bytes,1,rep,name=segments,proto3" json:"segments,omitempty"`
-	// Signature of the hash of the concatenated hashes
+	// Signature of the hash of the concatenated hashes. Failed profiles
+	// are left out.
 	Sig                  []byte   `protobuf:"bytes,2,opt,name=sig,proto3" json:"sig,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -552,7 +661,7 @@ func (m *TranscodeData) Reset()         { *m = TranscodeData{} }
 func (m *TranscodeData) String() string { return proto.CompactTextString(m) }
 func (*TranscodeData) ProtoMessage()    {}
 func (*TranscodeData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{8}
+	return fileDescriptor_034e29c79f9ba827, []int{9}
 }
 
 func (m *TranscodeData) XXX_Unmarshal(b []byte) error {
@@ -608,7 +717,7 @@ func (m *TranscodeResult) Reset()         { *m = TranscodeResult{} }
 func (m *TranscodeResult) String() string { return proto.CompactTextString(m) }
 func (*TranscodeResult) ProtoMessage()    {}
 func (*TranscodeResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{9}
+	return fileDescriptor_034e29c79f9ba827, []int{10}
 }
 
 func (m *TranscodeResult) XXX_Unmarshal(b []byte) error {
@@ -693,7 +802,12 @@ type RegisterRequest struct {
 	// Shared secret for auth
 	Secret string `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
 	// Transcoder capacity
-	Capacity             int64    `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Capacity int64 `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	// What the transcoder is able to do. Older transcoders don't send this
+	// and are assumed to handle any segment.
+	Capabilities *TranscoderCapabilities `protobuf:"bytes,3,opt,name=capabilities,proto3" json:"capabilities,omitempty"`
+	// Set if the transcoder answers pings. Older transcoders aren't pinged.
+	Heartbeat            bool     `protobuf:"varint,4,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -703,7 +817,7 @@ func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
 func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
 func (*RegisterRequest) ProtoMessage()    {}
 func (*RegisterRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{10}
+	return fileDescriptor_034e29c79f9ba827, []int{11}
 }
 
 func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
@@ -738,6 +852,146 @@ func (m *RegisterRequest) GetCapacity() int64 {
 	return 0
 }
 
+func (m *RegisterRequest) GetCapabilities() *TranscoderCapabilities {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+func (m *RegisterRequest) GetHeartbeat() bool {
+	if m != nil {
+		return m.Heartbeat
+	}
+	return false
+}
+
+// Sent by the transcoder in answer to a ping
+type PongRequest struct {
+	// Credentials the transcoder registered with
+	Secret string `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
+	// ID of the ping being answered
+	PingId               int64    `protobuf:"varint,2,opt,name=pingId,proto3" json:"pingId,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PongRequest) Reset()         { *m = PongRequest{} }
+func (m *PongRequest) String() string { return proto.CompactTextString(m) }
+func (*PongRequest) ProtoMessage()    {}
+func (*PongRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{12}
+}
+
+func (m *PongRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PongRequest.Unmarshal(m, b)
+}
+func (m *PongRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PongRequest.Marshal(b, m, deterministic)
+}
+func (m *PongRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PongRequest.Merge(m, src)
+}
+func (m *PongRequest) XXX_Size() int {
+	return xxx_messageInfo_PongRequest.Size(m)
+}
+func (m *PongRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PongRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PongRequest proto.InternalMessageInfo
+
+func (m *PongRequest) GetSecret() string {
+	if m != nil {
+		return m.Secret
+	}
+	return ""
+}
+
+func (m *PongRequest) GetPingId() int64 {
+	if m != nil {
+		return m.PingId
+	}
+	return 0
+}
+
+// Advertised by a transcoder when it registers with an orchestrator
+type TranscoderCapabilities struct {
+	// Output codecs the transcoder supports, eg H264. Empty if unknown.
+	Codecs []string `protobuf:"bytes,1,rep,name=codecs,proto3" json:"codecs,omitempty"`
+	// Hardware acceleration used for transcoding, eg software or nvidia
+	Acceleration string `protobuf:"bytes,2,opt,name=acceleration,proto3" json:"acceleration,omitempty"`
+	// Largest output resolution supported; zero for no limit
+	MaxWidth  uint32 `protobuf:"varint,3,opt,name=maxWidth,proto3" json:"maxWidth,omitempty"`
+	MaxHeight uint32 `protobuf:"varint,4,opt,name=maxHeight,proto3" json:"maxHeight,omitempty"`
+	// Names of the profiles the transcoder accepts; empty for any
+	Profiles             []string `protobuf:"bytes,5,rep,name=profiles,proto3" json:"profiles,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TranscoderCapabilities) Reset()         { *m = TranscoderCapabilities{} }
+func (m *TranscoderCapabilities) String() string { return proto.CompactTextString(m) }
+func (*TranscoderCapabilities) ProtoMessage()    {}
+func (*TranscoderCapabilities) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{13}
+}
+
+func (m *TranscoderCapabilities) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TranscoderCapabilities.Unmarshal(m, b)
+}
+func (m *TranscoderCapabilities) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TranscoderCapabilities.Marshal(b, m, deterministic)
+}
+func (m *TranscoderCapabilities) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TranscoderCapabilities.Merge(m, src)
+}
+func (m *TranscoderCapabilities) XXX_Size() int {
+	return xxx_messageInfo_TranscoderCapabilities.Size(m)
+}
+func (m *TranscoderCapabilities) XXX_DiscardUnknown() {
+	xxx_messageInfo_TranscoderCapabilities.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TranscoderCapabilities proto.InternalMessageInfo
+
+func (m *TranscoderCapabilities) GetCodecs() []string {
+	if m != nil {
+		return m.Codecs
+	}
+	return nil
+}
+
+func (m *TranscoderCapabilities) GetAcceleration() string {
+	if m != nil {
+		return m.Acceleration
+	}
+	return ""
+}
+
+func (m *TranscoderCapabilities) GetMaxWidth() uint32 {
+	if m != nil {
+		return m.MaxWidth
+	}
+	return 0
+}
+
+func (m *TranscoderCapabilities) GetMaxHeight() uint32 {
+	if m != nil {
+		return m.MaxHeight
+	}
+	return 0
+}
+
+func (m *TranscoderCapabilities) GetProfiles() []string {
+	if m != nil {
+		return m.Profiles
+	}
+	return nil
+}
+
 // Sent by the orchestrator to the transcoder
 type NotifySegment struct {
 	// URL of the segment to transcode.
@@ -746,18 +1000,26 @@ type NotifySegment struct {
 	Job string `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
 	// ID for this particular transcoding task.
 	TaskId int64 `protobuf:"varint,16,opt,name=taskId,proto3" json:"taskId,omitempty"`
+	// Non-zero if this is a ping rather than a segment. The transcoder
+	// answers with Pong.
+	PingId int64 `protobuf:"varint,3,opt,name=pingId,proto3" json:"pingId,omitempty"`
+	// URLs the following segments of the stream are expected at. The
+	// transcoder may fetch them ahead of time.
+	PrefetchUrls []string `protobuf:"bytes,4,rep,name=prefetchUrls,proto3" json:"prefetchUrls,omitempty"`
 	// Set of profiles to transcode this segment into.
-	Profiles             []byte   `protobuf:"bytes,17,opt,name=profiles,proto3" json:"profiles,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Profiles []byte `protobuf:"bytes,17,opt,name=profiles,proto3" json:"profiles,omitempty"`
+	// Full parameters of the profiles, if some of them are not presets.
+	FullProfiles         []*VideoProfile `protobuf:"bytes,33,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
 }
 
 func (m *NotifySegment) Reset()         { *m = NotifySegment{} }
 func (m *NotifySegment) String() string { return proto.CompactTextString(m) }
 func (*NotifySegment) ProtoMessage()    {}
 func (*NotifySegment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{11}
+	return fileDescriptor_034e29c79f9ba827, []int{14}
 }
 
 func (m *NotifySegment) XXX_Unmarshal(b []byte) error {
@@ -799,6 +1061,20 @@ func (m *NotifySegment) GetTaskId() int64 {
 	return 0
 }
 
+func (m *NotifySegment) GetPingId() int64 {
+	if m != nil {
+		return m.PingId
+	}
+	return 0
+}
+
+func (m *NotifySegment) GetPrefetchUrls() []string {
+	if m != nil {
+		return m.PrefetchUrls
+	}
+	return nil
+}
+
 func (m *NotifySegment) GetProfiles() []byte {
 	if m != nil {
 		return m.Profiles
@@ -806,6 +1082,13 @@ func (m *NotifySegment) GetProfiles() []byte {
 	return nil
 }
 
+func (m *NotifySegment) GetFullProfiles() []*VideoProfile {
+	if m != nil {
+		return m.FullProfiles
+	}
+	return nil
+}
+
 // Required parameters for probabilistic micropayment tickets
 type TicketParams struct {
 	// ETH address of the recipient
@@ -829,7 +1112,7 @@ func (m *TicketParams) Reset()         { *m = TicketParams{} }
 func (m *TicketParams) String() string { return proto.CompactTextString(m) }
 func (*TicketParams) ProtoMessage()    {}
 func (*TicketParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{12}
+	return fileDescriptor_034e29c79f9ba827, []int{15}
 }
 
 func (m *TicketParams) XXX_Unmarshal(b []byte) error {
@@ -901,7 +1184,7 @@ func (m *TicketSenderParams) Reset()         { *m = TicketSenderParams{} }
 func (m *TicketSenderParams) String() string { return proto.CompactTextString(m) }
 func (*TicketSenderParams) ProtoMessage()    {}
 func (*TicketSenderParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{13}
+	return fileDescriptor_034e29c79f9ba827, []int{16}
 }
 
 func (m *TicketSenderParams) XXX_Unmarshal(b []byte) error {
@@ -951,7 +1234,7 @@ func (m *TicketExpirationParams) Reset()         { *m = TicketExpirationParams{}
 func (m *TicketExpirationParams) String() string { return proto.CompactTextString(m) }
 func (*TicketExpirationParams) ProtoMessage()    {}
 func (*TicketExpirationParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{14}
+	return fileDescriptor_034e29c79f9ba827, []int{17}
 }
 
 func (m *TicketExpirationParams) XXX_Unmarshal(b []byte) error {
@@ -1009,7 +1292,7 @@ func (m *Payment) Reset()         { *m = Payment{} }
 func (m *Payment) String() string { return proto.CompactTextString(m) }
 func (*Payment) ProtoMessage()    {}
 func (*Payment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{15}
+	return fileDescriptor_034e29c79f9ba827, []int{18}
 }
 
 func (m *Payment) XXX_Unmarshal(b []byte) error {
@@ -1073,11 +1356,14 @@ func init() {
 	proto.RegisterType((*S3OSInfo)(nil), "net.S3OSInfo")
 	proto.RegisterType((*PriceInfo)(nil), "net.PriceInfo")
 	proto.RegisterType((*OrchestratorInfo)(nil), "net.OrchestratorInfo")
+	proto.RegisterType((*VideoProfile)(nil), "net.VideoProfile")
 	proto.RegisterType((*SegData)(nil), "net.SegData")
 	proto.RegisterType((*TranscodedSegmentData)(nil), "net.TranscodedSegmentData")
 	proto.RegisterType((*TranscodeData)(nil), "net.TranscodeData")
 	proto.RegisterType((*TranscodeResult)(nil), "net.TranscodeResult")
 	proto.RegisterType((*RegisterRequest)(nil), "net.RegisterRequest")
+	proto.RegisterType((*PongRequest)(nil), "net.PongRequest")
+	proto.RegisterType((*TranscoderCapabilities)(nil), "net.TranscoderCapabilities")
 	proto.RegisterType((*NotifySegment)(nil), "net.NotifySegment")
 	proto.RegisterType((*TicketParams)(nil), "net.TicketParams")
 	proto.RegisterType((*TicketSenderParams)(nil), "net.TicketSenderParams")
@@ -1088,72 +1374,88 @@ func init() {
 func init() { proto.RegisterFile("net/lp_rpc.proto", fileDescriptor_034e29c79f9ba827) }
 
 var fileDescriptor_034e29c79f9ba827 = []byte{
-	// 1025 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x5f, 0x4f, 0x1b, 0x47,
-	0x10, 0xcf, 0x61, 0x63, 0xec, 0xb1, 0x4d, 0xcc, 0x86, 0x10, 0x87, 0xb6, 0x11, 0x3d, 0x05, 0x89,
-	0x3e, 0x84, 0x56, 0x46, 0x8d, 0x94, 0xb7, 0x42, 0x41, 0x60, 0xa9, 0x02, 0x6b, 0x4d, 0x2a, 0xf5,
-	0xc9, 0x5a, 0xdf, 0x8d, 0xcd, 0x05, 0xb3, 0x77, 0xd9, 0x5d, 0x37, 0x38, 0xdf, 0xa4, 0x7d, 0xac,
-	0xda, 0x97, 0x7e, 0x8a, 0x7e, 0xb4, 0x6a, 0x67, 0xf7, 0x8e, 0x33, 0xf0, 0x90, 0xb7, 0x9d, 0xdf,
-	0xcc, 0xce, 0xce, 0x9f, 0xdf, 0xcc, 0x1d, 0x74, 0x24, 0x9a, 0xef, 0x67, 0xd9, 0x48, 0x65, 0xd1,
-	0x7e, 0xa6, 0x52, 0x93, 0xb2, 0x8a, 0x44, 0x13, 0xee, 0x40, 0x7d, 0x90, 0xc8, 0xe9, 0x20, 0x95,
-	0x53, 0xb6, 0x09, 0xab, 0xbf, 0x8b, 0xd9, 0x1c, 0xbb, 0xc1, 0x4e, 0xb0, 0xd7, 0xe2, 0x4e, 0x08,
-	0x0f, 0xe1, 0xd9, 0x85, 0x8a, 0xae, 0x50, 0x1b, 0x25, 0x4c, 0xaa, 0x38, 0x7e, 0x9c, 0xa3, 0x36,
-	0xac, 0x0b, 0x6b, 0x22, 0x8e, 0x15, 0x6a, 0xed, 0xcd, 0x73, 0x91, 0x75, 0xa0, 0xa2, 0x93, 0x69,
-	0x77, 0x85, 0x50, 0x7b, 0x0c, 0xff, 0x08, 0xa0, 0x76, 0x31, 0xec, 0xcb, 0x49, 0xca, 0xde, 0x41,
-	0x53, 0x9b, 0x54, 0x89, 0x29, 0x5e, 0x2e, 0x32, 0xf7, 0xd2, 0x7a, 0xef, 0xc5, 0xbe, 0x44, 0xb3,
-	0xef, 0x2c, 0xf6, 0x87, 0x77, 0x6a, 0x5e, 0xb6, 0x65, 0xbb, 0x50, 0xd3, 0x07, 0x89, 0x9c, 0xa4,
-	0xdd, 0xce, 0x4e, 0xb0, 0xd7, 0xec, 0xb5, 0xe9, 0xd6, 0xf0, 0xc0, 0xdd, 0xe3, 0x5e, 0x19, 0xbe,
-	0x81, 0x66, 0xc9, 0x05, 0x03, 0xa8, 0x1d, 0xf7, 0xf9, 0xc9, 0xcf, 0x97, 0x9d, 0x27, 0xac, 0x06,
-	0x2b, 0xc3, 0x83, 0x4e, 0x60, 0xb1, 0xd3, 0x8b, 0x8b, 0xd3, 0x5f, 0x4e, 0x3a, 0x2b, 0xe1, 0x5f,
-	0x01, 0xd4, 0x73, 0x1f, 0x8c, 0x41, 0xf5, 0x2a, 0xd5, 0x86, 0xc2, 0x6a, 0x70, 0x3a, 0xdb, 0x74,
-	0xae, 0x71, 0x41, 0xe9, 0x34, 0xb8, 0x3d, 0xb2, 0x2d, 0xa8, 0x65, 0xe9, 0x2c, 0x89, 0x16, 0xdd,
-	0x0a, 0x81, 0x5e, 0x62, 0x5f, 0x43, 0x43, 0x27, 0x53, 0x29, 0xcc, 0x5c, 0x61, 0xb7, 0x4a, 0xaa,
-	0x3b, 0x80, 0xbd, 0x02, 0x88, 0x14, 0xc6, 0x28, 0x4d, 0x22, 0x66, 0xdd, 0x55, 0x52, 0x97, 0x10,
-	0xb6, 0x0d, 0xf5, 0xdb, 0xc3, 0x9b, 0xcf, 0xc7, 0xc2, 0x60, 0xb7, 0x46, 0xda, 0x42, 0x0e, 0xdf,
-	0x43, 0x63, 0xa0, 0x92, 0x08, 0x29, 0xc8, 0x10, 0x5a, 0x99, 0x15, 0x06, 0xa8, 0xde, 0xcb, 0xc4,
-	0x05, 0x5b, 0xe1, 0x4b, 0x18, 0x7b, 0x0d, 0xed, 0x2c, 0xb9, 0xc5, 0x99, 0xce, 0x8d, 0x56, 0xc8,
-	0x68, 0x19, 0x0c, 0xff, 0x0b, 0xa0, 0x53, 0xee, 0x2d, 0xb9, 0x7f, 0x05, 0x60, 0x94, 0x90, 0x3a,
-	0x4a, 0x63, 0x54, 0xbe, 0x12, 0x25, 0x84, 0xbd, 0x85, 0xb6, 0x49, 0xa2, 0x6b, 0x34, 0xa3, 0x4c,
-	0x28, 0x71, 0xa3, 0xc9, 0x75, 0xb3, 0xb7, 0x41, 0xdd, 0xb8, 0x24, 0xcd, 0x80, 0x14, 0xbc, 0x65,
-	0x4a, 0x12, 0x7b, 0x03, 0x40, 0x21, 0x8e, 0xa8, 0x85, 0x15, 0xba, 0xb4, 0x4e, 0x97, 0x8a, 0xd4,
-	0x78, 0x23, 0x2b, 0xb2, 0xdc, 0x85, 0x35, 0xdf, 0xfc, 0xee, 0xce, 0x4e, 0x65, 0xaf, 0xd9, 0x6b,
-	0x96, 0x48, 0xc2, 0x73, 0x5d, 0xf8, 0x77, 0x00, 0x6b, 0x43, 0x9c, 0x1e, 0x0b, 0x23, 0x6c, 0xe4,
-	0x37, 0x42, 0x26, 0x13, 0xd4, 0xa6, 0x1f, 0x7b, 0x56, 0x96, 0x10, 0x22, 0x26, 0x7e, 0xf4, 0xa5,
-	0xb0, 0x47, 0xea, 0xb7, 0xd0, 0x57, 0x14, 0x4d, 0x8b, 0xd3, 0xd9, 0xf6, 0x21, 0x53, 0xe9, 0x24,
-	0x99, 0xa1, 0xa6, 0x26, 0xb6, 0x78, 0x21, 0xe7, 0xd4, 0x5e, 0x2d, 0xa8, 0xfd, 0xa5, 0x61, 0x1e,
-	0xc2, 0xf3, 0xcb, 0xbc, 0x84, 0xf1, 0x10, 0xa7, 0x37, 0x28, 0x0d, 0xc5, 0xdc, 0x81, 0xca, 0x5c,
-	0xcd, 0x7c, 0x99, 0xed, 0x91, 0xd8, 0x45, 0x5d, 0xf2, 0x81, 0x7a, 0x29, 0xfc, 0x0d, 0xda, 0x85,
-	0x0b, 0xba, 0xfa, 0x16, 0xea, 0xda, 0x79, 0xb2, 0x23, 0x68, 0xdf, 0xde, 0x76, 0x3d, 0x78, 0xec,
-	0x21, 0x5e, 0xd8, 0x3e, 0x32, 0x9f, 0x7f, 0x06, 0xf0, 0xb4, 0xb8, 0xc5, 0x51, 0xcf, 0x67, 0x26,
-	0x2f, 0x56, 0x70, 0x57, 0xac, 0x2d, 0x58, 0x45, 0xa5, 0x52, 0xe5, 0x46, 0xe1, 0xec, 0x09, 0x77,
-	0x22, 0xdb, 0x83, 0x6a, 0x2c, 0x8c, 0xf0, 0x2d, 0x65, 0xcb, 0x31, 0xd8, 0xb7, 0xcf, 0x9e, 0x70,
-	0xb2, 0x60, 0xdf, 0x41, 0xb5, 0x34, 0xbf, 0xcf, 0x5d, 0xa5, 0xee, 0xf1, 0x8f, 0x93, 0xc9, 0x51,
-	0x1d, 0x6a, 0x8a, 0x02, 0x09, 0x4f, 0xe0, 0x29, 0xc7, 0x69, 0xa2, 0x0d, 0x16, 0xbb, 0x67, 0x0b,
-	0x6a, 0x1a, 0x23, 0x85, 0xf9, 0xa0, 0x7a, 0xc9, 0xb6, 0x2e, 0x12, 0x99, 0x88, 0x12, 0xb3, 0xf0,
-	0xc5, 0x2b, 0xe4, 0x70, 0x0a, 0xed, 0xf3, 0xd4, 0x24, 0x93, 0x85, 0x2f, 0xca, 0x23, 0x95, 0xef,
-	0x40, 0xe5, 0x43, 0x3a, 0xce, 0x27, 0xfd, 0x43, 0x3a, 0xb6, 0x0f, 0x19, 0xa1, 0xaf, 0xfb, 0x31,
-	0x85, 0x5c, 0xe1, 0x5e, 0x5a, 0xe2, 0xc8, 0xc6, 0x32, 0x47, 0xc2, 0x7f, 0x03, 0x68, 0x95, 0xc7,
-	0xc0, 0xae, 0x05, 0x85, 0x51, 0x92, 0x25, 0x28, 0x8d, 0x67, 0xe5, 0x1d, 0xc0, 0xbe, 0x01, 0x98,
-	0x88, 0x08, 0x47, 0x6e, 0xf3, 0xba, 0xa6, 0x34, 0x2c, 0xf2, 0xab, 0x05, 0xd8, 0x4b, 0xa8, 0x7f,
-	0x4a, 0xe4, 0x28, 0x53, 0xe9, 0xd8, 0xb3, 0x74, 0xed, 0x53, 0x22, 0x07, 0x2a, 0x1d, 0xb3, 0x7d,
-	0x78, 0x56, 0xb8, 0x19, 0x29, 0x21, 0xe3, 0x11, 0x71, 0xd9, 0x71, 0x76, 0xa3, 0x50, 0x71, 0x21,
-	0xe3, 0x33, 0x4b, 0x6c, 0x06, 0x55, 0x8d, 0x18, 0x7b, 0xf6, 0xd2, 0x39, 0xec, 0x03, 0x73, 0xb1,
-	0x0e, 0x51, 0xc6, 0xa8, 0x7c, 0xc4, 0xdf, 0x42, 0x4b, 0x93, 0x3c, 0x92, 0xa9, 0x8c, 0xdc, 0x96,
-	0x6e, 0xf3, 0xa6, 0xc3, 0xce, 0x2d, 0xf4, 0x08, 0x89, 0x3e, 0xc3, 0x96, 0x73, 0x75, 0x72, 0x9b,
-	0x25, 0x4a, 0x98, 0x24, 0x95, 0xde, 0xdd, 0x2e, 0xac, 0x47, 0x0a, 0x09, 0x19, 0xa9, 0x74, 0x2e,
-	0x63, 0xcf, 0xaa, 0x76, 0x8e, 0x72, 0x0b, 0xb2, 0x77, 0xf0, 0x72, 0xd9, 0x6c, 0x34, 0x9e, 0xa5,
-	0xd1, 0xb5, 0xcb, 0xca, 0x3d, 0xb4, 0xb5, 0x74, 0xe3, 0xc8, 0xaa, 0x6d, 0x6a, 0xe1, 0x3f, 0x2b,
-	0xb0, 0x36, 0x10, 0x0b, 0xea, 0xeb, 0x83, 0xfd, 0x14, 0x7c, 0xd9, 0x7e, 0x22, 0x52, 0xd9, 0x04,
-	0xfd, 0x5b, 0x5e, 0x62, 0x67, 0xb0, 0x81, 0x45, 0x46, 0xb9, 0x4f, 0xc7, 0xf5, 0xaf, 0x4a, 0x3e,
-	0xef, 0x67, 0xcd, 0x3b, 0x78, 0xbf, 0x0e, 0x7d, 0xd8, 0xf4, 0x91, 0xf9, 0xea, 0x7a, 0x67, 0x55,
-	0x1a, 0xde, 0x17, 0x25, 0x67, 0xe5, 0x6e, 0x70, 0x66, 0x1e, 0x76, 0xe8, 0x47, 0x58, 0xc7, 0xdb,
-	0x0c, 0x23, 0x83, 0xf1, 0x88, 0x76, 0x26, 0x75, 0xf5, 0xe1, 0x42, 0x6d, 0xe7, 0x56, 0x04, 0xf5,
-	0x6e, 0xa1, 0x55, 0x9e, 0x37, 0x76, 0x04, 0x4f, 0x4f, 0xd1, 0x2c, 0x41, 0xdd, 0x07, 0x53, 0xe9,
-	0xa7, 0x6e, 0xfb, 0xf1, 0x79, 0x65, 0xaf, 0xa1, 0x6a, 0xff, 0x20, 0x98, 0xfb, 0x1c, 0xe7, 0x3f,
-	0x13, 0xdb, 0xcb, 0x62, 0xef, 0x1c, 0xe0, 0xf2, 0xee, 0x1b, 0xf2, 0x13, 0xb0, 0x7c, 0xa6, 0x4b,
-	0xe8, 0x26, 0x5d, 0xb9, 0x37, 0xec, 0xdb, 0x6e, 0xa1, 0x2c, 0xcd, 0xee, 0x0f, 0xc1, 0xb8, 0x46,
-	0xff, 0x30, 0x07, 0xff, 0x07, 0x00, 0x00, 0xff, 0xff, 0x11, 0x80, 0xda, 0x50, 0xd7, 0x08, 0x00,
-	0x00,
+	// 1288 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0xcf, 0x6e, 0x1b, 0xb7,
+	0x13, 0xce, 0x5a, 0xb2, 0x2c, 0x8d, 0x24, 0x47, 0x66, 0x12, 0x67, 0xe3, 0xdf, 0xaf, 0x81, 0xb2,
+	0x48, 0x5a, 0xf7, 0x10, 0xb7, 0xb0, 0x91, 0x00, 0x39, 0x14, 0x6d, 0xfe, 0x21, 0x16, 0x50, 0xc4,
+	0x02, 0xe5, 0x24, 0xe8, 0x49, 0xa0, 0x76, 0x47, 0x32, 0xe3, 0xd5, 0xee, 0x86, 0xa4, 0x1a, 0x39,
+	0xd7, 0xbe, 0x40, 0xaf, 0xed, 0xb1, 0x68, 0x2f, 0x7d, 0x8a, 0x3e, 0x47, 0x9f, 0xa6, 0xe0, 0x9f,
+	0x5d, 0xed, 0x3a, 0x02, 0x1a, 0xf4, 0xc6, 0xf9, 0x48, 0x0e, 0x67, 0xf8, 0xcd, 0x7c, 0x24, 0xf4,
+	0x12, 0x54, 0x5f, 0xc5, 0xd9, 0x58, 0x64, 0xe1, 0x41, 0x26, 0x52, 0x95, 0x92, 0x5a, 0x82, 0x2a,
+	0xe8, 0x43, 0x73, 0xc8, 0x93, 0xd9, 0x30, 0x4d, 0x66, 0xe4, 0x3a, 0x6c, 0xfe, 0xc8, 0xe2, 0x05,
+	0xfa, 0x5e, 0xdf, 0xdb, 0xef, 0x50, 0x6b, 0x04, 0x8f, 0xe1, 0xda, 0x89, 0x08, 0xcf, 0x50, 0x2a,
+	0xc1, 0x54, 0x2a, 0x28, 0xbe, 0x5b, 0xa0, 0x54, 0xc4, 0x87, 0x2d, 0x16, 0x45, 0x02, 0xa5, 0x74,
+	0xcb, 0x73, 0x93, 0xf4, 0xa0, 0x26, 0xf9, 0xcc, 0xdf, 0x30, 0xa8, 0x1e, 0x06, 0xbf, 0x78, 0xd0,
+	0x38, 0x19, 0x0d, 0x92, 0x69, 0x4a, 0x1e, 0x41, 0x5b, 0xaa, 0x54, 0xb0, 0x19, 0x9e, 0x5e, 0x64,
+	0xf6, 0xa4, 0xed, 0xc3, 0x9b, 0x07, 0x09, 0xaa, 0x03, 0xbb, 0xe2, 0x60, 0xb4, 0x9a, 0xa6, 0xe5,
+	0xb5, 0xe4, 0x1e, 0x34, 0xe4, 0x11, 0x4f, 0xa6, 0xa9, 0xdf, 0xeb, 0x7b, 0xfb, 0xed, 0xc3, 0xae,
+	0xd9, 0x35, 0x3a, 0xb2, 0xfb, 0xa8, 0x9b, 0x0c, 0xee, 0x43, 0xbb, 0xe4, 0x82, 0x00, 0x34, 0x9e,
+	0x0d, 0xe8, 0xf3, 0xa7, 0xa7, 0xbd, 0x2b, 0xa4, 0x01, 0x1b, 0xa3, 0xa3, 0x9e, 0xa7, 0xb1, 0x17,
+	0x27, 0x27, 0x2f, 0xbe, 0x7f, 0xde, 0xdb, 0x08, 0x7e, 0xf3, 0xa0, 0x99, 0xfb, 0x20, 0x04, 0xea,
+	0x67, 0xa9, 0x54, 0x26, 0xac, 0x16, 0x35, 0x63, 0x9d, 0xce, 0x39, 0x5e, 0x98, 0x74, 0x5a, 0x54,
+	0x0f, 0xc9, 0x2e, 0x34, 0xb2, 0x34, 0xe6, 0xe1, 0x85, 0x5f, 0x33, 0xa0, 0xb3, 0xc8, 0xff, 0xa1,
+	0x25, 0xf9, 0x2c, 0x61, 0x6a, 0x21, 0xd0, 0xaf, 0x9b, 0xa9, 0x15, 0x40, 0x6e, 0x03, 0x84, 0x02,
+	0x23, 0x4c, 0x14, 0x67, 0xb1, 0xbf, 0x69, 0xa6, 0x4b, 0x08, 0xd9, 0x83, 0xe6, 0xf2, 0xf1, 0xfc,
+	0xc3, 0x33, 0xa6, 0xd0, 0x6f, 0x98, 0xd9, 0xc2, 0x0e, 0x5e, 0x41, 0x6b, 0x28, 0x78, 0x88, 0x26,
+	0xc8, 0x00, 0x3a, 0x99, 0x36, 0x86, 0x28, 0x5e, 0x25, 0xdc, 0x06, 0x5b, 0xa3, 0x15, 0x8c, 0xdc,
+	0x85, 0x6e, 0xc6, 0x97, 0x18, 0xcb, 0x7c, 0xd1, 0x86, 0x59, 0x54, 0x05, 0x83, 0xbf, 0x3c, 0xe8,
+	0x95, 0xb9, 0x35, 0xee, 0x6f, 0x03, 0x28, 0xc1, 0x12, 0x19, 0xa6, 0x11, 0x0a, 0x77, 0x13, 0x25,
+	0x84, 0x3c, 0x84, 0xae, 0xe2, 0xe1, 0x39, 0xaa, 0x71, 0xc6, 0x04, 0x9b, 0x4b, 0xe3, 0xba, 0x7d,
+	0xb8, 0x63, 0xd8, 0x38, 0x35, 0x33, 0x43, 0x33, 0x41, 0x3b, 0xaa, 0x64, 0x91, 0xfb, 0x00, 0x26,
+	0xc4, 0xb1, 0xa1, 0xb0, 0x66, 0x36, 0x6d, 0x9b, 0x4d, 0x45, 0x6a, 0xb4, 0x95, 0x15, 0x59, 0xde,
+	0x83, 0x2d, 0x47, 0xbe, 0xdf, 0xef, 0xd7, 0xf6, 0xdb, 0x87, 0xed, 0x52, 0x91, 0xd0, 0x7c, 0x2e,
+	0xf8, 0xd9, 0x83, 0xce, 0x6b, 0x1e, 0x61, 0x3a, 0x14, 0xe9, 0x94, 0xc7, 0xa8, 0x29, 0x4c, 0xd8,
+	0x1c, 0x73, 0x0a, 0xf5, 0x58, 0xa7, 0x24, 0x50, 0xa6, 0xf1, 0x42, 0xf1, 0x34, 0x71, 0x4c, 0x96,
+	0x10, 0x5d, 0xcb, 0x13, 0xae, 0xaf, 0x00, 0x1d, 0xa3, 0xb9, 0xa9, 0xc9, 0x9f, 0x66, 0xd2, 0x90,
+	0xd9, 0xa5, 0x7a, 0x48, 0xfa, 0xd0, 0x66, 0x32, 0xc3, 0x50, 0x51, 0xa6, 0x78, 0xea, 0x78, 0x2c,
+	0x43, 0xc1, 0x4f, 0x1b, 0xb0, 0x35, 0xc2, 0xd9, 0x33, 0xa6, 0x98, 0x3e, 0x79, 0xce, 0x12, 0x3e,
+	0x45, 0xa9, 0x06, 0x91, 0x6b, 0x94, 0x12, 0x62, 0x7a, 0x05, 0xdf, 0x39, 0x76, 0xf4, 0xd0, 0x94,
+	0x20, 0x93, 0x67, 0x26, 0x90, 0x0e, 0x35, 0x63, 0x5d, 0x1a, 0x99, 0x4d, 0xcf, 0x86, 0xd2, 0xa1,
+	0x85, 0x9d, 0x77, 0xdb, 0x66, 0xd1, 0x6d, 0x9f, 0x78, 0x73, 0xe4, 0x01, 0x74, 0xa6, 0x8b, 0x38,
+	0x1e, 0xe6, 0x8e, 0xef, 0xf4, 0x6b, 0x05, 0x8d, 0xe5, 0x1b, 0xa5, 0x95, 0x65, 0xe4, 0x73, 0xd8,
+	0xce, 0x98, 0xd0, 0x15, 0x4b, 0x51, 0x2e, 0x62, 0x25, 0xfd, 0xa0, 0xef, 0xed, 0x37, 0xe9, 0x25,
+	0x34, 0x78, 0x03, 0x37, 0x4e, 0xf3, 0xa2, 0x89, 0x46, 0x38, 0x9b, 0x63, 0xa2, 0xcc, 0x95, 0xf4,
+	0xa0, 0xb6, 0x10, 0xb1, 0xe3, 0x47, 0x0f, 0x4d, 0x3f, 0x99, 0xba, 0x74, 0xf7, 0xe0, 0x2c, 0xad,
+	0x47, 0x28, 0x44, 0x2a, 0x1c, 0x29, 0xd6, 0x08, 0x7e, 0x80, 0x6e, 0xe1, 0xd8, 0x38, 0x7c, 0x08,
+	0x4d, 0x69, 0xfd, 0x6b, 0x29, 0xd2, 0x49, 0xec, 0xd9, 0x5a, 0x5c, 0x77, 0x3c, 0x2d, 0xd6, 0xae,
+	0xd1, 0xa9, 0x5f, 0x3d, 0xb8, 0x5a, 0xec, 0xb2, 0x89, 0xe4, 0x0c, 0x79, 0x2b, 0x86, 0x76, 0xf3,
+	0xb0, 0x4c, 0x21, 0x1d, 0x5f, 0x71, 0x81, 0x91, 0x7d, 0xa8, 0x47, 0x4c, 0x31, 0x57, 0xda, 0xa4,
+	0x1a, 0x83, 0x3e, 0xfb, 0xf8, 0x0a, 0x35, 0x2b, 0xc8, 0x97, 0x50, 0x2f, 0xe9, 0xd8, 0x0d, 0x4b,
+	0xcf, 0xa5, 0x3e, 0xa4, 0x66, 0xc9, 0x93, 0x26, 0x34, 0x84, 0x09, 0x24, 0xf8, 0xdd, 0x83, 0xab,
+	0x14, 0x67, 0x5c, 0x2a, 0x2c, 0x44, 0x78, 0x17, 0x1a, 0x12, 0x43, 0x81, 0xb9, 0x62, 0x39, 0x4b,
+	0x17, 0x4c, 0xc8, 0x32, 0x16, 0x72, 0x75, 0xe1, 0xee, 0xb4, 0xb0, 0xc9, 0xb7, 0xd0, 0xd1, 0xe3,
+	0x09, 0x8f, 0xb9, 0xe2, 0x28, 0x5d, 0xb8, 0xff, 0xab, 0x86, 0x2b, 0x9e, 0x96, 0x96, 0xd0, 0xca,
+	0x06, 0x2d, 0x73, 0x67, 0xc8, 0x84, 0x9a, 0x20, 0x53, 0xa6, 0x1c, 0x9b, 0x74, 0x05, 0x04, 0xdf,
+	0x40, 0x5b, 0x3f, 0x26, 0xff, 0x16, 0xa1, 0xe1, 0x3c, 0x99, 0x0d, 0xa2, 0x15, 0xe7, 0xda, 0x0a,
+	0xfe, 0xf4, 0x60, 0x77, 0x7d, 0x14, 0x7a, 0x8b, 0x06, 0x43, 0xcb, 0x72, 0x8b, 0x3a, 0x4b, 0xeb,
+	0x21, 0x0b, 0x43, 0x8c, 0x51, 0xb0, 0x52, 0x7f, 0x57, 0x30, 0x7d, 0x21, 0x73, 0xb6, 0x7c, 0xc3,
+	0x23, 0x65, 0x3b, 0xab, 0x4b, 0x0b, 0x5b, 0xe7, 0x33, 0x67, 0xcb, 0x63, 0xe4, 0xb3, 0x33, 0xe5,
+	0x3a, 0x7d, 0x05, 0x54, 0x7a, 0x6f, 0xd3, 0x9c, 0x5b, 0xd8, 0xc1, 0xdf, 0x1e, 0x74, 0x5f, 0xa6,
+	0x8a, 0x4f, 0x2f, 0x5c, 0x85, 0xad, 0x29, 0xee, 0x1e, 0xd4, 0xde, 0xa6, 0x93, 0xfc, 0xf9, 0x78,
+	0x9b, 0x4e, 0x74, 0x1e, 0x8a, 0xc9, 0xf3, 0x41, 0x64, 0xf8, 0xaf, 0x51, 0x67, 0x95, 0xae, 0xa4,
+	0x56, 0xbe, 0x12, 0xab, 0xf7, 0x38, 0x45, 0x15, 0x9e, 0xbd, 0x12, 0xb1, 0x56, 0x00, 0x1d, 0x45,
+	0x05, 0xab, 0x44, 0xb9, 0x73, 0x49, 0x21, 0xfe, 0x5b, 0xa3, 0x6b, 0x26, 0x3a, 0x65, 0x39, 0xd7,
+	0xf7, 0x24, 0x30, 0xe4, 0x19, 0xc7, 0x44, 0x39, 0x29, 0x5b, 0x01, 0xe4, 0x33, 0x80, 0x29, 0x0b,
+	0x71, 0x6c, 0x7f, 0x10, 0xb6, 0xa9, 0x5a, 0x1a, 0x79, 0xad, 0x01, 0x72, 0x0b, 0x9a, 0xef, 0x79,
+	0x32, 0xce, 0x44, 0x3a, 0x71, 0xd2, 0xb6, 0xf5, 0x9e, 0x27, 0x43, 0x91, 0x4e, 0xc8, 0x01, 0x5c,
+	0x2b, 0xdc, 0x8c, 0x05, 0x4b, 0xa2, 0xb1, 0x11, 0x40, 0x2b, 0x74, 0x3b, 0xc5, 0x14, 0x65, 0x49,
+	0x74, 0xac, 0xd5, 0x90, 0x40, 0x5d, 0x22, 0x46, 0x4e, 0xf2, 0xcc, 0x38, 0x18, 0x00, 0xb1, 0xb1,
+	0x8e, 0x30, 0x89, 0x50, 0xb8, 0x88, 0xef, 0x40, 0x47, 0x1a, 0x7b, 0x9c, 0xa4, 0x49, 0x68, 0xdf,
+	0x84, 0x2e, 0x6d, 0x5b, 0xec, 0xa5, 0x86, 0xd6, 0x88, 0xc0, 0x07, 0xd8, 0xb5, 0xae, 0x9e, 0x2f,
+	0x33, 0x6e, 0xcb, 0xc7, 0xb9, 0xbb, 0x07, 0xdb, 0xa1, 0x40, 0x83, 0x8c, 0x45, 0xba, 0x48, 0x22,
+	0xa7, 0x0a, 0xdd, 0x1c, 0xa5, 0x1a, 0x24, 0x8f, 0xe0, 0x56, 0x75, 0xd9, 0x78, 0x12, 0xa7, 0xe1,
+	0xb9, 0xcd, 0xca, 0x1e, 0xb4, 0x5b, 0xd9, 0xf1, 0x44, 0x4f, 0xeb, 0xd4, 0x82, 0x3f, 0x36, 0x60,
+	0x6b, 0xc8, 0x2e, 0x4c, 0x29, 0x7d, 0xf4, 0xce, 0x7a, 0x9f, 0xf6, 0xce, 0x9a, 0x8e, 0xd3, 0x09,
+	0xba, 0xb3, 0x9c, 0x45, 0x8e, 0x61, 0x07, 0x8b, 0x8c, 0x72, 0x9f, 0x95, 0xe6, 0x5f, 0x9b, 0x35,
+	0xed, 0xe1, 0xe5, 0x7b, 0x18, 0xc0, 0x75, 0x17, 0x99, 0xbb, 0x5d, 0xe7, 0xac, 0x6e, 0x0a, 0xeb,
+	0x66, 0xc9, 0x59, 0x99, 0x0d, 0x4a, 0xd4, 0xc7, 0x0c, 0x3d, 0x80, 0x6d, 0x5c, 0xea, 0xa7, 0x13,
+	0xa3, 0xb1, 0x79, 0xfb, 0xfd, 0xcd, 0xb5, 0x1f, 0x83, 0x6e, 0xbe, 0xca, 0x40, 0x87, 0x4b, 0xe8,
+	0x94, 0xf5, 0x92, 0x3c, 0x81, 0xab, 0x2f, 0x50, 0x55, 0x20, 0xff, 0x23, 0x55, 0x75, 0x92, 0xb4,
+	0xb7, 0x5e, 0x6f, 0xc9, 0x5d, 0xa8, 0xeb, 0x9f, 0x30, 0xb1, 0xdf, 0xca, 0xfc, 0x53, 0xbc, 0x57,
+	0x35, 0x0f, 0xdf, 0x03, 0xac, 0xe4, 0x89, 0x7c, 0x07, 0x24, 0x97, 0xe4, 0x12, 0x7a, 0xdd, 0x6c,
+	0xb9, 0xa4, 0xd5, 0x7b, 0xf6, 0x41, 0xa8, 0xc8, 0xc5, 0xd7, 0x1e, 0xf9, 0x02, 0xea, 0xda, 0x2f,
+	0xe9, 0xd9, 0x63, 0x56, 0xca, 0x79, 0xe9, 0xe0, 0x49, 0xc3, 0x7c, 0xda, 0x8f, 0xfe, 0x19, 0x00,
+	0xd6, 0x46, 0x6e, 0x93, 0xc8, 0x0b, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1281,6 +1583,8 @@ type TranscoderClient interface {
 	// Called by the transcoder to register to an orchestrator. The orchestrator
 	// notifies registered transcoders of segments as they come in.
 	RegisterTranscoder(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (Transcoder_RegisterTranscoderClient, error)
+	// Called by the transcoder to answer a ping sent through RegisterTranscoder.
+	Pong(ctx context.Context, in *PongRequest, opts ...grpc.CallOption) (*PingPong, error)
 }
 
 type transcoderClient struct {
@@ -1323,11 +1627,22 @@ func (x *transcoderRegisterTranscoderClient) Recv() (*NotifySegment, error) {
 	return m, nil
 }
 
+func (c *transcoderClient) Pong(ctx context.Context, in *PongRequest, opts ...grpc.CallOption) (*PingPong, error) {
+	out := new(PingPong)
+	err := c.cc.Invoke(ctx, "/net.Transcoder/Pong", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TranscoderServer is the server API for Transcoder service.
 type TranscoderServer interface {
 	// Called by the transcoder to register to an orchestrator. The orchestrator
 	// notifies registered transcoders of segments as they come in.
 	RegisterTranscoder(*RegisterRequest, Transcoder_RegisterTranscoderServer) error
+	// Called by the transcoder to answer a ping sent through RegisterTranscoder.
+	Pong(context.Context, *PongRequest) (*PingPong, error)
 }
 
 // UnimplementedTranscoderServer can be embedded to have forward compatible implementations.
@@ -1337,6 +1652,9 @@ type UnimplementedTranscoderServer struct {
 func (*UnimplementedTranscoderServer) RegisterTranscoder(req *RegisterRequest, srv Transcoder_RegisterTranscoderServer) error {
 	return status.Errorf(codes.Unimplemented, "method RegisterTranscoder not implemented")
 }
+func (*UnimplementedTranscoderServer) Pong(ctx context.Context, req *PongRequest) (*PingPong, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pong not implemented")
+}
 
 func RegisterTranscoderServer(s *grpc.Server, srv TranscoderServer) {
 	s.RegisterService(&_Transcoder_serviceDesc, srv)
@@ -1363,10 +1681,33 @@ func (x *transcoderRegisterTranscoderServer) Send(m *NotifySegment) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Transcoder_Pong_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PongRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TranscoderServer).Pong(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/net.Transcoder/Pong",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TranscoderServer).Pong(ctx, req.(*PongRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Transcoder_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "net.Transcoder",
 	HandlerType: (*TranscoderServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Pong",
+			Handler:    _Transcoder_Pong_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "RegisterTranscoder",
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+var errStreamExpired = errors.New("Stream expired")
+
+// AuthWebhookPolicy controls how the auth webhook is called
+type AuthWebhookPolicy struct {
+	// How long to wait for the webhook to respond. 0 waits indefinitely.
+	Timeout time.Duration
+	// How long a response is reused for streams with the same URL. 0
+	// disables caching.
+	CacheTTL time.Duration
+	// Accept streams with the default options if the webhook can't be
+	// reached or fails with a server error, rather than denying them
+	FailOpen bool
+}
+
+var AuthWebhook = AuthWebhookPolicy{Timeout: 5 * time.Second}
+
+type authCacheEntry struct {
+	resp    *authWebhookResponse
+	denial  monitor.AuthWebhookDenial
+	err     error
+	expires time.Time
+}
+
+// authCache holds the webhook's decisions, whether it accepted the stream or
+// not, keyed by stream URL. Failures to reach the webhook aren't cached.
+type authCache struct {
+	mu      sync.Mutex
+	entries map[string]*authCacheEntry
+}
+
+var authResponses = &authCache{entries: make(map[string]*authCacheEntry)}
+
+func (c *authCache) get(url string) *authCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[url]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil
+	}
+	return e
+}
+
+func (c *authCache) set(url string, e *authCacheEntry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for u, old := range c.entries {
+		if !now.Before(old.expires) {
+			delete(c.entries, u)
+		}
+	}
+	e.expires = now.Add(ttl)
+	c.entries[url] = e
+}
+
+// authObjectStore is the storage a stream's segments go to, instead of the
+// node's own
+type authObjectStore struct {
+	Type            string `json:"type"` // s3 or gs
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	AccessKey       string `json:"accessKey"`
+	AccessKeySecret string `json:"accessKeySecret"`
+	// Contents of the JSON key file for gs
+	Key string `json:"key"`
+}
+
+func (o *authObjectStore) driver() (drivers.OSDriver, error) {
+	if o.Bucket == "" {
+		return nil, errors.New("missing bucket")
+	}
+	switch o.Type {
+	case "s3":
+		if o.Region == "" || o.AccessKey == "" || o.AccessKeySecret == "" {
+			return nil, errors.New("s3 needs a region, accessKey and accessKeySecret")
+		}
+		return drivers.NewS3Driver(o.Region, o.Bucket, o.AccessKey, o.AccessKeySecret), nil
+	case "gs":
+		return drivers.NewGoogleDriverWithKey(o.Bucket, []byte(o.Key))
+	}
+	return nil, fmt.Errorf("unknown object store type %q", o.Type)
+}
+
+type authMaxPrice struct {
+	PricePerUnit  int64 `json:"pricePerUnit"`
+	PixelsPerUnit int64 `json:"pixelsPerUnit"`
+}
+
+// apply sets the stream options other than the manifest ID, key and profiles
+func (resp *authWebhookResponse) apply(params *streamParameters) error {
+	if resp.ObjectStore != nil {
+		driver, err := resp.ObjectStore.driver()
+		if err != nil {
+			return fmt.Errorf("invalid object store: %v", err)
+		}
+		params.objectStore = driver
+	}
+	if p := resp.MaxPrice; p != nil {
+		if p.PricePerUnit < 0 || p.PixelsPerUnit <= 0 {
+			return fmt.Errorf("invalid max price %d per %d pixels", p.PricePerUnit, p.PixelsPerUnit)
+		}
+		params.maxPrice = big.NewRat(p.PricePerUnit, p.PixelsPerUnit)
+	}
+	if len(resp.AllowOrchestrators) > 0 || len(resp.DenyOrchestrators) > 0 {
+		orchs, err := newOrchFilter(resp.AllowOrchestrators, resp.DenyOrchestrators)
+		if err != nil {
+			return err
+		}
+		params.orchs = orchs
+	}
+	if resp.ExpiresAt > 0 {
+		params.expiresAt = time.Unix(resp.ExpiresAt, 0)
+		if !time.Now().Before(params.expiresAt) {
+			return errStreamExpired
+		}
+	}
+	return nil
+}
+
+// orchFilter restricts the orchestrators a stream may use. Orchestrators
+// are identified by their ETH address or the host and port of their URI.
+type orchFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func newOrchFilter(allow, deny []string) (*orchFilter, error) {
+	f := &orchFilter{}
+	var err error
+	if f.allow, err = orchIDs(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = orchIDs(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func orchIDs(orchs []string) (map[string]bool, error) {
+	if len(orchs) == 0 {
+		return nil, nil
+	}
+	ids := make(map[string]bool, len(orchs))
+	for _, o := range orchs {
+		o = strings.TrimSpace(o)
+		if ethcommon.IsHexAddress(o) {
+			ids[strings.ToLower(ethcommon.HexToAddress(o).Hex())] = true
+			continue
+		}
+		u, err := url.ParseRequestURI(o)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid orchestrator %q; should be an ETH address or URI", o)
+		}
+		ids[u.Host] = true
+	}
+	return ids, nil
+}
+
+// allowed returns whether a stream may use the orchestrator. Orchestrators
+// that are denied are never allowed, and if there is an allow list, only
+// orchestrators on it are.
+func (f *orchFilter) allowed(info *net.OrchestratorInfo) bool {
+	if f == nil {
+		return true
+	}
+	var ids []string
+	if u, err := url.ParseRequestURI(info.GetTranscoder()); err == nil {
+		ids = append(ids, u.Host)
+	}
+	if tp := info.GetTicketParams(); tp != nil {
+		ids = append(ids, strings.ToLower(ethcommon.BytesToAddress(tp.Recipient).Hex()))
+	}
+	allowed := f.allow == nil
+	for _, id := range ids {
+		if f.deny[id] {
+			return false
+		}
+		if f.allow[id] {
+			allowed = true
+		}
+	}
+	return allowed
+}
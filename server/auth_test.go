@@ -0,0 +1,286 @@
+package server
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchFilter(t *testing.T) {
+	assert := assert.New(t)
+	addr := ethcommon.HexToAddress("0x00000000000000000000000000000000000000aa")
+	orch := func(uri string, recipient *ethcommon.Address) *net.OrchestratorInfo {
+		info := &net.OrchestratorInfo{Transcoder: uri}
+		if recipient != nil {
+			info.TicketParams = &net.TicketParams{Recipient: recipient.Bytes()}
+		}
+		return info
+	}
+	o1 := orch("https://o1.example:8935", nil)
+	o2 := orch("https://o2.example:8935", &addr)
+
+	var f *orchFilter
+	assert.True(f.allowed(o1))
+
+	// Allow list, by URI or address
+	f, err := newOrchFilter([]string{"https://o1.example:8935/"}, nil)
+	assert.Nil(err)
+	assert.True(f.allowed(o1))
+	assert.False(f.allowed(o2))
+	f, err = newOrchFilter([]string{" 0x00000000000000000000000000000000000000AA"}, nil)
+	assert.Nil(err)
+	assert.False(f.allowed(o1))
+	assert.True(f.allowed(o2))
+
+	// Deny list
+	f, err = newOrchFilter(nil, []string{addr.Hex()})
+	assert.Nil(err)
+	assert.True(f.allowed(o1))
+	assert.False(f.allowed(o2))
+
+	// Denying wins
+	f, err = newOrchFilter([]string{"https://o2.example:8935"}, []string{addr.Hex()})
+	assert.Nil(err)
+	assert.False(f.allowed(o2))
+
+	// Ports matter
+	f, err = newOrchFilter([]string{"https://o1.example"}, nil)
+	assert.Nil(err)
+	assert.False(f.allowed(o1))
+
+	_, err = newOrchFilter([]string{"o1.example"}, nil)
+	assert.EqualError(err, `invalid orchestrator "o1.example"; should be an ETH address or URI`)
+	_, err = newOrchFilter(nil, []string{"0x1234"})
+	assert.NotNil(err)
+}
+
+func TestSelectOrchestrator_StreamOptions(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer func() { s.LivepeerNode.OrchestratorPool = nil }()
+
+	addr := ethcommon.HexToAddress("0x00000000000000000000000000000000000000aa")
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{infos: []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://o1.example:8935", TicketParams: &net.TicketParams{}},
+		&net.OrchestratorInfo{Transcoder: "https://o2.example:8935", TicketParams: &net.TicketParams{Recipient: addr.Bytes()}},
+		&net.OrchestratorInfo{Transcoder: "https://o3.example:8935", TicketParams: &net.TicketParams{}},
+	}}
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	sp := &streamParameters{mid: mid, profiles: []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, maxPrice: big.NewRat(1, 2)}
+
+	transcoders := func(count int) []string {
+		sess, err := selectOrchestrator(s.LivepeerNode, sp, pl, count)
+		assert.Nil(err)
+		var uris []string
+		for _, sess := range sess {
+			assert.Equal(big.NewRat(1, 2), sess.MaxPrice)
+			uris = append(uris, sess.OrchestratorInfo.Transcoder)
+		}
+		return uris
+	}
+	assert.Len(transcoders(3), 3)
+
+	sp.orchs, _ = newOrchFilter(nil, []string{addr.Hex()})
+	assert.Equal([]string{"https://o1.example:8935", "https://o3.example:8935"}, transcoders(3))
+	// Filtered before being cut down to size
+	assert.Equal([]string{"https://o1.example:8935"}, transcoders(1))
+
+	sp.orchs, _ = newOrchFilter([]string{"https://o3.example:8935"}, nil)
+	assert.Equal([]string{"https://o3.example:8935"}, transcoders(1))
+
+	sp.orchs, _ = newOrchFilter([]string{"https://o4.example:8935"}, nil)
+	_, err := selectOrchestrator(s.LivepeerNode, sp, pl, 3)
+	assert.Equal(errNoOrchs, err)
+}
+
+func TestSelectOrchestrator_StreamMaxPrice(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer func() {
+		s.LivepeerNode.OrchestratorPool = nil
+		s.LivepeerNode.Sender = nil
+	}()
+
+	sd := &stubDiscovery{lock: &sync.Mutex{}, infos: []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://o1.example:8935", TicketParams: &net.TicketParams{}, PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}},
+		&net.OrchestratorInfo{Transcoder: "https://o2.example:8935", TicketParams: &net.TicketParams{}, PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 3}},
+		&net.OrchestratorInfo{Transcoder: "https://o3.example:8935", TicketParams: &net.TicketParams{}},
+	}}
+	s.LivepeerNode.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	sp := &streamParameters{mid: mid, profiles: []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, maxPrice: big.NewRat(1, 2)}
+
+	transcoders := func(count int) []string {
+		sess, err := selectOrchestrator(s.LivepeerNode, sp, pl, count)
+		assert.Nil(err)
+		var uris []string
+		for _, sess := range sess {
+			uris = append(uris, sess.OrchestratorInfo.Transcoder)
+		}
+		return uris
+	}
+
+	// Off-chain, orchestrators aren't priced
+	assert.Len(transcoders(3), 3)
+	assert.Nil(sd.maxPrice)
+
+	// On-chain, the stream's max price is passed to discovery and checked
+	sender := &pm.MockSender{}
+	sender.On("StartSession", mock.Anything).Return("foo")
+	s.LivepeerNode.Sender = sender
+	assert.Equal([]string{"https://o2.example:8935"}, transcoders(3))
+	assert.Equal(big.NewRat(1, 2), sd.maxPrice)
+
+	sp.maxPrice = big.NewRat(1, 4)
+	_, err := selectOrchestrator(s.LivepeerNode, sp, pl, 3)
+	assert.Equal(errNoOrchs, err)
+}
+
+func TestRegisterConnection_StreamOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer func() { drivers.NodeStorage = drivers.NewMemoryDriver(nil) }()
+
+	// Streams use their own storage
+	drivers.NodeStorage = nil
+	storage := drivers.NewMemoryDriver(nil)
+	mid := core.ManifestID(t.Name())
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, objectStore: storage})
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	_, err = cxn.pl.GetOSSession().SaveData("source/0.ts", []byte("seg"))
+	require.Nil(err)
+	assert.Equal("seg", string(storage.GetSession(string(mid)).GetData(string(mid)+"/source/0.ts")))
+	require.Nil(removeRTMPStream(s, mid))
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+
+	// Already expired
+	strm = stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, expiresAt: time.Now()})
+	_, err = s.registerConnection(strm)
+	assert.Equal(errStreamExpired, err)
+
+	// Ended once expired
+	strm = stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, expiresAt: time.Now().Add(50 * time.Millisecond)})
+	_, err = s.registerConnection(strm)
+	require.Nil(err)
+	assert.Eventually(func() bool {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		_, ok := s.rtmpConnections[mid]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	// Streams that ended don't end their successors
+	strm = stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, expiresAt: time.Now().Add(50 * time.Millisecond)})
+	_, err = s.registerConnection(strm)
+	require.Nil(err)
+	require.Nil(removeRTMPStream(s, mid))
+	strm = stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid})
+	cxn, err = s.registerConnection(strm)
+	require.Nil(err)
+	time.Sleep(100 * time.Millisecond)
+	s.connectionLock.RLock()
+	assert.Equal(cxn, s.rtmpConnections[mid])
+	s.connectionLock.RUnlock()
+	require.Nil(removeRTMPStream(s, mid))
+}
+
+func TestAuthenticateStream_Policy(t *testing.T) {
+	assert := assert.New(t)
+	oldPolicy := AuthWebhook
+	defer func() {
+		AuthWebhook = oldPolicy
+		AuthWebhookURL = ""
+		authResponses = &authCache{entries: make(map[string]*authCacheEntry)}
+	}()
+
+	var calls int32
+	var status int32 = http.StatusOK
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/slow" {
+			<-block
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write([]byte(`{"manifestID":"a"}`))
+	}))
+	defer ts.Close()
+	defer close(block)
+	AuthWebhookURL = ts.URL
+
+	// Not cached by default
+	AuthWebhook = AuthWebhookPolicy{Timeout: time.Second}
+	resp, err := authenticateStream("rtmp://host/live/a")
+	assert.Nil(err)
+	assert.Equal("a", resp.ManifestID)
+	authenticateStream("rtmp://host/live/a")
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// Cached per URL, denials included
+	AuthWebhook.CacheTTL = 50 * time.Millisecond
+	atomic.StoreInt32(&calls, 0)
+	resp, err = authenticateStream("rtmp://host/live/a")
+	assert.Nil(err)
+	assert.Equal("a", resp.ManifestID)
+	resp, err = authenticateStream("rtmp://host/live/a")
+	assert.Nil(err)
+	assert.Equal("a", resp.ManifestID)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+	atomic.StoreInt32(&status, http.StatusForbidden)
+	_, err = authenticateStream("rtmp://host/live/b")
+	assert.EqualError(err, "403 Forbidden")
+	_, err = authenticateStream("rtmp://host/live/b")
+	assert.EqualError(err, "403 Forbidden")
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// Until they expire
+	time.Sleep(60 * time.Millisecond)
+	_, err = authenticateStream("rtmp://host/live/a")
+	assert.EqualError(err, "403 Forbidden")
+	assert.Equal(int32(3), atomic.LoadInt32(&calls))
+	authResponses.mu.Lock()
+	assert.Len(authResponses.entries, 1, "Expired entries weren't removed")
+	authResponses.mu.Unlock()
+
+	// Server errors are neither cached nor treated as denials when failing open
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	_, err = authenticateStream("rtmp://host/live/c")
+	assert.EqualError(err, "503 Service Unavailable")
+	AuthWebhook.FailOpen = true
+	resp, err = authenticateStream("rtmp://host/live/c")
+	assert.Nil(err)
+	assert.Nil(resp)
+	assert.Equal(int32(5), atomic.LoadInt32(&calls))
+
+	// Nor are timeouts
+	AuthWebhookURL = ts.URL + "/slow"
+	AuthWebhook.Timeout = 20 * time.Millisecond
+	start := time.Now()
+	resp, err = authenticateStream("rtmp://host/live/d")
+	assert.Nil(err)
+	assert.Nil(resp)
+	assert.True(time.Since(start) < 500*time.Millisecond)
+	AuthWebhook.FailOpen = false
+	_, err = authenticateStream("rtmp://host/live/d")
+	assert.NotNil(err)
+	assert.Equal(int32(7), atomic.LoadInt32(&calls))
+}
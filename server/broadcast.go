@@ -6,9 +6,11 @@ import (
 	"io/ioutil"
 	"math"
 	"math/big"
+	"math/rand"
 	"net/url"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
 
 	"github.com/livepeer/lpms/ffmpeg"
@@ -44,6 +47,118 @@ func (cfg *BroadcastConfig) SetMaxPrice(price *big.Rat) {
 	cfg.maxPrice = price
 }
 
+// SegmentRetryPolicy bounds how long the broadcaster keeps trying to get a
+// segment transcoded. Once either limit is hit the segment is dropped from
+// the renditions; it remains in the source playlist.
+type SegmentRetryPolicy struct {
+	// Maximum number of transcode attempts; 0 for no limit
+	MaxAttempts int
+	// Give up once this multiple of the segment duration has elapsed; 0 for no limit
+	DeadlineFactor float64
+	// Wait before trying the next orchestrator. Doubles with every failed
+	// attempt, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var SegmentRetry = SegmentRetryPolicy{
+	MaxAttempts:    3,
+	DeadlineFactor: 5,
+	Backoff:        100 * time.Millisecond,
+	MaxBackoff:     1 * time.Second,
+}
+
+// deadline returns the time allowed for a segment of the given duration, or 0 if unbounded
+func (p SegmentRetryPolicy) deadline(segDur float64) time.Duration {
+	if p.DeadlineFactor <= 0 {
+		return 0
+	}
+	if segDur <= 0 {
+		segDur = SegLen.Seconds()
+	}
+	return time.Duration(p.DeadlineFactor * segDur * float64(time.Second))
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (p SegmentRetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
+
+// Orchestrators that fail are cooled down for sessionCooldown, doubling
+// with each consecutive failure up to maxSessionCooldown
+var sessionCooldown = 5 * time.Second
+var maxSessionCooldown = 5 * time.Minute
+
+// Weight given to the newest sample in the rolling session stats
+const sessionStatsAlpha = 0.2
+
+// Lowest selection weight, so poorly scoring orchestrators still get picked occasionally
+const minSessionScore = 0.01
+
+// sessionStats tracks the recent performance of an orchestrator.
+// Rates and latencies are exponentially weighted moving averages.
+type sessionStats struct {
+	successRate      float64
+	uploadLatency    time.Duration
+	transcodeLatency time.Duration
+	samples          int
+
+	failures      int // consecutive
+	cooldownUntil time.Time
+}
+
+func newSessionStats() *sessionStats {
+	return &sessionStats{successRate: 1}
+}
+
+func (s *sessionStats) success(uploadDur, transcodeDur time.Duration) {
+	if s.samples == 0 {
+		s.uploadLatency = uploadDur
+		s.transcodeLatency = transcodeDur
+	} else {
+		s.uploadLatency = ewmaDuration(s.uploadLatency, uploadDur)
+		s.transcodeLatency = ewmaDuration(s.transcodeLatency, transcodeDur)
+	}
+	s.successRate = (1-sessionStatsAlpha)*s.successRate + sessionStatsAlpha
+	s.samples++
+	s.failures = 0
+}
+
+func (s *sessionStats) failure(now time.Time) {
+	s.successRate = (1 - sessionStatsAlpha) * s.successRate
+	s.samples++
+	s.failures++
+	cooldown := sessionCooldown
+	for i := 1; i < s.failures && cooldown < maxSessionCooldown; i++ {
+		cooldown *= 2
+	}
+	if cooldown > maxSessionCooldown {
+		cooldown = maxSessionCooldown
+	}
+	s.cooldownUntil = now.Add(cooldown)
+}
+
+// score favors orchestrators that succeed often and respond quickly
+// relative to the segment length. Untried orchestrators score highest.
+func (s *sessionStats) score() float64 {
+	latency := (s.uploadLatency + s.transcodeLatency).Seconds() / SegLen.Seconds()
+	return math.Max(s.successRate/(1+latency), minSessionScore)
+}
+
+func ewmaDuration(avg, sample time.Duration) time.Duration {
+	return time.Duration((1-sessionStatsAlpha)*float64(avg) + sessionStatsAlpha*float64(sample))
+}
+
 type BroadcastSessionsManager struct {
 	// Accessing or changing any of the below requires ownership of this mutex
 	sessLock *sync.Mutex
@@ -52,6 +167,15 @@ type BroadcastSessionsManager struct {
 	sessMap  map[string]*BroadcastSession
 	numOrchs int // how many orchs to request at once
 
+	// Sessions that recently failed, waiting to be put back into use
+	cooling map[string]*BroadcastSession
+	// Transcoder URIs of orchestrators that returned bad results; never
+	// used again for the stream
+	evicted map[string]bool
+	// Performance of each orchestrator, keyed by transcoder URI.
+	// Kept across refreshes and cooldowns.
+	stats map[string]*sessionStats
+
 	refreshing bool // only allow one refresh in-flight
 	finished   bool // set at stream end
 
@@ -62,48 +186,131 @@ func (bsm *BroadcastSessionsManager) selectSession() *BroadcastSession {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
 
-	checkSessions := func(m *BroadcastSessionsManager) bool {
-		numSess := len(m.sessList)
-		if numSess < int(math.Ceil(float64(m.numOrchs)/2.0)) {
-			go m.refreshSessions()
+	bsm.readmitSessions(time.Now())
+
+	// Drop any sessions no longer in the map
+	sessions := bsm.sessList[:0]
+	for _, sess := range bsm.sessList {
+		if bsm.sessMap[sess.OrchestratorInfo.Transcoder] == sess {
+			sessions = append(sessions, sess)
 		}
-		return numSess > 0
 	}
-	for checkSessions(bsm) {
-		last := len(bsm.sessList) - 1
-		sess, sessions := bsm.sessList[last], bsm.sessList[:last]
-		bsm.sessList = sessions
-		if _, ok := bsm.sessMap[sess.OrchestratorInfo.Transcoder]; ok {
-			return sess
-		}
-		/*
-		   Don't select sessions no longer in the map.
+	bsm.sessList = sessions
 
-		   Retry if the first selected session has been removed from the map.
-		   This may occur if the session is removed while still in the list.
-		   To avoid a runtime search of the session list under lock, simply
-		   fixup the session list at selection time by retrying the selection.
-		*/
+	numSess := len(bsm.sessList)
+	if numSess < int(math.Ceil(float64(bsm.numOrchs)/2.0)) {
+		go bsm.refreshSessions()
 	}
-	return nil
+	if numSess <= 0 {
+		return nil
+	}
+
+	// Weighted random choice over session scores
+	scores := make([]float64, numSess)
+	var total float64
+	for i, sess := range bsm.sessList {
+		scores[i] = bsm.statsFor(sess).score()
+		total += scores[i]
+	}
+	idx := numSess - 1
+	r := rand.Float64() * total
+	for i, score := range scores {
+		if r < score {
+			idx = i
+			break
+		}
+		r -= score
+	}
+	sess := bsm.sessList[idx]
+	bsm.sessList = append(bsm.sessList[:idx], bsm.sessList[idx+1:]...)
+	return sess
 }
 
+// removeSession takes a failed session out of use and cools it down
 func (bsm *BroadcastSessionsManager) removeSession(session *BroadcastSession) {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
 
-	delete(bsm.sessMap, session.OrchestratorInfo.Transcoder)
+	if !bsm.takeSession(session) {
+		return
+	}
+	bsm.statsFor(session).failure(time.Now())
+	if !bsm.finished {
+		bsm.cooling[session.OrchestratorInfo.Transcoder] = session
+	}
+}
+
+// evictSession takes a session out of use for the rest of the stream,
+// without a cooldown. Refreshes won't bring its orchestrator back either.
+func (bsm *BroadcastSessionsManager) evictSession(session *BroadcastSession) {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+
+	key := session.OrchestratorInfo.Transcoder
+	if bsm.evicted == nil {
+		bsm.evicted = make(map[string]bool)
+	}
+	bsm.evicted[key] = true
+	delete(bsm.cooling, key)
+	if bsm.takeSession(session) {
+		bsm.statsFor(session).failure(time.Now())
+	}
+}
+
+// takeSession removes the session from the pool. It returns false if the
+// session had already been removed, or replaced by a refresh.
+func (bsm *BroadcastSessionsManager) takeSession(session *BroadcastSession) bool {
+	key := session.OrchestratorInfo.Transcoder
+	if bsm.sessMap[key] != session {
+		return false
+	}
+	delete(bsm.sessMap, key)
+	for i, sess := range bsm.sessList {
+		if sess == session {
+			bsm.sessList = append(bsm.sessList[:i], bsm.sessList[i+1:]...)
+			break
+		}
+	}
+	return true
 }
 
+// completeSession records a successful segment and returns the session to the pool
 func (bsm *BroadcastSessionsManager) completeSession(sess *BroadcastSession) {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
 
-	if _, ok := bsm.sessMap[sess.OrchestratorInfo.Transcoder]; ok {
+	if bsm.sessMap[sess.OrchestratorInfo.Transcoder] == sess {
+		bsm.statsFor(sess).success(sess.uploadDur, sess.transcodeDur)
+		bsm.sessList = append(bsm.sessList, sess)
+	}
+}
+
+// readmitSessions puts sessions whose cooldown has expired back into use
+func (bsm *BroadcastSessionsManager) readmitSessions(now time.Time) {
+	for key, sess := range bsm.cooling {
+		if now.Before(bsm.statsFor(sess).cooldownUntil) {
+			continue
+		}
+		delete(bsm.cooling, key)
+		if _, ok := bsm.sessMap[key]; ok {
+			// A refresh already brought in a new session for this orchestrator
+			continue
+		}
+		bsm.sessMap[key] = sess
 		bsm.sessList = append(bsm.sessList, sess)
 	}
 }
 
+func (bsm *BroadcastSessionsManager) statsFor(sess *BroadcastSession) *sessionStats {
+	key := sess.OrchestratorInfo.Transcoder
+	stats, ok := bsm.stats[key]
+	if !ok {
+		stats = newSessionStats()
+		bsm.stats[key] = stats
+	}
+	return stats
+}
+
 func (bsm *BroadcastSessionsManager) refreshSessions() {
 
 	glog.V(common.DEBUG).Info("Starting session refresh")
@@ -141,10 +348,19 @@ func (bsm *BroadcastSessionsManager) refreshSessions() {
 		return
 	}
 
+	now := time.Now()
 	for _, sess := range newBroadcastSessions {
-		if _, ok := bsm.sessMap[sess.OrchestratorInfo.Transcoder]; ok {
+		key := sess.OrchestratorInfo.Transcoder
+		if _, ok := bsm.sessMap[key]; ok || bsm.evicted[key] {
 			continue
 		}
+		if _, ok := bsm.cooling[key]; ok {
+			if now.Before(bsm.statsFor(sess).cooldownUntil) {
+				continue
+			}
+			// Prefer the fresh session over the cooled down one
+			delete(bsm.cooling, key)
+		}
 		uniqueSessions = append(uniqueSessions, sess)
 		bsm.sessMap[sess.OrchestratorInfo.Transcoder] = sess
 	}
@@ -157,6 +373,7 @@ func (bsm *BroadcastSessionsManager) cleanup() {
 	bsm.finished = true
 	bsm.sessList = nil
 	bsm.sessMap = make(map[string]*BroadcastSession) // prevent segfaults
+	bsm.cooling = make(map[string]*BroadcastSession)
 }
 
 func NewSessionManager(node *core.LivepeerNode, params *streamParameters, pl core.PlaylistManager) *BroadcastSessionsManager {
@@ -168,6 +385,8 @@ func NewSessionManager(node *core.LivepeerNode, params *streamParameters, pl cor
 	numOrchs := int(math.Min(poolSize, maxInflight*2))
 	bsm := &BroadcastSessionsManager{
 		sessMap:        make(map[string]*BroadcastSession),
+		cooling:        make(map[string]*BroadcastSession),
+		stats:          make(map[string]*sessionStats),
 		createSessions: func() ([]*BroadcastSession, error) { return selectOrchestrator(node, params, pl, numOrchs) },
 		sessLock:       &sync.Mutex{},
 		numOrchs:       numOrchs,
@@ -182,7 +401,34 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 		return nil, errDiscovery
 	}
 
-	tinfos, err := n.OrchestratorPool.GetOrchestrators(count)
+	// Orchestrators are only paid, and so only priced, in on-chain mode
+	var maxPrice *big.Rat
+	if n.Sender != nil {
+		maxPrice = params.maxPrice
+	}
+
+	numOrchs := count
+	if params.orchs != nil || maxPrice != nil {
+		// Leave room for the ones that get filtered out
+		numOrchs = n.OrchestratorPool.Size()
+	}
+	tinfos, err := n.OrchestratorPool.GetOrchestrators(numOrchs, maxPrice)
+	if (params.orchs != nil || maxPrice != nil) && err == nil {
+		var allowed []*net.OrchestratorInfo
+		for _, tinfo := range tinfos {
+			if params.orchs != nil && !params.orchs.allowed(tinfo) {
+				continue
+			}
+			if maxPrice != nil && checkPrice(tinfo.GetPriceInfo(), maxPrice) != nil {
+				continue
+			}
+			allowed = append(allowed, tinfo)
+		}
+		if len(allowed) > count {
+			allowed = allowed[:count]
+		}
+		tinfos = allowed
+	}
 	if len(tinfos) <= 0 {
 		glog.Info("No orchestrators found; not transcoding. Error: ", err)
 		return nil, errNoOrchs
@@ -216,7 +462,7 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 		if bcastOS.IsExternal() {
 			// Give each O its own OS session to prevent front running uploads
 			pfx := fmt.Sprintf("%v/%v", cpl.ManifestID(), core.RandomManifestID())
-			bcastOS = drivers.NodeStorage.NewSession(pfx)
+			bcastOS = params.storage().NewSession(pfx)
 		}
 
 		session := &BroadcastSession{
@@ -229,6 +475,7 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 			Sender:           n.Sender,
 			PMSessionID:      sessionID,
 			Balance:          balance,
+			MaxPrice:         params.maxPrice,
 		}
 
 		sessions = append(sessions, session)
@@ -247,6 +494,8 @@ func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) error {
 	if monitor.Enabled {
 		monitor.SegmentEmerged(nonce, seg.SeqNo, len(BroadcastJobVideoProfiles))
 	}
+	cxn.stats.segmentIngested(seg.SeqNo)
+	defer cxn.stats.segmentDone(seg.SeqNo)
 
 	seg.Name = "" // hijack seg.Name to convey the uploaded URI
 	name := fmt.Sprintf("%s/%d.ts", vProfile.Name, seg.SeqNo)
@@ -270,17 +519,69 @@ func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) error {
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error(), true)
 		}
+	} else {
+		ev := segmentEvent(EventSegmentSaved, mid, seg.SeqNo)
+		ev.Profile, ev.URL, ev.Duration = vProfile.Name, uri, seg.Duration
+		StreamEvents.send(ev)
 	}
 
-	for {
-		// if fails, retry; rudimentary
-		if err := transcodeSegment(cxn, seg, name); err == nil {
+	policy := SegmentRetry
+	start := time.Now()
+	deadline := policy.deadline(seg.Duration)
+	var code monitor.SegmentTranscodeError
+	// Profiles still to be transcoded; all of them to begin with
+	var profiles []ffmpeg.VideoProfile
+	for attempt := 1; ; attempt++ {
+		err = transcodeSegment(cxn, seg, name, profiles)
+		if err == nil {
 			return nil
 		}
+		if perr, ok := err.(*partialTranscodeError); ok {
+			profiles = perr.profiles
+		}
+		if shouldStopStream(err) {
+			cxn.stats.segmentFailed()
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			code = monitor.SegmentTranscodeErrorMaxAttempts
+			break
+		}
+		wait := policy.backoff(attempt)
+		if deadline > 0 && time.Since(start)+wait >= deadline {
+			code = monitor.SegmentTranscodeErrorDeadlineExceeded
+			break
+		}
+		glog.V(common.DEBUG).Infof("Retrying segment nonce=%d manifestID=%s seqNo=%d attempt=%d wait=%v err=%v", nonce, mid, seg.SeqNo, attempt, wait, err)
+		time.Sleep(wait)
+	}
+
+	// Give up on this segment; it stays in the source playlist only
+	glog.Errorf("Dropping segment from renditions nonce=%d manifestID=%s seqNo=%d reason=%v err=%v", nonce, mid, seg.SeqNo, code, err)
+	if monitor.Enabled {
+		monitor.SegmentTranscodeFailed(code, nonce, seg.SeqNo, err, true)
 	}
+	cxn.stats.segmentFailed()
+	ev := segmentEvent(EventTranscodeFailed, mid, seg.SeqNo)
+	ev.Error = err.Error()
+	StreamEvents.send(ev)
+	return err
 }
 
-func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string) error {
+// partialTranscodeError is returned when only some of the renditions of a
+// segment came back. The others are left to be transcoded by another
+// orchestrator.
+type partialTranscodeError struct {
+	profiles []ffmpeg.VideoProfile
+}
+
+func (e *partialTranscodeError) Error() string {
+	return "Missing renditions: " + common.ProfilesNames(e.profiles)
+}
+
+// transcodeSegment transcodes the segment into the given profiles, or into
+// all of the session's profiles if none are given
+func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string, profiles []ffmpeg.VideoProfile) error {
 
 	nonce := cxn.nonce
 	rtmpStrm := cxn.stream
@@ -288,16 +589,29 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 	sess := cxn.sessManager.selectSession()
 	// Return early under a few circumstances:
 	// View-only (non-transcoded) streams or no sessions available
+	if sess == nil && profiles != nil {
+		// Retrying the profiles another orchestrator missed; keep retrying
+		// until the segment runs out of attempts
+		glog.Infof("No sessions available for missing profiles nonce=%d manifestID=%s seqNo=%d profiles=%s", nonce, cxn.mid, seg.SeqNo, common.ProfilesNames(profiles))
+		return errNoOrchs
+	}
 	if sess == nil {
 		if monitor.Enabled {
 			monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorNoOrchestrators, nonce, seg.SeqNo, errNoOrchs, true)
 		}
 		glog.Infof("No sessions available for segment nonce=%d manifestID=%s seqNo=%d", nonce, cxn.mid, seg.SeqNo)
+		cxn.stats.segmentFailed()
+		ev := segmentEvent(EventTranscodeFailed, cxn.mid, seg.SeqNo)
+		ev.Error = errNoOrchs.Error()
+		StreamEvents.send(ev)
 		// We may want to introduce a "non-retryable" error type here
 		// would help error propagation for live ingest.
 		// similar to the orchestrator's RemoteTranscoderFatalError
 		return nil
 	}
+	if profiles == nil {
+		profiles = sess.Profiles
+	}
 	{
 		glog.Infof("Trying to transcode segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
 		if monitor.Enabled {
@@ -322,7 +636,8 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 		// send segment to the orchestrator
 		glog.V(common.DEBUG).Infof("Submitting segment nonce=%d manifestID=%s seqNo=%d orch=%s", nonce, cxn.mid, seg.SeqNo, sess.OrchestratorInfo.Transcoder)
 
-		res, err := SubmitSegment(sess, seg, nonce)
+		res, err := submitSegment(sess, seg, nonce, profiles)
+		cxn.stats.orchestratorUsed(sess, err == nil && res != nil)
 		if err != nil || res == nil {
 			cxn.sessManager.removeSession(sess)
 			if res == nil && err == nil {
@@ -338,7 +653,16 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			return err
 		}
 
-		cxn.sessManager.completeSession(sess)
+		// Renditions are matched to profiles by position
+		if len(res.Segments) != len(profiles) {
+			err := fmt.Errorf("orchestrator returned %d renditions for %d profiles", len(res.Segments), len(profiles))
+			glog.Errorf("Bad response for segment nonce=%d manifestID=%s seqNo=%d orch=%s: %v", nonce, cxn.mid, seg.SeqNo, sess.OrchestratorInfo.Transcoder, err)
+			cxn.sessManager.removeSession(sess)
+			if monitor.Enabled {
+				monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorUnknownResponse, nonce, seg.SeqNo, err, false)
+			}
+			return err
+		}
 
 		// download transcoded segments from the transcoder
 		gotErr := false // only send one error msg per segment list
@@ -352,13 +676,26 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			}
 		}
 
-		var dlErr, saveErr error
+		var dlErr error
 		segHashes := make([][]byte, len(res.Segments))
-		n := len(res.Segments)
+		var missing []ffmpeg.VideoProfile
+		for i, v := range res.Segments {
+			if v.Error != "" {
+				glog.Errorf("Failed to transcode profile nonce=%d seqNo=%d profile=%s: %v", nonce, seg.SeqNo, profiles[i].Name, v.Error)
+				missing = append(missing, profiles[i])
+			}
+		}
+		n := len(res.Segments) - len(missing)
 		segHashLock := &sync.Mutex{}
 		cond := sync.NewCond(segHashLock)
 
-		dlFunc := func(url string, pixels int64, i int) {
+		onchain := sess.Sender != nil
+		verify := SegmentVerifier.ShouldVerify()
+		renditions := make([]*rendition, len(res.Segments))
+		urls := make([]string, len(res.Segments))
+		segData := make([][]byte, len(res.Segments))
+
+		dlFunc := func(url string, i int) {
 			defer func() {
 				cond.L.Lock()
 				n--
@@ -368,8 +705,17 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 				cond.L.Unlock()
 			}()
 
-			if bos := sess.BroadcasterOS; bos != nil && !drivers.IsOwnExternal(url) {
-				data, err := drivers.GetSegmentData(url)
+			var data []byte
+			bos := sess.BroadcasterOS
+			download := bos != nil && !drivers.IsOwnExternal(url) && !drivers.IsSessionStorage(bos, url)
+			if download || onchain {
+				var err error
+				if download {
+					data, err = drivers.GetSegmentData(url)
+				} else {
+					// Uploaded straight to our own storage; fetch it back to hash it
+					data, err = fetchRendition(url, bos)
+				}
 				if err != nil {
 					errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
 					segHashLock.Lock()
@@ -378,12 +724,15 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 					cxn.sessManager.removeSession(sess)
 					return
 				}
-				name := fmt.Sprintf("%s/%d.ts", sess.Profiles[i].Name, seg.SeqNo)
+				hash := crypto.Keccak256(data)
+				segHashLock.Lock()
+				segHashes[i] = hash
+				segHashLock.Unlock()
+			}
+			if download {
+				name := fmt.Sprintf("%s/%d.ts", profiles[i].Name, seg.SeqNo)
 				newURL, err := bos.SaveData(name, data)
 				if err != nil {
-					segHashLock.Lock()
-					saveErr = err
-					segHashLock.Unlock()
 					switch err.Error() {
 					case "Session ended":
 						errFunc(monitor.SegmentTranscodeErrorSessionEnded, url, err)
@@ -393,66 +742,113 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 					return
 				}
 				url = newURL
+			}
+			segHashLock.Lock()
+			urls[i], segData[i] = url, data
+			segHashLock.Unlock()
+		}
 
-				hash := crypto.Keccak256(data)
-				segHashLock.Lock()
-				segHashes[i] = hash
-				segHashLock.Unlock()
+		for i, v := range res.Segments {
+			if v.Error == "" {
+				go dlFunc(v.Url, i)
+			}
+		}
+
+		cond.L.Lock()
+		for n != 0 {
+			cond.Wait()
+		}
+		cond.L.Unlock()
+		if dlErr != nil {
+			return dlErr
+		}
+		if onchain && !verifySegSig(sess, res, segHashes) {
+			glog.Errorf("Sig check failed for segment nonce=%d manifestID=%s seqNo=%d orch=%s", nonce, cxn.mid, seg.SeqNo, sess.OrchestratorInfo.Transcoder)
+			cxn.sessManager.evictSession(sess)
+			if monitor.Enabled {
+				monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorSigCheck, nonce, seg.SeqNo, errPMCheckFailed, false)
+			}
+			return errPMCheckFailed
+		}
+
+		// Only renditions that passed the checks above reach the playlists
+		for i, url := range urls {
+			if url == "" {
+				continue
 			}
+			pixels := res.Segments[i].Pixels
 
 			// If running in on-chain mode, run pixels verification asynchronously
-			if sess.Sender != nil {
-				go func() {
+			if onchain {
+				go func(url string, pixels int64) {
 					if err := verifyPixels(url, sess.BroadcasterOS, pixels); err != nil {
 						glog.Error(err)
 						cxn.sessManager.removeSession(sess)
 					}
-				}()
+				}(url, pixels)
 			}
 
 			if monitor.Enabled {
-				monitor.TranscodedSegmentAppeared(nonce, seg.SeqNo, sess.Profiles[i].Name)
+				monitor.TranscodedSegmentAppeared(nonce, seg.SeqNo, profiles[i].Name)
 			}
-			err = cpl.InsertHLSSegment(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+			err = cpl.InsertHLSSegment(&profiles[i], seg.SeqNo, url, seg.Duration)
 			if err != nil {
 				errFunc(monitor.SegmentTranscodeErrorPlaylist, url, err)
-				return
+				continue
+			}
+			cxn.stats.renditionReady(profiles[i].Name, seg.SeqNo)
+			ev := segmentEvent(EventRenditionReady, cxn.mid, seg.SeqNo)
+			ev.Profile, ev.URL, ev.Duration = profiles[i].Name, url, seg.Duration
+			StreamEvents.send(ev)
+			if verify {
+				renditions[i] = &rendition{profile: profiles[i], url: url, data: segData[i], pixels: pixels}
 			}
 		}
-
-		for i, v := range res.Segments {
-			go dlFunc(v.Url, v.Pixels, i)
-		}
-
-		cond.L.Lock()
-		for n != 0 {
-			cond.Wait()
-		}
-		cond.L.Unlock()
-		if dlErr != nil {
-			return dlErr
-		}
-		ticketParams := sess.OrchestratorInfo.GetTicketParams()
-		if ticketParams != nil && // may be nil in offchain mode
-			saveErr == nil && // save error leads to early exit before sighash computation
-			// Might not have seg hashes if results are directly uploaded to the broadcaster's OS
-			// TODO: Consider downloading the results to generate seg hashes if results are directly uploaded to the broadcaster's OS
-			len(segHashes) != len(res.Segments) &&
-			!pm.VerifySig(ethcommon.BytesToAddress(ticketParams.Recipient), crypto.Keccak256(segHashes...), res.Sig) {
-			glog.Errorf("Sig check failed for segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+		if len(missing) > 0 {
+			// Try another orchestrator for the rest
 			cxn.sessManager.removeSession(sess)
-			return errPMCheckFailed
+			err := &partialTranscodeError{profiles: missing}
+			if monitor.Enabled {
+				monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorPartial, nonce, seg.SeqNo, err, false)
+			}
+			return err
+		}
+		// Only back in the pool once the whole result checked out
+		cxn.sessManager.completeSession(sess)
+		if verify {
+			go verifySegment(cxn, sess, seg, renditions)
 		}
 		if monitor.Enabled {
-			monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, common.ProfilesNames(sess.Profiles), errCode)
+			monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, common.ProfilesNames(profiles), errCode)
 		}
+		cxn.stats.segmentTranscoded()
 
 		glog.V(common.DEBUG).Infof("Successfully validated segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
 		return nil
 	}
 }
 
-var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error()}
+// verifySegSig checks that the orchestrator signed the hashes of the
+// renditions it returned, in order, skipping failed ones
+func verifySegSig(sess *BroadcastSession, res *net.TranscodeData, segHashes [][]byte) bool {
+	ticketParams := sess.OrchestratorInfo.GetTicketParams()
+	if ticketParams == nil {
+		return false
+	}
+	hashes := make([][]byte, 0, len(segHashes))
+	for i, v := range res.Segments {
+		if v.Error != "" {
+			continue
+		}
+		if segHashes[i] == nil {
+			return false
+		}
+		hashes = append(hashes, segHashes[i])
+	}
+	return pm.VerifySig(ethcommon.BytesToAddress(ticketParams.Recipient), crypto.Keccak256(hashes...), res.Sig)
+}
+
+var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error(), core.ErrOrchDraining.Error()}
 
 var sessionErrRegex = common.GenErrRegex(sessionErrStrings)
 
@@ -460,10 +856,15 @@ func shouldStopSession(err error) bool {
 	return sessionErrRegex.MatchString(err.Error())
 }
 
+// localOSSession is implemented by OS sessions that keep data on this node
+type localOSSession interface {
+	GetData(name string) []byte
+}
+
 func verifyPixels(fname string, bos drivers.OSSession, reportedPixels int64) error {
 	uri, err := url.ParseRequestURI(fname)
-	memOS, ok := bos.(*drivers.MemorySession)
-	// If the filename is a relative URI and the broadcaster is using local memory storage
+	localOS, ok := bos.(localOSSession)
+	// If the filename is a relative URI and the broadcaster is using local memory or disk storage
 	// fetch the data and write it to a temp file
 	if err == nil && !uri.IsAbs() && ok {
 		tempfile, err := ioutil.TempFile("", common.RandName())
@@ -472,12 +873,12 @@ func verifyPixels(fname string, bos drivers.OSSession, reportedPixels int64) err
 		}
 		defer os.Remove(tempfile.Name())
 
-		data := memOS.GetData(fname)
+		data := localOS.GetData(fname)
 		if data == nil {
-			return errors.New("error fetching data from local memory storage")
+			return errors.New("error fetching data from local storage")
 		}
 
-		if _, err := tempfile.Write(memOS.GetData(fname)); err != nil {
+		if _, err := tempfile.Write(data); err != nil {
 			return fmt.Errorf("error writing temp file for pixels verification: %v", err)
 		}
 
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/protobuf/proto"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
@@ -47,6 +51,8 @@ func bsmWithSessList(sessList []*BroadcastSession) *BroadcastSessionsManager {
 	return &BroadcastSessionsManager{
 		sessList: sessList,
 		sessMap:  sessMap,
+		cooling:  make(map[string]*BroadcastSession),
+		stats:    make(map[string]*sessionStats),
 		sessLock: &sync.Mutex{},
 		createSessions: func() ([]*BroadcastSession, error) {
 			return sessList, nil
@@ -88,6 +94,7 @@ func TestStopSessionErrors(t *testing.T) {
 		"Unable to submit segment 5 Post https://127.0.0.1:8936/segment: dial tcp 127.0.0.1:8936: getsockopt: connection refused",
 		core.ErrOrchBusy.Error(),
 		core.ErrOrchCap.Error(),
+		core.ErrOrchDraining.Error(),
 	}
 
 	// Sanity check that we're checking each failure case
@@ -162,20 +169,17 @@ func TestSelectSession(t *testing.T) {
 	assert := assert.New(t)
 	assert.Len(bsm.sessList, 2)
 	assert.Len(bsm.sessMap, 2)
-	expectedSess1 := bsm.sessList[1]
-	expectedSess2 := bsm.sessList[0]
+	expected := []*BroadcastSession{bsm.sessList[0], bsm.sessList[1]}
 
-	// assert last session selected and sessList is correct length
-	sess := bsm.selectSession()
-	assert.Equal(expectedSess1, sess)
+	// assert each session is selected once and sessList shrinks accordingly
+	sess1 := bsm.selectSession()
 	assert.Len(bsm.sessList, 1)
-
-	sess = bsm.selectSession()
-	assert.Equal(expectedSess2, sess)
+	sess2 := bsm.selectSession()
 	assert.Len(bsm.sessList, 0)
+	assert.ElementsMatch(expected, []*BroadcastSession{sess1, sess2})
 
 	// assert no session is selected from empty list
-	sess = bsm.selectSession()
+	sess := bsm.selectSession()
 	assert.Nil(sess)
 	assert.Len(bsm.sessList, 0)
 	assert.Len(bsm.sessMap, 2) // map should still track original sessions
@@ -188,31 +192,111 @@ func TestSelectSession(t *testing.T) {
 	bsm.selectSession()
 	assert.True(wgWait(&wg), "Session refresh timed out")
 
-	// assert the selection retries if session in list doesn't exist in map
+	// assert the selection skips sessions in the list that don't exist in map
 	bsm = StubBroadcastSessionsManager()
+	staleSess := bsm.sessList[1]
+	expectedSess := bsm.sessList[0]
+	delete(bsm.sessMap, staleSess.OrchestratorInfo.Transcoder)
 	assert.Len(bsm.sessList, 2)
-	assert.Len(bsm.sessMap, 2)
-	// sanity checks then rebuild in order
-	firstSess := bsm.selectSession()
-	expectedSess := bsm.selectSession()
+	sess = bsm.selectSession()
+	assert.Equal(expectedSess, sess)
 	assert.Len(bsm.sessList, 0)
-	assert.Len(bsm.sessMap, 2)
-	bsm.completeSession(expectedSess)
-	bsm.completeSession(firstSess)
-	// remove first sess from map, but keep in list. check results around that
-	bsm.removeSession(firstSess)
-	assert.Len(bsm.sessList, 2)
 	assert.Len(bsm.sessMap, 1)
-	assert.Equal(firstSess, bsm.sessList[1]) // ensure removed sess still in list
-	// now ensure next selectSession call fixes up sessList as expected
+
+	// assert sessions replaced in the map by a refresh aren't selected
+	bsm = StubBroadcastSessionsManager()
+	staleSess = bsm.sessList[1]
+	expectedSess = bsm.sessList[0]
+	bsm.sessMap[staleSess.OrchestratorInfo.Transcoder] = StubBroadcastSession(staleSess.OrchestratorInfo.Transcoder)
 	sess = bsm.selectSession()
-	assert.Equal(sess, expectedSess)
+	assert.Equal(expectedSess, sess)
 	assert.Len(bsm.sessList, 0)
-	assert.Len(bsm.sessMap, 1)
 
 	// XXX check refresh condition more precisely - currently numOrchs / 2
 }
 
+func TestSelectSession_Weighted(t *testing.T) {
+	assert := assert.New(t)
+	rand.Seed(321)
+
+	bsm := StubBroadcastSessionsManager()
+	good := bsm.sessList[0]
+	bad := bsm.sessList[1]
+	bsm.statsFor(good).success(10*time.Millisecond, 100*time.Millisecond)
+	for i := 0; i < 20; i++ {
+		bsm.statsFor(bad).success(time.Second, 5*time.Second)
+		bsm.statsFor(bad).successRate = 0.1
+	}
+	assert.True(bsm.statsFor(good).score() > bsm.statsFor(bad).score())
+
+	counts := make(map[*BroadcastSession]int)
+	for i := 0; i < 1000; i++ {
+		sess := bsm.selectSession()
+		counts[sess]++
+		// Put it back without updating the stats
+		bsm.sessList = append(bsm.sessList, sess)
+	}
+	assert.True(counts[good] > 900, "good session selected %d times", counts[good])
+	// Low scoring sessions are still selected occasionally
+	assert.True(counts[bad] > 0)
+
+	// Untried sessions are preferred over slow ones
+	fresh := StubBroadcastSession("transcoder3")
+	bsm.sessList = []*BroadcastSession{bad, fresh}
+	bsm.sessMap[fresh.OrchestratorInfo.Transcoder] = fresh
+	counts = make(map[*BroadcastSession]int)
+	for i := 0; i < 100; i++ {
+		sess := bsm.selectSession()
+		counts[sess]++
+		bsm.sessList = append(bsm.sessList, sess)
+	}
+	assert.True(counts[fresh] > counts[bad])
+}
+
+func TestSessionStats(t *testing.T) {
+	assert := assert.New(t)
+	oldCooldown, oldMaxCooldown := sessionCooldown, maxSessionCooldown
+	defer func() { sessionCooldown, maxSessionCooldown = oldCooldown, oldMaxCooldown }()
+	sessionCooldown = time.Second
+	maxSessionCooldown = 3 * time.Second
+
+	s := newSessionStats()
+	assert.Equal(1.0, s.score())
+
+	// First sample sets latencies directly, later ones are averaged
+	s.success(time.Second, 2*time.Second)
+	assert.Equal(time.Second, s.uploadLatency)
+	assert.Equal(2*time.Second, s.transcodeLatency)
+	assert.Equal(1.0, s.successRate)
+	assert.InDelta(1/(1+3/SegLen.Seconds()), s.score(), 0.0001)
+	s.success(0, 0)
+	assert.Equal(800*time.Millisecond, s.uploadLatency)
+	assert.Equal(1600*time.Millisecond, s.transcodeLatency)
+
+	// Failures lower the success rate and lengthen the cooldown
+	now := time.Now()
+	s.failure(now)
+	assert.InDelta(0.8, s.successRate, 0.0001)
+	assert.Equal(1, s.failures)
+	assert.Equal(now.Add(time.Second), s.cooldownUntil)
+	s.failure(now)
+	assert.Equal(now.Add(2*time.Second), s.cooldownUntil)
+	s.failure(now)
+	assert.Equal(now.Add(3*time.Second), s.cooldownUntil)
+	s.failure(now)
+	assert.Equal(now.Add(3*time.Second), s.cooldownUntil)
+
+	// Success resets consecutive failures
+	s.success(0, 0)
+	assert.Equal(0, s.failures)
+
+	// Score never drops to zero
+	for i := 0; i < 100; i++ {
+		s.failure(now)
+	}
+	assert.Equal(minSessionScore, s.score())
+}
+
 func TestRemoveSession(t *testing.T) {
 	bsm := StubBroadcastSessionsManager()
 	sess1 := bsm.sessList[0]
@@ -221,23 +305,96 @@ func TestRemoveSession(t *testing.T) {
 	assert := assert.New(t)
 	assert.Len(bsm.sessMap, 2)
 
-	// remove session in map
+	// remove session in map; it is cooled down rather than discarded
 	assert.NotNil(bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
 	bsm.removeSession(sess1)
 	assert.Nil(bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
 	assert.Len(bsm.sessMap, 1)
+	assert.Len(bsm.sessList, 1)
+	assert.Equal(sess1, bsm.cooling[sess1.OrchestratorInfo.Transcoder])
+	assert.Equal(1, bsm.statsFor(sess1).failures)
 
 	// remove nonexistent session
 	assert.Nil(bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
 	bsm.removeSession(sess1)
 	assert.Nil(bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
 	assert.Len(bsm.sessMap, 1)
+	assert.Equal(1, bsm.statsFor(sess1).failures)
 
 	// remove last session in map
 	assert.NotNil(bsm.sessMap[sess2.OrchestratorInfo.Transcoder])
 	bsm.removeSession(sess2)
 	assert.Nil(bsm.sessMap[sess2.OrchestratorInfo.Transcoder])
 	assert.Len(bsm.sessMap, 0)
+	assert.Len(bsm.sessList, 0)
+	assert.Len(bsm.cooling, 2)
+
+	// sessions in cooldown aren't selected
+	assert.Nil(bsm.selectSession())
+
+	// sessions are readmitted once the cooldown expires
+	bsm.statsFor(sess1).cooldownUntil = time.Now().Add(-time.Second)
+	assert.Equal(sess1, bsm.selectSession())
+	assert.Len(bsm.cooling, 1)
+	assert.Equal(sess1, bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
+
+	// refreshes don't bring back sessions in cooldown
+	bsm.createSessions = func() ([]*BroadcastSession, error) {
+		return []*BroadcastSession{StubBroadcastSession(sess2.OrchestratorInfo.Transcoder)}, nil
+	}
+	bsm.refreshSessions()
+	assert.Nil(bsm.sessMap[sess2.OrchestratorInfo.Transcoder])
+	assert.Len(bsm.cooling, 1)
+
+	// but replace them once the cooldown expires
+	bsm.statsFor(sess2).cooldownUntil = time.Now().Add(-time.Second)
+	bsm.refreshSessions()
+	refreshed := bsm.sessMap[sess2.OrchestratorInfo.Transcoder]
+	assert.NotNil(refreshed)
+	assert.NotEqual(sess2, refreshed)
+	assert.Len(bsm.cooling, 0)
+	// stats carry over to the new session
+	assert.Equal(1, bsm.statsFor(refreshed).failures)
+
+	// nothing is cooled down after cleanup
+	bsm.cleanup()
+	bsm.removeSession(refreshed)
+	assert.Len(bsm.cooling, 0)
+}
+
+func TestEvictSession(t *testing.T) {
+	bsm := StubBroadcastSessionsManager()
+	sess1 := bsm.sessList[0]
+	sess2 := bsm.sessList[1]
+	key := sess1.OrchestratorInfo.Transcoder
+
+	assert := assert.New(t)
+	bsm.evictSession(sess1)
+	assert.Nil(bsm.sessMap[key])
+	assert.Len(bsm.sessList, 1)
+	assert.Len(bsm.cooling, 0)
+	assert.Equal(1, bsm.statsFor(sess1).failures)
+
+	// sessions already cooling down are evicted too
+	bsm.removeSession(sess2)
+	assert.Len(bsm.cooling, 1)
+	bsm.evictSession(sess2)
+	assert.Len(bsm.cooling, 0)
+	assert.Equal(1, bsm.statsFor(sess2).failures)
+
+	// refreshes never bring evicted orchestrators back
+	bsm.createSessions = func() ([]*BroadcastSession, error) {
+		return []*BroadcastSession{StubBroadcastSession(key), StubBroadcastSession("transcoder3")}, nil
+	}
+	for i := 0; i < 3; i++ {
+		bsm.refreshSessions()
+		sess := bsm.selectSession()
+		if assert.NotNil(sess) {
+			assert.Equal("transcoder3", sess.OrchestratorInfo.Transcoder)
+			bsm.completeSession(sess)
+		}
+	}
+	assert.Nil(bsm.sessMap[key])
 }
 
 func TestCompleteSessions(t *testing.T) {
@@ -249,6 +406,8 @@ func TestCompleteSessions(t *testing.T) {
 	assert.Len(bsm.sessList, 1)
 	assert.Len(bsm.sessMap, 2)
 
+	sess1.uploadDur = 100 * time.Millisecond
+	sess1.transcodeDur = time.Second
 	bsm.completeSession(sess1)
 
 	// assert that session already in sessMap is added back to sessList
@@ -256,16 +415,18 @@ func TestCompleteSessions(t *testing.T) {
 	assert.Len(bsm.sessMap, 2)
 	assert.Equal(sess1, bsm.sessMap[sess1.OrchestratorInfo.Transcoder])
 
-	// assert that we get the same session back next time we call select
-	newSess := bsm.selectSession()
-	assert.Equal(sess1, newSess)
-	bsm.completeSession(newSess)
+	// assert that the timings were recorded
+	stats := bsm.statsFor(sess1)
+	assert.Equal(1, stats.samples)
+	assert.Equal(100*time.Millisecond, stats.uploadLatency)
+	assert.Equal(time.Second, stats.transcodeLatency)
 
 	// assert that session not in sessMap is not added to sessList
 	sess3 := StubBroadcastSession("transcoder3")
 	bsm.completeSession(sess3)
 	assert.Len(bsm.sessList, 2)
 	assert.Len(bsm.sessMap, 2)
+	assert.Equal(0, bsm.statsFor(sess3).samples)
 }
 
 func TestRefreshSessions(t *testing.T) {
@@ -366,6 +527,182 @@ func TestCleanupSessions(t *testing.T) {
 	assert.Len(bsm.sessMap, 0)
 }
 
+func TestSegmentRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p := SegmentRetryPolicy{DeadlineFactor: 2, Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	assert.Equal(3*time.Second, p.deadline(1.5))
+	// Missing durations fall back to the default segment length
+	assert.Equal(2*SegLen, p.deadline(0))
+	p.DeadlineFactor = 0
+	assert.Equal(time.Duration(0), p.deadline(1.5))
+
+	assert.Equal(100*time.Millisecond, p.backoff(1))
+	assert.Equal(200*time.Millisecond, p.backoff(2))
+	assert.Equal(300*time.Millisecond, p.backoff(3))
+	assert.Equal(300*time.Millisecond, p.backoff(10))
+	p.MaxBackoff = 0
+	assert.Equal(400*time.Millisecond, p.backoff(3))
+}
+
+func TestProcessSegment_RetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	oldPolicy := SegmentRetry
+	defer func() { SegmentRetry = oldPolicy }()
+
+	var mu sync.Mutex
+	attempts := 0
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	getAttempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+
+	newCxn := func() *rtmpConnection {
+		var sessList []*BroadcastSession
+		for i := 0; i < 5; i++ {
+			sessList = append(sessList, StubBroadcastSession(fmt.Sprintf("%s/%d", ts.URL, i)))
+		}
+		mid := core.ManifestID("foo")
+		return &rtmpConnection{
+			mid:         mid,
+			nonce:       7,
+			pl:          core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))),
+			profile:     &ffmpeg.P144p30fps16x9,
+			sessManager: bsmWithSessList(sessList),
+		}
+	}
+
+	// Gives up after the maximum number of attempts
+	SegmentRetry = SegmentRetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	cxn := newCxn()
+	seg := &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2}
+	err := processSegment(cxn, seg)
+	assert.NotNil(err)
+	assert.Equal(3, getAttempts())
+	// Source segment is still in the playlist
+	assert.Equal(uint(1), cxn.pl.GetHLSMediaPlaylist(cxn.profile.Name).Count())
+
+	// Gives up once the deadline passes
+	attempts = 0
+	SegmentRetry = SegmentRetryPolicy{DeadlineFactor: 1, Backoff: 50 * time.Millisecond}
+	start := time.Now()
+	err = processSegment(newCxn(), &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 0.1})
+	assert.NotNil(err)
+	assert.True(getAttempts() >= 1 && getAttempts() < 5)
+	assert.True(time.Since(start) < 500*time.Millisecond)
+
+	// Runs out of orchestrators before running out of attempts
+	attempts = 0
+	SegmentRetry = SegmentRetryPolicy{MaxAttempts: 10, Backoff: time.Millisecond}
+	err = processSegment(newCxn(), &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2})
+	assert.Nil(err)
+	assert.Equal(5, getAttempts())
+}
+
+func TestProcessSegment_PartialResults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
+
+	oldPolicy := SegmentRetry
+	defer func() { SegmentRetry = oldPolicy }()
+	SegmentRetry = SegmentRetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	// The first orchestrator fails the first profile; the next one gets
+	// asked for that profile only
+	var mu sync.Mutex
+	var requested [][]ffmpeg.VideoProfile
+	short := false // leave out the last rendition
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := base64.StdEncoding.DecodeString(r.Header.Get(segmentHeader))
+		var segData net.SegData
+		require.Nil(proto.Unmarshal(buf, &segData))
+		assert.True(segData.PartialResults)
+		segProfiles, err := common.DecodeProfiles(segData.Profiles, segData.FullProfiles)
+		require.Nil(err)
+		mu.Lock()
+		requested = append(requested, segProfiles)
+		first := len(requested) == 1
+		mu.Unlock()
+		var segs []*net.TranscodedSegmentData
+		for i, p := range segProfiles {
+			if first && i == 0 {
+				segs = append(segs, &net.TranscodedSegmentData{Error: "ZeroSegments"})
+				continue
+			}
+			segs = append(segs, &net.TranscodedSegmentData{Url: p.Name + ".ts"})
+		}
+		if short {
+			segs = segs[:len(segs)-1]
+		}
+		buf, err = proto.Marshal(&net.TranscodeResult{Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Segments: segs}}})
+		require.Nil(err)
+		w.Write(buf)
+	})
+
+	newCxn := func(numOrchs int) *rtmpConnection {
+		var sessList []*BroadcastSession
+		for i := 0; i < numOrchs; i++ {
+			sess := StubBroadcastSession(fmt.Sprintf("%s/%d", ts.URL, i))
+			sess.Profiles = profiles
+			sessList = append(sessList, sess)
+		}
+		mid := core.ManifestID("foo")
+		return &rtmpConnection{
+			mid:         mid,
+			nonce:       7,
+			pl:          core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))),
+			profile:     &ffmpeg.P720p30fps16x9,
+			sessManager: bsmWithSessList(sessList),
+		}
+	}
+	cxn := newCxn(2)
+	err := processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2})
+	assert.Nil(err)
+
+	require.Len(requested, 2)
+	assert.Equal(profiles, requested[0])
+	assert.Equal(profiles[:1], requested[1])
+	for _, p := range profiles {
+		pl := cxn.pl.GetHLSMediaPlaylist(p.Name)
+		require.NotNil(pl)
+		assert.Equal(uint(1), pl.Count())
+	}
+	// The orchestrator that failed a profile is not used again right away
+	assert.Len(cxn.sessManager.sessList, 1)
+
+	// The segment fails if no orchestrator is left for the missing profiles
+	requested = nil
+	cxn = newCxn(1)
+	err = processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2})
+	assert.Equal(errNoOrchs, err)
+	assert.Len(requested, 1)
+	assert.Nil(cxn.pl.GetHLSMediaPlaylist(profiles[0].Name))
+	assert.Equal(uint(1), cxn.pl.GetHLSMediaPlaylist(profiles[1].Name).Count())
+
+	// Responses that don't have a rendition for every profile fail the
+	// session without inserting anything
+	requested, short = nil, true
+	cxn = newCxn(1)
+	err = transcodeSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2}, "dummy", nil)
+	assert.EqualError(err, "orchestrator returned 1 renditions for 2 profiles")
+	for _, p := range profiles {
+		assert.Nil(cxn.pl.GetHLSMediaPlaylist(p.Name))
+	}
+	assert.Len(cxn.sessManager.cooling, 1)
+}
+
 // Note: Add processSegment tests, including:
 //     assert an error from transcoder removes sess from BroadcastSessionManager
 //     assert a success re-adds sess to BroadcastSessionManager
@@ -374,32 +711,43 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
 
+	// The orchestrator signs the rendition, which is always fetched in on-chain mode
+	data, err := ioutil.ReadFile("test.flv")
+	require.Nil(err)
+	orch := newStubOrchestrator()
+	sig, err := orch.Sign(ethcrypto.Keccak256(data))
+	require.Nil(err)
+
 	dummyRes := func(tSegData []*net.TranscodedSegmentData) *net.TranscodeResult {
 		return &net.TranscodeResult{
 			Result: &net.TranscodeResult_Data{
 				Data: &net.TranscodeData{
 					Segments: tSegData,
-					Sig:      []byte("bar"),
+					Sig:      sig,
 				},
 			},
 		}
 	}
 
-	// Create stub response with incorrect reported pixels
-	tSegData := []*net.TranscodedSegmentData{
-		&net.TranscodedSegmentData{Url: "test.flv", Pixels: 100},
-	}
-	tr := dummyRes(tSegData)
-	buf, err := proto.Marshal(tr)
-	require.Nil(err)
-
 	// Create stub server
 	ts, mux := stubTLSServer()
 	defer ts.Close()
+	var buf []byte
 	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write(buf)
 	})
+	mux.HandleFunc("/test.flv", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+
+	// Create stub response with incorrect reported pixels
+	tSegData := []*net.TranscodedSegmentData{
+		&net.TranscodedSegmentData{Url: ts.URL + "/test.flv", Pixels: 100},
+	}
+	tr := dummyRes(tSegData)
+	buf, err = proto.Marshal(tr)
+	require.Nil(err)
 
 	sess := StubBroadcastSession(ts.URL)
 	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
@@ -412,7 +760,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 		sessManager: bsm,
 	}
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish (or in this case we are just making sure that it did NOT run)
@@ -423,11 +771,13 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	assert.True(ok)
 
 	sess.OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}
+	sess.OrchestratorInfo.TicketParams = &net.TicketParams{Recipient: orch.Address().Bytes()}
 	sess.Sender = &pm.MockSender{}
+	sess.BroadcasterOS = drivers.NewMemoryDriver(nil).NewSession("foo")
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish
@@ -441,7 +791,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	p, err := pixels("test.flv")
 	require.Nil(err)
 	tSegData = []*net.TranscodedSegmentData{
-		&net.TranscodedSegmentData{Url: "test.flv", Pixels: p},
+		&net.TranscodedSegmentData{Url: ts.URL + "/test.flv", Pixels: p},
 	}
 	tr = dummyRes(tSegData)
 	buf, err = proto.Marshal(tr)
@@ -450,7 +800,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish
@@ -461,6 +811,144 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	assert.True(ok)
 }
 
+func TestTranscodeSegment_VerifySig(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	orch := newStubOrchestrator()
+	data := []byte("rendition")
+	sig, err := orch.Sign(ethcrypto.Keccak256(data))
+	require.Nil(err)
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	var tSegData []*net.TranscodedSegmentData
+	var resSig []byte
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		buf, err := proto.Marshal(&net.TranscodeResult{
+			Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Segments: tSegData, Sig: resSig}},
+		})
+		require.Nil(err)
+		w.Write(buf)
+	})
+	mux.HandleFunc("/rendition.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+
+	var pl core.PlaylistManager
+	var bsm *BroadcastSessionsManager
+	inserted := func() bool {
+		for _, p := range []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9} {
+			mpl := pl.GetHLSMediaPlaylist(p.Name)
+			if mpl != nil && strings.Contains(mpl.String(), "rendition.ts") {
+				return true
+			}
+		}
+		return false
+	}
+	transcode := func(sess *BroadcastSession) (error, bool, bool) {
+		sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
+		bsm = bsmWithSessList([]*BroadcastSession{sess})
+		pl = core.NewBasicPlaylistManager(core.ManifestID("foo"), drivers.NewMemoryDriver(nil).NewSession("foo"))
+		cxn := &rtmpConnection{
+			mid:         core.ManifestID("foo"),
+			pl:          pl,
+			profile:     &ffmpeg.P144p30fps16x9,
+			sessManager: bsm,
+		}
+		err := transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+		bsm.sessLock.Lock()
+		defer bsm.sessLock.Unlock()
+		_, cooling := bsm.cooling[sess.OrchestratorInfo.Transcoder]
+		return err, cooling, bsm.evicted[sess.OrchestratorInfo.Transcoder]
+	}
+	onchainSess := func() *BroadcastSession {
+		sess := StubBroadcastSession(ts.URL)
+		sess.OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}
+		sess.OrchestratorInfo.TicketParams = &net.TicketParams{Recipient: orch.Address().Bytes()}
+		sess.Sender = &pm.MockSender{}
+		return sess
+	}
+
+	// Results uploaded straight to the broadcaster's storage are fetched and hashed
+	tSegData = []*net.TranscodedSegmentData{
+		&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+		&net.TranscodedSegmentData{Error: "ZeroSegments"},
+	}
+	resSig = sig
+	err, _, _ = transcode(onchainSess())
+	assert.IsType(&partialTranscodeError{}, err)
+	assert.True(inserted())
+
+	// Results downloaded into the broadcaster's storage
+	sess := onchainSess()
+	sess.BroadcasterOS = drivers.NewMemoryDriver(nil).NewSession("foo")
+	err, _, _ = transcode(sess)
+	assert.IsType(&partialTranscodeError{}, err)
+
+	// Bad sig; the orchestrator is evicted rather than cooled down, and
+	// nothing it returned reaches the playlist
+	resSig = []byte("bar")
+	sess = onchainSess()
+	err, cooling, evicted := transcode(sess)
+	assert.Equal(errPMCheckFailed, err)
+	assert.False(cooling)
+	assert.True(evicted)
+	assert.False(inserted())
+	// and isn't credited with a successful segment
+	assert.Equal(1, bsm.statsFor(sess).samples)
+	assert.Equal(1, bsm.statsFor(sess).failures)
+
+	// Signed by someone else
+	resSig, err = newStubOrchestrator().Sign(ethcrypto.Keccak256(data))
+	require.Nil(err)
+	err, cooling, evicted = transcode(onchainSess())
+	assert.Equal(errPMCheckFailed, err)
+	assert.False(cooling)
+	assert.True(evicted)
+
+	// No recipient to check against
+	resSig = sig
+	sess = onchainSess()
+	sess.OrchestratorInfo.TicketParams = nil
+	err, cooling, evicted = transcode(sess)
+	assert.Equal(errPMCheckFailed, err)
+	assert.False(cooling)
+	assert.True(evicted)
+
+	// Signed a different set of renditions
+	tSegData = []*net.TranscodedSegmentData{
+		&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+		&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+	}
+	err, cooling, evicted = transcode(onchainSess())
+	assert.Equal(errPMCheckFailed, err)
+	assert.False(cooling)
+	assert.True(evicted)
+
+	// Failing to fetch a rendition isn't a sig failure
+	tSegData = []*net.TranscodedSegmentData{
+		&net.TranscodedSegmentData{Url: ts.URL + "/nonexistent.ts"},
+		&net.TranscodedSegmentData{Error: "ZeroSegments"},
+	}
+	err, cooling, evicted = transcode(onchainSess())
+	assert.NotNil(err)
+	assert.NotEqual(errPMCheckFailed, err)
+	assert.True(cooling)
+	assert.False(evicted)
+
+	// Sigs aren't checked in off-chain mode
+	resSig = []byte("bar")
+	tSegData = []*net.TranscodedSegmentData{
+		&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+		&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+	}
+	err, cooling, evicted = transcode(StubBroadcastSession(ts.URL))
+	assert.Nil(err)
+	assert.False(cooling)
+	assert.False(evicted)
+}
+
 func TestPixels(t *testing.T) {
 	ffmpeg.InitFFmpeg()
 
@@ -498,7 +986,7 @@ func TestVerifyPixels(t *testing.T) {
 	// Test error for relative URI and local memory storage if the file does not exist in storage
 	// Will try to use the relative URI to read the file from storage and fail
 	err = verifyPixels("/stream/bar/dne.ts", bos, 50)
-	assert.EqualError(err, "error fetching data from local memory storage")
+	assert.EqualError(err, "error fetching data from local storage")
 
 	// Test writing temp file for relative URI and local memory storage with incorrect pixels
 	err = verifyPixels(fname, bos, 50)
@@ -5,12 +5,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"runtime"
 	"testing"
 	"time"
 
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,7 +23,7 @@ func newMockServer() *httptest.Server {
 	n.NodeType = core.TranscoderNode
 	n.TranscoderManager = core.NewRemoteTranscoderManager()
 	strm := &common.StubServerStream{}
-	go func() { n.TranscoderManager.Manage(strm, 5) }()
+	go func() { n.TranscoderManager.Manage(strm, 5, nil, "", false) }()
 	time.Sleep(1 * time.Millisecond)
 	n.Transcoder = n.TranscoderManager
 	s := NewLivepeerServer("127.0.0.1:1938", n)
@@ -40,7 +43,15 @@ func TestGetStatus(t *testing.T) {
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	req.Nil(err)
-	expected := fmt.Sprintf(`{"Manifests":{},"OrchestratorPool":[],"Version":"undefined","GolangRuntimeVersion":"%s","GOArch":"%s","GOOS":"%s","RegisteredTranscodersNumber":1,"RegisteredTranscoders":[{"Address":"TestAddress","Capacity":5}],"LocalTranscoding":false}`,
+	// connection time varies
+	lastSeen := regexp.MustCompile(`"LastSeen":"[^"]+"`)
+	assert.Regexp(lastSeen, string(body))
+	body = lastSeen.ReplaceAll(body, []byte(`"LastSeen":""`))
+	// and so does the connection ID
+	id := regexp.MustCompile(`"ID":"[0-9a-f]{32}"`)
+	assert.Regexp(id, string(body))
+	body = id.ReplaceAll(body, []byte(`"ID":""`))
+	expected := fmt.Sprintf(`{"Manifests":{},"OrchestratorPool":[],"Version":"undefined","GolangRuntimeVersion":"%s","GOArch":"%s","GOOS":"%s","RegisteredTranscodersNumber":1,"RegisteredTranscoders":[{"ID":"","Address":"TestAddress","Capacity":5,"Load":0,"Completed":0,"Failures":0,"Timeouts":0,"AvgTranscodeTime":0,"LastSeen":""}],"LocalTranscoding":false}`,
 		runtime.Version(), runtime.GOARCH, runtime.GOOS)
 	assert.Equal(expected, string(body))
 }
@@ -86,3 +97,31 @@ func TestGetDelegatorInfo(t *testing.T) {
 	req.Nil(err)
 	assert.Equal("{}", string(body))
 }
+
+func TestSetBroadcastConfig_Profiles(t *testing.T) {
+	assert := assert.New(t)
+	srv := newMockServer()
+	defer srv.Close()
+	defer func(profiles []ffmpeg.VideoProfile) { BroadcastJobVideoProfiles = profiles }(BroadcastJobVideoProfiles)
+
+	setConfig := func(opts string) {
+		res, err := http.PostForm(fmt.Sprintf("%s/setBroadcastConfig", srv.URL), url.Values{
+			"maxPricePerUnit":    {"0"},
+			"pixelsPerUnit":      {"1"},
+			"transcodingOptions": {opts},
+		})
+		require.Nil(t, err)
+		res.Body.Close()
+	}
+
+	setConfig("P240p30fps16x9,P360p30fps16x9")
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}, BroadcastJobVideoProfiles)
+
+	setConfig(`[{"name":"custom","width":1280,"height":720,"bitrate":3000000,"fps":30}]`)
+	assert.Equal([]ffmpeg.VideoProfile{{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}}, BroadcastJobVideoProfiles)
+
+	// Invalid profiles leave the config as is
+	setConfig(`[{"name":"custom","width":1280,"height":720,"fps":30}]`)
+	assert.Equal("custom", BroadcastJobVideoProfiles[0].Name)
+	assert.Len(BroadcastJobVideoProfiles, 1)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// Stream lifecycle events
+const (
+	EventStreamStarted   = "stream.started"
+	EventSegmentSaved    = "segment.saved"
+	EventRenditionReady  = "rendition.ready"
+	EventTranscodeFailed = "transcode.failed"
+	EventStreamEnded     = "stream.ended"
+)
+
+// StreamEvents posts stream lifecycle events to the control plane. Nil if
+// no events URL is configured.
+var StreamEvents *EventWebhook
+
+// EventSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// keyed by the events secret
+const EventSignatureHeader = "Livepeer-Signature"
+
+// Number of times delivery of an event is attempted, and the wait before the
+// first retry, which doubles with each failure
+var EventAttempts = 3
+var EventRetryBackoff = 1 * time.Second
+
+type streamEvent struct {
+	Type       string          `json:"type"`
+	Timestamp  int64           `json:"timestamp"` // Unix time in ms
+	ManifestID core.ManifestID `json:"manifestID"`
+	SeqNo      *uint64         `json:"seqNo,omitempty"`
+	Profile    string          `json:"profile,omitempty"`
+	URL        string          `json:"url,omitempty"`
+	Duration   float64         `json:"duration,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func segmentEvent(typ string, mid core.ManifestID, seqNo uint64) *streamEvent {
+	return &streamEvent{Type: typ, ManifestID: mid, SeqNo: &seqNo}
+}
+
+// EventWebhook queues events and delivers them in order from a single
+// goroutine. Events are dropped if the queue is full.
+type EventWebhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan *streamEvent
+	quit   chan struct{}
+}
+
+func NewEventWebhook(url, secret string, queueSize int) *EventWebhook {
+	w := &EventWebhook{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan *streamEvent, queueSize),
+		quit:   make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Stop delivering events. Events still queued are discarded.
+func (w *EventWebhook) Stop() {
+	close(w.quit)
+}
+
+func (w *EventWebhook) loop() {
+	for {
+		select {
+		case ev := <-w.queue:
+			w.deliver(ev)
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// send queues an event without blocking the caller
+func (w *EventWebhook) send(ev *streamEvent) {
+	if w == nil {
+		return
+	}
+	ev.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	select {
+	case w.queue <- ev:
+	default:
+		glog.Errorf("Event queue full, dropping event type=%s manifestID=%s", ev.Type, ev.ManifestID)
+	}
+}
+
+func (w *EventWebhook) deliver(ev *streamEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		glog.Errorf("Error encoding event type=%s manifestID=%s: %v", ev.Type, ev.ManifestID, err)
+		return
+	}
+	backoff := EventRetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= EventAttempts {
+			glog.Errorf("Error sending event type=%s manifestID=%s attempts=%d: %v", ev.Type, ev.ManifestID, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.quit:
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// post returns whether a failed request should be retried
+func (w *EventWebhook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventSignatureHeader, w.sign(body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// The receiver rejected the event; only retry its own failures
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, nil
+}
+
+func (w *EventWebhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
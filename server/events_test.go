@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventReceiver records the events posted to it, failing the first few
+// requests with the given status
+type eventReceiver struct {
+	*httptest.Server
+	events chan *streamEvent
+	fail   int
+	status int
+}
+
+func newEventReceiver(t *testing.T) *eventReceiver {
+	r := &eventReceiver{events: make(chan *streamEvent, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.fail > 0 {
+			r.fail--
+			w.WriteHeader(r.status)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		require.Nil(t, err)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		var ev streamEvent
+		require.Nil(t, json.Unmarshal(body, &ev))
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), req.Header.Get(EventSignatureHeader))
+		r.events <- &ev
+	}))
+	return r
+}
+
+func (r *eventReceiver) next(t *testing.T) *streamEvent {
+	select {
+	case ev := <-r.events:
+		return ev
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return nil
+}
+
+func TestEventWebhook_Deliver(t *testing.T) {
+	assert := assert.New(t)
+	oldBackoff := EventRetryBackoff
+	EventRetryBackoff = time.Millisecond
+	defer func() { EventRetryBackoff = oldBackoff }()
+
+	recv := newEventReceiver(t)
+	defer recv.Close()
+	w := NewEventWebhook(recv.URL, "secret", 10)
+	defer w.Stop()
+
+	// Events arrive in order, signed
+	w.send(&streamEvent{Type: EventStreamStarted, ManifestID: "foo"})
+	ev := segmentEvent(EventRenditionReady, "foo", 0)
+	ev.Profile, ev.URL, ev.Duration = "P144p30fps16x9", "/stream/foo/P144p30fps16x9/0.ts", 2
+	w.send(ev)
+	started := recv.next(t)
+	assert.Equal(EventStreamStarted, started.Type)
+	assert.Equal(core.ManifestID("foo"), started.ManifestID)
+	assert.Nil(started.SeqNo)
+	assert.NotZero(started.Timestamp)
+	ready := recv.next(t)
+	assert.Equal(EventRenditionReady, ready.Type)
+	assert.Equal(uint64(0), *ready.SeqNo)
+	assert.Equal("P144p30fps16x9", ready.Profile)
+	assert.Equal("/stream/foo/P144p30fps16x9/0.ts", ready.URL)
+	assert.Equal(2.0, ready.Duration)
+
+	// Server errors are retried
+	recv.fail, recv.status = EventAttempts-1, http.StatusInternalServerError
+	w.send(&streamEvent{Type: EventStreamEnded, ManifestID: "foo"})
+	assert.Equal(EventStreamEnded, recv.next(t).Type)
+
+	// Up to a point
+	recv.fail = EventAttempts
+	w.send(&streamEvent{Type: EventStreamEnded, ManifestID: "bar"})
+	w.send(&streamEvent{Type: EventStreamEnded, ManifestID: "baz"})
+	assert.Equal(core.ManifestID("baz"), recv.next(t).ManifestID)
+
+	// Rejected events aren't
+	recv.fail, recv.status = 1, http.StatusBadRequest
+	w.send(&streamEvent{Type: EventStreamEnded, ManifestID: "bar"})
+	w.send(&streamEvent{Type: EventStreamEnded, ManifestID: "baz"})
+	assert.Equal(core.ManifestID("baz"), recv.next(t).ManifestID)
+	assert.Equal(0, recv.fail)
+}
+
+func TestEventWebhook_Queue(t *testing.T) {
+	assert := assert.New(t)
+
+	// Nothing to send to
+	var w *EventWebhook
+	w.send(&streamEvent{Type: EventStreamStarted})
+
+	block := make(chan struct{})
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var ev streamEvent
+		json.NewDecoder(req.Body).Decode(&ev)
+		received <- string(ev.ManifestID)
+		<-block
+	}))
+	defer ts.Close()
+	w = NewEventWebhook(ts.URL, "secret", 2)
+	defer w.Stop()
+
+	// The first event is in flight, two more fit in the queue
+	w.send(&streamEvent{ManifestID: "a"})
+	assert.Equal("a", <-received)
+	for _, mid := range []core.ManifestID{"b", "c", "d"} {
+		w.send(&streamEvent{ManifestID: mid})
+	}
+	close(block)
+	assert.Equal("b", <-received)
+	assert.Equal("c", <-received)
+	select {
+	case mid := <-received:
+		t.Error("Unexpected event ", mid)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	recv := newEventReceiver(t)
+	defer recv.Close()
+	StreamEvents = NewEventWebhook(recv.URL, "secret", 10)
+	defer func() {
+		StreamEvents.Stop()
+		StreamEvents = nil
+	}()
+
+	s := setupServer()
+	mid := core.ManifestID(t.Name())
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid})
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	ev := recv.next(t)
+	assert.Equal(EventStreamStarted, ev.Type)
+	assert.Equal(mid, ev.ManifestID)
+
+	// No orchestrators
+	assert.Nil(processSegment(cxn, &stream.HLSSegment{SeqNo: 3, Data: []byte("dummy"), Duration: 2}))
+	ev = recv.next(t)
+	assert.Equal(EventSegmentSaved, ev.Type)
+	assert.Equal(uint64(3), *ev.SeqNo)
+	assert.Equal("source", ev.Profile)
+	assert.Equal("/stream/"+string(mid)+"/source/3.ts", ev.URL)
+	assert.Equal(2.0, ev.Duration)
+	ev = recv.next(t)
+	assert.Equal(EventTranscodeFailed, ev.Type)
+	assert.Equal(uint64(3), *ev.SeqNo)
+	assert.Equal(errNoOrchs.Error(), ev.Error)
+
+	// Rendition comes back
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	buf, err := proto.Marshal(&net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{
+			&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+		}}},
+	})
+	require.Nil(err)
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf)
+	})
+	mux.HandleFunc("/rendition.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rendition"))
+	})
+	sess := StubBroadcastSession(ts.URL)
+	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	sess.BroadcasterOS = drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn.sessManager = bsmWithSessList([]*BroadcastSession{sess})
+	assert.Nil(processSegment(cxn, &stream.HLSSegment{SeqNo: 4, Data: []byte("dummy"), Duration: 2}))
+	assert.Equal(EventSegmentSaved, recv.next(t).Type)
+	ev = recv.next(t)
+	assert.Equal(EventRenditionReady, ev.Type)
+	assert.Equal(uint64(4), *ev.SeqNo)
+	assert.Equal("P144p30fps16x9", ev.Profile)
+	assert.Equal("/stream/"+string(mid)+"/P144p30fps16x9/4.ts", ev.URL)
+
+	require.Nil(removeRTMPStream(s, mid))
+	ev = recv.next(t)
+	assert.Equal(EventStreamEnded, ev.Type)
+	assert.Equal(mid, ev.ManifestID)
+}
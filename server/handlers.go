@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/pm"
 )
@@ -290,3 +294,210 @@ func ticketBrokerParamsHandler(client eth.LivepeerEthClient) http.Handler {
 		w.Write(data)
 	})
 }
+
+// drainHandler reports the orchestrator's drain mode. The mode is toggled
+// by passing the `draining` form param.
+func drainHandler(node *core.LivepeerNode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if node == nil || node.NodeType != core.OrchestratorNode {
+			respondWith400(w, "node is not an orchestrator")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			respondWith500(w, fmt.Sprintf("parse form error: %v", err))
+			return
+		}
+
+		if d := r.FormValue("draining"); d != "" {
+			draining, err := strconv.ParseBool(d)
+			if err != nil {
+				respondWith400(w, fmt.Sprintf("invalid draining param: %v", d))
+				return
+			}
+			node.SetDraining(draining)
+			glog.Infof("Orchestrator drain mode set to %v", draining)
+		}
+
+		draining, sessions := node.IsDraining()
+		status := struct {
+			Draining bool
+			Sessions int
+		}{
+			draining,
+			sessions,
+		}
+
+		data, err := json.Marshal(status)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse drain status: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+func transcoderTokensHandler(node *core.LivepeerNode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if node == nil || node.NodeType != core.OrchestratorNode {
+			respondWith400(w, "node is not an orchestrator")
+			return
+		}
+
+		names, err := node.TranscoderTokens()
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not list transcoder tokens: %v", err))
+			return
+		}
+
+		data, err := json.Marshal(names)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse transcoder tokens: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+func issueTranscoderTokenHandler(node *core.LivepeerNode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if node == nil || node.NodeType != core.OrchestratorNode {
+			respondWith400(w, "node is not an orchestrator")
+			return
+		}
+
+		name := r.FormValue("name")
+		token, err := node.IssueTranscoderToken(name)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not issue transcoder token: %v", err))
+			return
+		}
+		glog.Infof("Issued token for transcoder name=%s", name)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(token))
+	})
+}
+
+func revokeTranscoderTokenHandler(node *core.LivepeerNode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if node == nil || node.NodeType != core.OrchestratorNode {
+			respondWith400(w, "node is not an orchestrator")
+			return
+		}
+
+		name := r.FormValue("name")
+		if err := node.RevokeTranscoderToken(name); err != nil {
+			if err == core.ErrUnknownTranscoder {
+				respondWithError(w, fmt.Sprintf("unknown transcoder: %v", name), http.StatusNotFound)
+				return
+			}
+			respondWith500(w, fmt.Sprintf("could not revoke transcoder token: %v", err))
+			return
+		}
+		glog.Infof("Revoked token for transcoder name=%s", name)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Token revoked"))
+	})
+}
+
+func disconnectTranscoderHandler(node *core.LivepeerNode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if node == nil || node.NodeType != core.OrchestratorNode {
+			respondWith400(w, "node is not an orchestrator")
+			return
+		}
+
+		id := r.FormValue("id")
+		if node.TranscoderManager == nil || !node.TranscoderManager.DisconnectTranscoder(id) {
+			respondWithError(w, fmt.Sprintf("unknown transcoder: %v", id), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Transcoder disconnected"))
+	})
+}
+
+// Streams
+
+func localStreamsHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(s.LocalStreams())
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse streams: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+// endStreamHandler ends a live stream. Passing a `block` duration, eg `10m`,
+// also keeps the manifest ID from being published to again for that long.
+func endStreamHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mid := core.ManifestID(r.FormValue("manifestID"))
+		var block time.Duration
+		if b := r.FormValue("block"); b != "" {
+			var err error
+			if block, err = time.ParseDuration(b); err != nil || block < 0 {
+				respondWith400(w, fmt.Sprintf("invalid block param: %v", b))
+				return
+			}
+		}
+
+		if err := s.EndStream(mid, block); err != nil {
+			if err == errUnknownStream {
+				respondWithError(w, fmt.Sprintf("unknown stream: %v", mid), http.StatusNotFound)
+				return
+			}
+			respondWith500(w, fmt.Sprintf("could not end stream: %v", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Stream ended"))
+	})
+}
+
+// streamStatsHandler reports the figures for the stream whose manifest ID
+// follows /streamStats/ in the path
+func streamStatsHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mid := core.ManifestID(strings.TrimPrefix(r.URL.Path, "/streamStats/"))
+		if mid == "" {
+			respondWith400(w, "missing manifest ID")
+			return
+		}
+
+		stats, err := s.StreamStats(mid)
+		if err == errUnknownStream {
+			respondWithError(w, fmt.Sprintf("unknown stream: %v", mid), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not get stream stats: %v", err))
+			return
+		}
+
+		data, err := json.Marshal(stats)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse stream stats: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
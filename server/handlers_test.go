@@ -11,11 +11,16 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -647,6 +652,171 @@ func TestTicketBrokerParamsHandler_Success(t *testing.T) {
 	assert.Equal(unlockPeriod, params.UnlockPeriod)
 }
 
+func TestDrainHandler_NotOrchestrator(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.NodeType = core.BroadcasterNode
+	handler := drainHandler(n)
+
+	resp := httpGetResp(handler)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("node is not an orchestrator", strings.TrimSpace(string(body)))
+}
+
+func TestDrainHandler_InvalidParam(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.NodeType = core.OrchestratorNode
+	handler := drainHandler(n)
+
+	form := url.Values{"draining": {"maybe"}}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("invalid draining param: maybe", strings.TrimSpace(string(body)))
+	draining, _ := n.IsDraining()
+	assert.False(draining)
+}
+
+func TestDrainHandler_Success(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.NodeType = core.OrchestratorNode
+	handler := drainHandler(n)
+	assert := assert.New(t)
+
+	status := func(resp *http.Response) (draining bool) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		var s struct {
+			Draining bool
+			Sessions int
+		}
+		require.Nil(t, json.Unmarshal(body, &s))
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Zero(s.Sessions)
+		return s.Draining
+	}
+
+	assert.False(status(httpGetResp(handler)))
+
+	form := url.Values{"draining": {"true"}}
+	assert.True(status(httpPostFormResp(handler, strings.NewReader(form.Encode()))))
+	assert.True(status(httpGetResp(handler)))
+	select {
+	case <-n.Drained():
+	default:
+		t.Error("orchestrator without sessions was not drained")
+	}
+
+	form = url.Values{"draining": {"false"}}
+	assert.False(status(httpPostFormResp(handler, strings.NewReader(form.Encode()))))
+}
+
+func TestTranscoderTokenHandlers_NotOrchestrator(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.NodeType = core.BroadcasterNode
+	assert := assert.New(t)
+
+	for _, handler := range []http.Handler{transcoderTokensHandler(n), issueTranscoderTokenHandler(n), revokeTranscoderTokenHandler(n)} {
+		form := url.Values{"name": {"gpu1"}}
+		resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+		assert.Equal("node is not an orchestrator", strings.TrimSpace(string(body)))
+	}
+}
+
+func TestTranscoderTokenHandlers(t *testing.T) {
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(t, err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	n, _ := core.NewLivepeerNode(nil, "", dbh)
+	n.NodeType = core.OrchestratorNode
+	assert := assert.New(t)
+
+	list := func() []string {
+		resp := httpGetResp(transcoderTokensHandler(n))
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		var names []string
+		require.Nil(t, json.Unmarshal(body, &names))
+		return names
+	}
+	assert.Empty(list())
+
+	// issue
+	form := url.Values{"name": {"gpu1"}}
+	resp := httpPostFormResp(issueTranscoderTokenHandler(n), strings.NewReader(form.Encode()))
+	token, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	name, ok := core.NewOrchestrator(n).AuthenticateTranscoder(string(token))
+	assert.True(ok)
+	assert.Equal("gpu1", name)
+	assert.Equal([]string{"gpu1"}, list())
+
+	// duplicate name
+	resp = httpPostFormResp(issueTranscoderTokenHandler(n), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+
+	// revoke
+	resp = httpPostFormResp(revokeTranscoderTokenHandler(n), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Empty(list())
+	_, ok = core.NewOrchestrator(n).AuthenticateTranscoder(string(token))
+	assert.False(ok)
+
+	resp = httpPostFormResp(revokeTranscoderTokenHandler(n), strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal("unknown transcoder: gpu1", strings.TrimSpace(string(body)))
+}
+
+func TestDisconnectTranscoderHandler(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.NodeType = core.OrchestratorNode
+	n.TranscoderManager = core.NewRemoteTranscoderManager()
+	assert := assert.New(t)
+
+	strm := &common.StubServerStream{}
+	done := make(chan struct{})
+	go func() {
+		n.TranscoderManager.Manage(strm, 5, nil, "", false)
+		close(done)
+	}()
+	time.Sleep(1 * time.Millisecond)
+
+	form := url.Values{"id": {"nobody"}}
+	resp := httpPostFormResp(disconnectTranscoderHandler(n), strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal("unknown transcoder: nobody", strings.TrimSpace(string(body)))
+
+	// addresses aren't unique, so transcoders are only dropped by ID
+	form = url.Values{"id": {"TestAddress"}}
+	resp = httpPostFormResp(disconnectTranscoderHandler(n), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+
+	info := n.TranscoderManager.RegisteredTranscodersInfo()
+	require.Len(t, info, 1)
+	form = url.Values{"id": {info[0].ID}}
+	resp = httpPostFormResp(disconnectTranscoderHandler(n), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail("transcoder not disconnected")
+	}
+
+	// not an orchestrator
+	n.NodeType = core.BroadcasterNode
+	resp = httpPostFormResp(disconnectTranscoderHandler(n), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
 func httpPostFormResp(handler http.Handler, body io.Reader) *http.Response {
 	headers := map[string]string{
 		"Content-Type": "application/x-www-form-urlencoded",
@@ -677,3 +847,78 @@ func httpResp(handler http.Handler, method string, body io.Reader, headers map[s
 
 	return w.Result()
 }
+
+func TestLocalStreamsHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+
+	mid := core.ManifestID(t.Name())
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{
+		mid:        mid,
+		profiles:   []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9},
+		resolution: "1280x720",
+	})
+	_, err := s.registerConnection(strm)
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+
+	resp := httpGetResp(localStreamsHandler(s))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	var streams []StreamInfo
+	require.Nil(json.NewDecoder(resp.Body).Decode(&streams))
+	var info *StreamInfo
+	for i := range streams {
+		if streams[i].ManifestID == mid {
+			info = &streams[i]
+		}
+	}
+	require.NotNil(info)
+	assert.Equal([]string{"P144p30fps16x9", "P240p30fps16x9"}, info.Profiles)
+	assert.Equal("1280x720", info.Resolution)
+	assert.False(info.Started.IsZero())
+	assert.Nil(info.ExpiresAt)
+}
+
+func TestEndStreamHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	createSid := createRTMPStreamIDHandler(s)
+
+	mid := core.ManifestID(t.Name())
+	form := url.Values{"manifestID": {string(mid)}}
+	resp := httpPostFormResp(endStreamHandler(s), strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal("unknown stream: "+string(mid), strings.TrimSpace(string(body)))
+
+	// Ending a stream closes it
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid})
+	_, err := s.registerConnection(strm)
+	require.Nil(err)
+	resp = httpPostFormResp(endStreamHandler(s), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	s.connectionLock.RLock()
+	_, exists := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	assert.False(exists)
+	select {
+	case <-strm.EOF:
+	default:
+		assert.Fail("stream not closed")
+	}
+	u, _ := url.Parse("rtmp://localhost/" + string(mid))
+	assert.NotNil(createSid(u))
+
+	// Blocking keeps it from being published to again for a while
+	form.Set("block", "nonsense")
+	resp = httpPostFormResp(endStreamHandler(s), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	form.Set("block", "50ms")
+	resp = httpPostFormResp(endStreamHandler(s), strings.NewReader(form.Encode()))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Nil(createSid(u))
+	time.Sleep(60 * time.Millisecond)
+	assert.NotNil(createSid(u))
+}
@@ -14,9 +14,11 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -60,17 +62,33 @@ var BroadcastJobVideoProfiles = []ffmpeg.VideoProfile{ffmpeg.P240p30fps4x3, ffmp
 
 var AuthWebhookURL string
 
+// RecordStreams retains every segment of a stream and writes VOD playlists when it ends
+var RecordStreams = false
+
 type streamParameters struct {
 	mid        core.ManifestID
 	rtmpKey    string
 	profiles   []ffmpeg.VideoProfile
 	resolution string
+
+	// Set by the auth webhook
+	objectStore drivers.OSDriver // Instead of drivers.NodeStorage
+	maxPrice    *big.Rat         // Instead of BroadcastCfg.MaxPrice
+	orchs       *orchFilter
+	expiresAt   time.Time
 }
 
 func (s *streamParameters) StreamID() string {
 	return string(s.mid) + "/" + s.rtmpKey
 }
 
+func (s *streamParameters) storage() drivers.OSDriver {
+	if s.objectStore != nil {
+		return s.objectStore
+	}
+	return drivers.NodeStorage
+}
+
 type rtmpConnection struct {
 	mid         core.ManifestID
 	nonce       uint64
@@ -79,7 +97,11 @@ type rtmpConnection struct {
 	profile     *ffmpeg.VideoProfile
 	params      *streamParameters
 	sessManager *BroadcastSessionsManager
+	stats       *streamStats
+	started     time.Time
 	lastUsed    time.Time
+	// Ends the stream once it expires
+	expiry *time.Timer
 }
 
 type LivepeerServer struct {
@@ -88,19 +110,30 @@ type LivepeerServer struct {
 	LivepeerNode          *core.LivepeerNode
 	HTTPMux               *http.ServeMux
 	ExposeCurrentManifest bool
+	// Address to accept streams published over SRT on, if any
+	SRTAddr string
 
 	// Thread sensitive fields. All accesses to the
 	// following fields should be protected by `connectionLock`
 	rtmpConnections map[core.ManifestID]*rtmpConnection
 	lastHLSStreamID core.StreamID
 	lastManifestID  core.ManifestID
-	connectionLock  *sync.RWMutex
+	// Streams that were ended by the operator and may not be published
+	// again until the given time
+	blockedStreams map[core.ManifestID]time.Time
+	connectionLock *sync.RWMutex
 }
 
 type authWebhookResponse struct {
-	ManifestID string   `json:"manifestID"`
-	StreamKey  string   `json:"streamKey"`
-	Presets    []string `json:"presets"`
+	ManifestID         string               `json:"manifestID"`
+	StreamKey          string               `json:"streamKey"`
+	Presets            []string             `json:"presets"`
+	Profiles           []common.JSONProfile `json:"profiles"`
+	ObjectStore        *authObjectStore     `json:"objectStore"`
+	MaxPrice           *authMaxPrice        `json:"maxPrice"`
+	AllowOrchestrators []string             `json:"allowOrchestrators"`
+	DenyOrchestrators  []string             `json:"denyOrchestrators"`
+	ExpiresAt          int64                `json:"expiresAt"` // Unix time in seconds
 }
 
 func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServer {
@@ -117,6 +150,7 @@ func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServ
 	server := lpmscore.New(&opts)
 	ls := &LivepeerServer{RTMPSegmenter: server, LPMS: server, LivepeerNode: lpNode, HTTPMux: opts.HttpMux, connectionLock: &sync.RWMutex{},
 		rtmpConnections: make(map[core.ManifestID]*rtmpConnection),
+		blockedStreams:  make(map[core.ManifestID]time.Time),
 	}
 	if lpNode.NodeType == core.BroadcasterNode {
 		opts.HttpMux.HandleFunc("/live/", ls.HandlePush)
@@ -126,7 +160,11 @@ func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServ
 
 //StartMediaServer starts the LPMS server
 func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOptions string, httpAddr string) error {
-	BroadcastJobVideoProfiles = parsePresets(strings.Split(transcodingOptions, ","))
+	profiles, err := parseTranscodingOptions(transcodingOptions)
+	if err != nil {
+		return err
+	}
+	BroadcastJobVideoProfiles = profiles
 
 	glog.V(common.SHORT).Infof("Transcode Job Type: %v", BroadcastJobVideoProfiles)
 
@@ -140,7 +178,7 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	//Start the LPMS server
 	lpmsCtx, cancel := context.WithCancel(context.Background())
 
-	ec := make(chan error, 2)
+	ec := make(chan error, 3)
 	go func() {
 		if err := s.LPMS.Start(lpmsCtx); err != nil {
 			// typically triggered if there's an error with broadcaster LPMS
@@ -153,6 +191,11 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 			glog.V(4).Infof("HTTP Server listening on http://%v", httpAddr)
 			ec <- http.ListenAndServe(httpAddr, s.HTTPMux)
 		}()
+		if s.SRTAddr != "" {
+			go func() {
+				ec <- s.serveSRT(lpmsCtx, s.SRTAddr)
+			}()
+		}
 	}
 
 	select {
@@ -179,15 +222,31 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		var err error
 		var key string
 		presets := BroadcastJobVideoProfiles
+		params := &streamParameters{}
 		if resp, err = authenticateStream(url.String()); err != nil {
 			glog.Error("Authentication denied for ", err)
 			return nil
 		}
 		if resp != nil {
 			mid, key = parseManifestID(resp.ManifestID), resp.StreamKey
-			// Process transcoding options presets
-			if len(resp.Presets) > 0 {
-				presets = parsePresets(resp.Presets)
+			// Process transcoding options presets and custom profiles
+			if len(resp.Presets) > 0 || len(resp.Profiles) > 0 {
+				profiles, err := common.JSONProfilesToProfiles(resp.Profiles)
+				if err != nil {
+					glog.Error("Invalid profiles from auth webhook: ", err)
+					if monitor.Enabled {
+						monitor.AuthWebhookDenied(monitor.AuthWebhookDenialStreamOptions)
+					}
+					return nil
+				}
+				presets = append(parsePresets(resp.Presets), profiles...)
+			}
+			if err := resp.apply(params); err != nil {
+				glog.Errorf("Rejecting stream manifestID=%s: %v", mid, err)
+				if monitor.Enabled {
+					monitor.AuthWebhookDenied(monitor.AuthWebhookDenialStreamOptions)
+				}
+				return nil
 			}
 		}
 
@@ -210,16 +269,17 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 			glog.Error("Manifest already exists ", mid)
 			return nil
 		}
+		if until, blocked := s.blockedStreams[mid]; blocked && time.Now().Before(until) {
+			glog.Errorf("Rejecting blocked stream manifestID=%s until=%v", mid, until)
+			return nil
+		}
 
 		// Generate RTMP part of StreamID
 		if key == "" {
 			key = common.RandomIDGenerator(StreamKeyBytes)
 		}
-		return &streamParameters{
-			mid:      mid,
-			rtmpKey:  key,
-			profiles: presets,
-		}
+		params.mid, params.rtmpKey, params.profiles = mid, key, presets
+		return params
 	}
 }
 
@@ -228,33 +288,65 @@ func authenticateStream(url string) (*authWebhookResponse, error) {
 		return nil, nil
 	}
 
+	e := authResponses.get(url)
+	if e == nil {
+		e = &authCacheEntry{}
+		start := time.Now()
+		e.resp, e.denial, e.err = callAuthWebhook(url)
+		if monitor.Enabled {
+			monitor.AuthWebhookTime(time.Since(start))
+		}
+		if e.denial == monitor.AuthWebhookDenialUnavailable {
+			if AuthWebhook.FailOpen {
+				glog.Warningf("Auth webhook unavailable, accepting stream url=%s err=%v", url, e.err)
+				return nil, nil
+			}
+		} else if AuthWebhook.CacheTTL > 0 {
+			authResponses.set(url, e, AuthWebhook.CacheTTL)
+		}
+	}
+	if e.err != nil && monitor.Enabled {
+		monitor.AuthWebhookDenied(e.denial)
+	}
+	return e.resp, e.err
+}
+
+// callAuthWebhook returns the webhook's response, or why the stream was
+// denied if it wasn't accepted
+func callAuthWebhook(url string) (*authWebhookResponse, monitor.AuthWebhookDenial, error) {
 	values := map[string]string{"url": url}
 	jsonValue, err := json.Marshal(values)
 	if err != nil {
-		return nil, err
+		return nil, monitor.AuthWebhookDenialInvalidResponse, err
 	}
-	resp, err := http.Post(AuthWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
-
+	client := &http.Client{Timeout: AuthWebhook.Timeout}
+	resp, err := client.Post(AuthWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
 	if err != nil {
-		return nil, err
+		return nil, monitor.AuthWebhookDenialUnavailable, err
 	}
 	rbody, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, monitor.AuthWebhookDenialUnavailable, errors.New(resp.Status)
+	}
 	if resp.StatusCode != 200 {
-		return nil, errors.New(resp.Status)
+		return nil, monitor.AuthWebhookDenialStatus, errors.New(resp.Status)
+	}
+	if err != nil {
+		return nil, monitor.AuthWebhookDenialUnavailable, err
 	}
 	if len(rbody) == 0 {
-		return nil, nil
+		return nil, "", nil
 	}
 	var authResp authWebhookResponse
 	err = json.Unmarshal(rbody, &authResp)
 	if err != nil {
-		return nil, err
+		return nil, monitor.AuthWebhookDenialInvalidResponse, err
 	}
 	if authResp.ManifestID == "" {
-		return nil, errors.New("Empty manifest id not allowed")
+		return nil, monitor.AuthWebhookDenialInvalidResponse, errors.New("Empty manifest id not allowed")
 	}
-	return &authResp, nil
+	return &authResp, "", nil
 }
 
 func streamParams(rtmpStrm stream.RTMPVideoStream) *streamParameters {
@@ -364,11 +456,15 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		return nil, errMismatchedParams
 	}
 	mid := params.mid
-	if drivers.NodeStorage == nil {
+	if !params.expiresAt.IsZero() && !time.Now().Before(params.expiresAt) {
+		return nil, errStreamExpired
+	}
+	osDriver := params.storage()
+	if osDriver == nil {
 		glog.Error("Missing node storage")
 		return nil, errStorage
 	}
-	storage := drivers.NodeStorage.NewSession(string(mid))
+	storage := osDriver.NewSession(string(mid))
 	// Build the source video profile from the RTMP stream.
 	if params.resolution == "" {
 		params.resolution = fmt.Sprintf("%vx%v", rtmpStrm.Width(), rtmpStrm.Height())
@@ -387,7 +483,12 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		return nil, errAlreadyExists
 	}
 
-	playlist := core.NewBasicPlaylistManager(mid, storage)
+	var playlist *core.BasicPlaylistManager
+	if RecordStreams {
+		playlist = core.NewRecordingPlaylistManager(mid, storage)
+	} else {
+		playlist = core.NewBasicPlaylistManager(mid, storage)
+	}
 	cxn := &rtmpConnection{
 		mid:         mid,
 		nonce:       nonce,
@@ -396,6 +497,8 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		profile:     &vProfile,
 		params:      params,
 		sessManager: NewSessionManager(s.LivepeerNode, params, playlist),
+		stats:       newStreamStats(),
+		started:     time.Now(),
 		lastUsed:    time.Now(),
 	}
 
@@ -404,11 +507,15 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 	s.lastManifestID = mid
 	s.lastHLSStreamID = hlsStrmID
 	sessionsNumber := len(s.rtmpConnections)
+	if !params.expiresAt.IsZero() {
+		cxn.expiry = time.AfterFunc(time.Until(params.expiresAt), func() { s.expireStream(cxn) })
+	}
 	s.connectionLock.Unlock()
 
 	if monitor.Enabled {
 		monitor.CurrentSessions(sessionsNumber)
 	}
+	StreamEvents.send(&streamEvent{Type: EventStreamStarted, ManifestID: mid})
 
 	return cxn, nil
 }
@@ -421,6 +528,9 @@ func removeRTMPStream(s *LivepeerServer, mid core.ManifestID) error {
 		glog.Error("Attempted to end unknown stream with manifest ID ", mid)
 		return errUnknownStream
 	}
+	if cxn.expiry != nil {
+		cxn.expiry.Stop()
+	}
 	cxn.sessManager.cleanup()
 	cxn.pl.Cleanup()
 	glog.Infof("Ended stream with id=%s", mid)
@@ -430,10 +540,100 @@ func removeRTMPStream(s *LivepeerServer, mid core.ManifestID) error {
 		monitor.StreamEnded(cxn.nonce)
 		monitor.CurrentSessions(len(s.rtmpConnections))
 	}
+	StreamEvents.send(&streamEvent{Type: EventStreamEnded, ManifestID: mid})
 
 	return nil
 }
 
+// expireStream disconnects the stream and ends it, unless it already ended
+func (s *LivepeerServer) expireStream(cxn *rtmpConnection) {
+	s.connectionLock.RLock()
+	current := s.rtmpConnections[cxn.mid]
+	s.connectionLock.RUnlock()
+	if current != cxn {
+		return
+	}
+	glog.Infof("Stream expired manifestID=%s", cxn.mid)
+	cxn.stream.Close()
+	removeRTMPStream(s, cxn.mid)
+}
+
+// EndStream disconnects the publisher and ends the stream. If block is
+// positive, the manifest ID can't be published to again for that long, even
+// if the stream isn't live.
+func (s *LivepeerServer) EndStream(mid core.ManifestID, block time.Duration) error {
+	s.connectionLock.Lock()
+	if block > 0 {
+		if s.blockedStreams == nil {
+			s.blockedStreams = make(map[core.ManifestID]time.Time)
+		}
+		now := time.Now()
+		for m, until := range s.blockedStreams {
+			if !now.Before(until) {
+				delete(s.blockedStreams, m)
+			}
+		}
+		s.blockedStreams[mid] = now.Add(block)
+		glog.Infof("Blocked stream manifestID=%s for %v", mid, block)
+	}
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.Unlock()
+	if !ok {
+		if block > 0 {
+			return nil
+		}
+		return errUnknownStream
+	}
+	glog.Infof("Ending stream manifestID=%s", mid)
+	cxn.stream.Close()
+	return removeRTMPStream(s, mid)
+}
+
+// StreamInfo describes a live stream
+type StreamInfo struct {
+	ManifestID core.ManifestID
+	Profiles   []string
+	Resolution string
+	Started    time.Time
+	LastUsed   time.Time
+	// Number of orchestrator sessions available to the stream
+	Sessions  int
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// LocalStreams returns the live streams, ordered by manifest ID
+func (s *LivepeerServer) LocalStreams() []StreamInfo {
+	s.connectionLock.RLock()
+	cxns := make([]*rtmpConnection, 0, len(s.rtmpConnections))
+	infos := make([]StreamInfo, 0, len(s.rtmpConnections))
+	for _, cxn := range s.rtmpConnections {
+		cxns = append(cxns, cxn)
+		info := StreamInfo{ManifestID: cxn.mid, Started: cxn.started, LastUsed: cxn.lastUsed}
+		if cxn.params != nil {
+			for _, p := range cxn.params.profiles {
+				info.Profiles = append(info.Profiles, p.Name)
+			}
+			info.Resolution = cxn.params.resolution
+			if !cxn.params.expiresAt.IsZero() {
+				expiresAt := cxn.params.expiresAt
+				info.ExpiresAt = &expiresAt
+			}
+		}
+		infos = append(infos, info)
+	}
+	s.connectionLock.RUnlock()
+
+	for i, cxn := range cxns {
+		if bsm := cxn.sessManager; bsm != nil {
+			bsm.sessLock.Lock()
+			infos[i].Sessions = len(bsm.sessList)
+			bsm.sessLock.Unlock()
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ManifestID < infos[j].ManifestID })
+	return infos
+}
+
 //End RTMP Publish Handlers
 
 //HLS Play Handlers
@@ -499,17 +699,22 @@ func getHLSSegmentHandler(s *LivepeerServer) func(url *url.URL) ([]byte, error)
 			glog.Error("Unexpected path structure")
 			return nil, vidplayer.ErrNotFound
 		}
-		memoryOS, ok := drivers.NodeStorage.(*drivers.MemoryOS)
-		if !ok {
-			return nil, vidplayer.ErrNotFound
-		}
-		// We index the session by the first entry of the path, eg
-		// <session>/<more-path>/<data>
-		os := memoryOS.GetSession(parts[0])
-		if os == nil {
+		var data []byte
+		switch store := drivers.NodeStorage.(type) {
+		case *drivers.MemoryOS:
+			// We index the session by the first entry of the path, eg
+			// <session>/<more-path>/<data>
+			os := store.GetSession(parts[0])
+			if os == nil {
+				return nil, vidplayer.ErrNotFound
+			}
+			data = os.GetData(segName)
+		case *drivers.FSOS:
+			// Data on disk outlives its session, so look it up directly
+			data = store.GetData(segName)
+		default:
 			return nil, vidplayer.ErrNotFound
 		}
-		data := os.GetData(segName)
 		if len(data) > 0 {
 			return data, nil
 		}
@@ -549,6 +754,10 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.Body.Close()
+	profilesStr := r.Header.Get("Content-Profiles")
+	if profilesStr == "" {
+		profilesStr = r.URL.Query().Get("profiles")
+	}
 	r.URL = &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
 
 	if ".ts" != path.Ext(r.URL.Path) {
@@ -570,6 +779,17 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 
 	// Check for presence and register if a fresh cxn
 	if !exists {
+		// Renditions requested by the pusher override the defaults and any webhook presets
+		var profiles []ffmpeg.VideoProfile
+		if profilesStr != "" {
+			if profiles, err = parseProfiles(profilesStr); err != nil || len(profiles) == 0 {
+				if err == nil {
+					err = errors.New("no profiles")
+				}
+				http.Error(w, fmt.Sprintf("Invalid profiles: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
 		appData := (createRTMPStreamIDHandler(s))(r.URL)
 		if appData == nil {
 			http.Error(w, "Could not create stream ID: ", http.StatusInternalServerError)
@@ -578,6 +798,9 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 		st := stream.NewBasicRTMPVideoStream(appData)
 		params := streamParams(st)
 		params.resolution = r.Header.Get("Content-Resolution")
+		if len(profiles) > 0 {
+			params.profiles = profiles
+		}
 
 		cxn, err = s.registerConnection(st)
 		if err != nil {
@@ -587,19 +810,25 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 
 		ticker := time.NewTicker(RefreshIntervalHttpPush)
 
-		go func(s *LivepeerServer, mid core.ManifestID) {
+		go func(s *LivepeerServer, mid core.ManifestID, cxn *rtmpConnection) {
 			for range ticker.C {
 				s.connectionLock.RLock()
-				lastUsed := s.rtmpConnections[mid].lastUsed
+				current := s.rtmpConnections[mid]
+				lastUsed := cxn.lastUsed
 				s.connectionLock.RUnlock()
 
+				if current != cxn {
+					// Already ended, e.g. by the operator or on expiry
+					ticker.Stop()
+					return
+				}
 				if time.Since(lastUsed) > RefreshIntervalHttpPush {
 					_ = removeRTMPStream(s, mid)
 					ticker.Stop()
 					return
 				}
 			}
-		}(s, mid)
+		}(s, mid, cxn)
 	}
 
 	fname := path.Base(r.URL.Path)
@@ -651,6 +880,62 @@ func parseManifestID(reqPath string) core.ManifestID {
 	return parseStreamID(reqPath).ManifestID
 }
 
+var customProfileRegex = regexp.MustCompile(`^(\d+x\d+):(\d+[kKmM]?):(\d+)$`)
+
+// parseProfiles parses a comma separated list of renditions. Each entry is
+// either a preset name or a custom profile given as resolution:bitrate:fps,
+// eg "P240p30fps16x9,1280x720:3000k:30"
+func parseProfiles(str string) ([]ffmpeg.VideoProfile, error) {
+	profs := make([]ffmpeg.VideoProfile, 0)
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(str, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		p, ok := ffmpeg.VideoProfileLookup[v]
+		if !ok {
+			m := customProfileRegex.FindStringSubmatch(v)
+			if m == nil {
+				return nil, fmt.Errorf("invalid profile %v", v)
+			}
+			fps, err := strconv.ParseUint(m[3], 10, 32)
+			if err != nil || fps == 0 {
+				return nil, fmt.Errorf("invalid framerate in profile %v", v)
+			}
+			p = ffmpeg.VideoProfile{
+				Name:       fmt.Sprintf("%s_%s_%dfps", m[1], m[2], fps),
+				Resolution: m[1],
+				Bitrate:    m[2],
+				Framerate:  uint(fps),
+			}
+		}
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		profs = append(profs, p)
+	}
+	return profs, nil
+}
+
+// parseTranscodingOptions accepts either a comma separated list of presets
+// or the path to a JSON file of profiles; see common.ParseProfilesJSON
+func parseTranscodingOptions(opts string) ([]ffmpeg.VideoProfile, error) {
+	if info, err := os.Stat(opts); err == nil && !info.IsDir() {
+		data, err := ioutil.ReadFile(opts)
+		if err != nil {
+			return nil, err
+		}
+		profiles, err := common.ParseProfilesJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profiles in %v: %v", opts, err)
+		}
+		return profiles, nil
+	}
+	return parsePresets(strings.Split(opts, ",")), nil
+}
+
 func parsePresets(presets []string) []ffmpeg.VideoProfile {
 	profs := make([]ffmpeg.VideoProfile, 0)
 	for _, v := range presets {
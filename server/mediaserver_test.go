@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -31,6 +32,7 @@ import (
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/segmenter"
 	"github.com/livepeer/lpms/stream"
+	"github.com/livepeer/lpms/vidplayer"
 )
 
 var S *LivepeerServer
@@ -55,13 +57,14 @@ type stubDiscovery struct {
 	lock         *sync.Mutex
 	getOrchCalls int
 	getOrchError error
+	maxPrice     *big.Rat
 }
 
 func (d *stubDiscovery) GetURLs() []*url.URL {
 	return nil
 }
 
-func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, error) {
+func (d *stubDiscovery) GetOrchestrators(num int, maxPrice *big.Rat) ([]*net.OrchestratorInfo, error) {
 	if d.waitGetOrch != nil {
 		<-d.waitGetOrch
 	}
@@ -69,6 +72,7 @@ func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, erro
 	if d.lock != nil {
 		d.lock.Lock()
 		d.getOrchCalls++
+		d.maxPrice = maxPrice
 		err = d.getOrchError
 		d.lock.Unlock()
 	}
@@ -368,6 +372,49 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	defer ts7.Close()
 	params = createSid(u).(*streamParameters)
 	assert.Len(params.profiles, 0, "Unexpected value in presets")
+
+	// custom profiles are added to the presets
+	ts8 := makeServer(`{"manifestID":"a", "presets":["P240p30fps16x9"], "profiles":[{"name":"custom","width":1280,"height":720,"bitrate":3000000,"fps":30}]}`)
+	defer ts8.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9,
+		{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}}, params.profiles)
+
+	// invalid custom profiles deny the stream
+	ts9 := makeServer(`{"manifestID":"a", "profiles":[{"name":"custom","width":1280,"height":720,"fps":30}]}`)
+	defer ts9.Close()
+	assert.Nil(createSid(u), "Stream with invalid profiles was not denied")
+
+	// per-stream storage, price, orchestrators and expiry
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	ts10 := makeServer(fmt.Sprintf(`{"manifestID":"a",
+		"objectStore":{"type":"s3","region":"us-east-1","bucket":"customer","accessKey":"key","accessKeySecret":"secret"},
+		"maxPrice":{"pricePerUnit":10,"pixelsPerUnit":3},
+		"allowOrchestrators":["https://127.0.0.1:8935"], "denyOrchestrators":["0x0000000000000000000000000000000000000001"],
+		"expiresAt":%d}`, expiresAt))
+	defer ts10.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(core.ManifestID("a"), params.mid)
+	assert.NotNil(params.objectStore)
+	assert.Equal(big.NewRat(10, 3), params.maxPrice)
+	assert.Equal(map[string]bool{"127.0.0.1:8935": true}, params.orchs.allow)
+	assert.Len(params.orchs.deny, 1)
+	assert.Equal(expiresAt, params.expiresAt.Unix())
+	assert.Equal(BroadcastJobVideoProfiles, params.profiles)
+
+	// invalid options deny the stream
+	for _, opts := range []string{
+		`"objectStore":{"type":"s3","bucket":"customer"}`,
+		`"objectStore":{"type":"gs","bucket":"customer","key":"not json"}`,
+		`"objectStore":{"type":"azure","bucket":"customer"}`,
+		`"maxPrice":{"pricePerUnit":10}`,
+		`"allowOrchestrators":["not an orchestrator"]`,
+		fmt.Sprintf(`"expiresAt":%d`, time.Now().Add(-time.Minute).Unix()),
+	} {
+		ts := makeServer(`{"manifestID":"a", ` + opts + `}`)
+		assert.Nil(createSid(u), "Stream was not denied with "+opts)
+		ts.Close()
+	}
 }
 
 func TestCreateRTMPStreamHandler(t *testing.T) {
@@ -644,6 +691,49 @@ func TestGetHLSMasterPlaylistHandler(t *testing.T) {
 	}
 }
 
+func TestGetHLSSegmentHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+
+	s := &LivepeerServer{}
+	handler := getHLSSegmentHandler(s)
+	segURL, _ := url.Parse("http://localhost/stream/mani/source/1.ts")
+
+	// No storage
+	drivers.NodeStorage = nil
+	_, err := handler(segURL)
+	assert.Equal(vidplayer.ErrNotFound, err)
+
+	// Memory storage
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	_, err = handler(segURL)
+	assert.Equal(vidplayer.ErrNotFound, err)
+	_, err = drivers.NodeStorage.NewSession("mani").SaveData("source/1.ts", []byte("mem"))
+	require.Nil(err)
+	data, err := handler(segURL)
+	assert.Nil(err)
+	assert.Equal("mem", string(data))
+
+	// Filesystem storage; data remains available after the session ends
+	dir, err := ioutil.TempDir("", "segments")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	fsos, err := drivers.NewFSDriver(nil, dir, 0)
+	require.Nil(err)
+	drivers.NodeStorage = fsos
+	_, err = handler(segURL)
+	assert.Equal(vidplayer.ErrNotFound, err)
+	sess := fsos.NewSession("mani")
+	_, err = sess.SaveData("source/1.ts", []byte("disk"))
+	require.Nil(err)
+	sess.EndSession()
+	data, err = handler(segURL)
+	assert.Nil(err)
+	assert.Equal("disk", string(data))
+}
+
 func TestRegisterConnection(t *testing.T) {
 	assert := assert.New(t)
 	s := setupServer()
@@ -727,6 +817,50 @@ func TestRegisterConnection(t *testing.T) {
 
 }
 
+func TestRecordStream(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	oldStorage := drivers.NodeStorage
+	defer func() {
+		drivers.NodeStorage = oldStorage
+		RecordStreams = false
+	}()
+
+	dir, err := ioutil.TempDir("", "record")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	fsos, err := drivers.NewFSDriver(nil, dir, 0)
+	require.Nil(err)
+	drivers.NodeStorage = fsos
+	RecordStreams = true
+
+	mid := core.ManifestID(t.Name())
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, resolution: "1280x720"})
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	for i := 0; i < int(core.LIVE_LIST_LENGTH)+2; i++ {
+		name := fmt.Sprintf("source/%d.ts", i)
+		uri, err := cxn.pl.GetOSSession().SaveData(name, []byte("seg"))
+		require.Nil(err)
+		require.Nil(cxn.pl.InsertHLSSegment(cxn.profile, uint64(i), uri, 2))
+	}
+	assert.Nil(fsos.GetData(string(mid) + "/index.m3u8"))
+
+	require.Nil(removeRTMPStream(s, mid))
+
+	master := string(fsos.GetData(string(mid) + "/index.m3u8"))
+	assert.Contains(master, "source.m3u8")
+	media := string(fsos.GetData(string(mid) + "/source.m3u8"))
+	assert.Contains(media, "/stream/"+string(mid)+"/source/0.ts")
+	assert.Contains(media, "#EXT-X-ENDLIST")
+	// Segments are still served after the stream ended
+	segURL, _ := url.Parse("http://localhost/stream/" + string(mid) + "/source/0.ts")
+	data, err := getHLSSegmentHandler(s)(segURL)
+	assert.Nil(err)
+	assert.Equal("seg", string(data))
+}
+
 func TestBroadcastSessionManagerWithStreamStartStop(t *testing.T) {
 	assert := assert.New(t)
 
@@ -875,3 +1009,52 @@ func TestParsePresets(t *testing.T) {
 	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P720p30fps16x9}, p)
 
 }
+
+func TestParseTranscodingOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := parseTranscodingOptions("P240p30fps16x9,unknown,P720p30fps16x9")
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P720p30fps16x9}, p)
+
+	f, err := ioutil.TempFile("", "profiles*.json")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte(`[{"name":"custom","width":1280,"height":720,"bitrate":3000000,"fps":30}]`))
+	require.Nil(t, err)
+	f.Close()
+	p, err = parseTranscodingOptions(f.Name())
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}}, p)
+
+	require.Nil(t, ioutil.WriteFile(f.Name(), []byte("not json"), 0644))
+	_, err = parseTranscodingOptions(f.Name())
+	assert.Error(err)
+}
+
+func TestParseProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := parseProfiles("")
+	assert.Nil(err)
+	assert.Empty(p)
+
+	p, err = parseProfiles("P240p30fps16x9, P720p30fps16x9")
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P720p30fps16x9}, p)
+
+	// Custom profiles, mixed with presets and deduplicated
+	p, err = parseProfiles("1280x720:3000k:30,P240p30fps16x9,1280x720:3000k:30,640x360:800000:24")
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{
+		{Name: "1280x720_3000k_30fps", Resolution: "1280x720", Bitrate: "3000k", Framerate: 30},
+		ffmpeg.P240p30fps16x9,
+		{Name: "640x360_800000_24fps", Resolution: "640x360", Bitrate: "800000", Framerate: 24},
+	}, p)
+
+	// Invalid entries
+	for _, v := range []string{"unknown", "1280x720:3000k", "1280x720:3000k:0", "1280:3000k:30", "1280x720:fast:30", "P240p30fps16x9,bad"} {
+		_, err = parseProfiles(v)
+		assert.NotNil(err, v)
+	}
+}
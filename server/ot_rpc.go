@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +16,7 @@ import (
 	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -25,6 +25,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/livepeer/go-livepeer/common"
@@ -37,19 +38,30 @@ const transcodingErrorMimeType = "livepeer/transcoding-error"
 
 var errSecret = errors.New("Invalid secret")
 var errZeroCapacity = errors.New("Zero capacity")
+var errOrchIdle = errors.New("No ping from orchestrator")
+
+// How long a transcoder waits to hear from the orchestrator before
+// reconnecting. Only applies once the orchestrator has started pinging.
+var orchIdleTimeout = 1 * time.Minute
 
 // Standalone Transcoder
 
 // RunTranscoder is main routing of standalone transcoder
-// Exiting it will terminate executable
-func RunTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) {
+// Exiting it will terminate executable. Segments are fetched through cache if
+// it isn't nil.
+func RunTranscoder(n *core.LivepeerNode, orchAddr string, capacity int, caps *net.TranscoderCapabilities, cache *SegmentCache) {
 	expb := backoff.NewExponentialBackOff()
 	expb.MaxInterval = time.Minute
 	expb.MaxElapsedTime = 0
 	backoff.Retry(func() error {
 		glog.Info("Registering transcoder to ", orchAddr)
-		err := runTranscoder(n, orchAddr, capacity)
+		start := time.Now()
+		err := runTranscoder(n, orchAddr, capacity, caps, cache)
 		glog.Info("Unregistering transcoder: ", err)
+		if time.Since(start) > expb.MaxInterval {
+			// Connection was up for a while; reconnect quickly
+			expb.Reset()
+		}
 		if _, fatal := err.(core.RemoteTranscoderFatalError); fatal {
 			glog.Info("Terminating transcoder because of ", err)
 			// Returning nil here will make `backoff` to stop trying to reconnect and exit
@@ -76,7 +88,7 @@ func checkTranscoderError(err error) error {
 	return err
 }
 
-func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
+func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int, caps *net.TranscoderCapabilities, cache *SegmentCache) error {
 	tlsConfig := &tls.Config{InsecureSkipVerify: true}
 	conn, err := grpc.Dial(orchAddr,
 		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
@@ -91,11 +103,18 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 	ctx, cancel := context.WithCancel(ctx)
 	// Silence linter
 	defer cancel()
-	r, err := c.RegisterTranscoder(ctx, &net.RegisterRequest{Secret: n.OrchSecret, Capacity: int64(capacity)})
+	r, err := c.RegisterTranscoder(ctx, &net.RegisterRequest{Secret: n.OrchSecret, Capacity: int64(capacity), Capabilities: caps, Heartbeat: true})
 	if err := checkTranscoderError(err); err != nil {
 		glog.Error("Could not register transcoder to orchestrator ", err)
 		return err
 	}
+	// Results and pongs are tied to this connection by the ID it was given
+	var id string
+	if md, err := r.Header(); err == nil {
+		if v := md.Get(core.TranscoderIDKey); len(v) > 0 {
+			id = v[0]
+		}
+	}
 
 	// Catch interrupt signal to shut down transcoder
 	exitc := make(chan os.Signal)
@@ -111,59 +130,97 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 		}
 	}()
 
+	// Once the orchestrator pings, hearing nothing from it for too long means
+	// the connection is dead even if the stream is still open
+	var idle int32
+	watchdog := time.AfterFunc(orchIdleTimeout, func() {
+		glog.Errorf("Nothing received from orchestrator=%s for %v, reconnecting", orchAddr, orchIdleTimeout)
+		atomic.StoreInt32(&idle, 1)
+		cancel()
+	})
+	watchdog.Stop()
+	defer watchdog.Stop()
+
 	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
 	var wg sync.WaitGroup
 	for {
 		notify, err := r.Recv()
+		if atomic.LoadInt32(&idle) == 1 {
+			err = errOrchIdle
+		}
 		if err := checkTranscoderError(err); err != nil {
 			glog.Infof(`End of stream receive cycle because of err="%v", waiting for running transcode jobs to complete`, err)
 			wg.Wait()
 			return err
 		}
+		if notify.PingId != 0 {
+			watchdog.Reset(orchIdleTimeout)
+			go pong(ctx, c, n.OrchSecret, id, notify.PingId)
+			continue
+		}
 		wg.Add(1)
 		go func() {
-			runTranscode(n, orchAddr, httpc, notify)
+			runTranscode(n, orchAddr, id, httpc, notify, cache)
 			wg.Done()
 		}()
 	}
 }
 
-func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, notify *net.NotifySegment) {
-	profiles, err := common.TxDataToVideoProfile(hex.EncodeToString(notify.Profiles))
+func pong(ctx context.Context, c net.TranscoderClient, secret, id string, pingID int64) {
+	ctx, cancel := context.WithTimeout(ctx, core.RemoteTranscoderPingTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, core.TranscoderIDKey, id)
+	if _, err := c.Pong(ctx, &net.PongRequest{Secret: secret, PingId: pingID}); err != nil {
+		glog.Errorf("Error answering ping pingId=%d err=%v", pingID, err)
+	}
+}
+
+func runTranscode(n *core.LivepeerNode, orchAddr, id string, httpc *http.Client, notify *net.NotifySegment, cache *SegmentCache) {
+	profiles, err := common.DecodeProfiles(notify.Profiles, notify.FullProfiles)
 	if err != nil {
 		glog.Info("Unable to deserialize profiles ", err)
 	}
 
 	glog.Infof("Transcoding taskId=%d url=%s", notify.TaskId, notify.Url)
 	var contentType string
-	var body bytes.Buffer
+	var body io.Reader
 
-	tData, err := n.Transcoder.Transcode(notify.Job, notify.Url, profiles)
+	fname := notify.Url
+	if cache != nil {
+		for _, url := range notify.PrefetchUrls {
+			cache.Prefetch(url)
+		}
+		local, release, err := cache.Get(n.WorkDir, notify.Url)
+		if err != nil {
+			// let the transcoder fetch it instead
+			glog.Errorf("Could not fetch segment taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
+		} else {
+			defer release()
+			fname = local
+		}
+	}
+
+	tData, err := n.Transcoder.Transcode(notify.Job, fname, profiles)
 	glog.V(common.VERBOSE).Infof("Transcoding done for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 	if err != nil {
 		glog.Error("Unable to transcode ", err)
-		body.Write([]byte(err.Error()))
+		body = bytes.NewBufferString(err.Error())
 		contentType = transcodingErrorMimeType
 	} else {
+		// Stream the renditions rather than assembling the whole body first.
+		// They are all in memory already, as the transcoder only returns
+		// once every rendition is done; this saves a second copy of them.
+		pr, pw := io.Pipe()
+		// Unblocks the writer if the request ends before the body is consumed
+		defer pr.Close()
 		boundary := common.RandName()
-		w := multipart.NewWriter(&body)
-		for _, v := range tData.Segments {
-			w.SetBoundary(boundary)
-			hdrs := textproto.MIMEHeader{
-				"Content-Type":   {"video/MP2T"},
-				"Content-Length": {strconv.Itoa(len(v.Data))},
-				"Pixels":         {strconv.FormatInt(v.Pixels, 10)},
-			}
-			fw, err := w.CreatePart(hdrs)
-			if err != nil {
-				glog.Error("Could not create multipart part ", err)
-			}
-			io.Copy(fw, bytes.NewBuffer(v.Data))
-		}
-		w.Close()
+		w := multipart.NewWriter(pw)
+		w.SetBoundary(boundary)
+		go writeSegments(pw, w, tData.Segments)
+		body = pr
 		contentType = "multipart/mixed; boundary=" + boundary
 	}
-	req, err := http.NewRequest("POST", "https://"+orchAddr+"/transcodeResults", &body)
+	req, err := http.NewRequest("POST", "https://"+orchAddr+"/transcodeResults", body)
 	if err != nil {
 		glog.Error("Error posting results ", err)
 	}
@@ -171,6 +228,7 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	req.Header.Set("Credentials", n.OrchSecret)
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("TaskId", strconv.FormatInt(notify.TaskId, 10))
+	req.Header.Set("TranscoderId", id)
 	if tData != nil {
 		req.Header.Set("Pixels", strconv.FormatInt(tData.Pixels, 10))
 	}
@@ -184,13 +242,39 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	glog.V(common.VERBOSE).Infof("Transcoding done results sent for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 }
 
+// writeSegments writes the renditions into the multipart body of the results.
+// An error aborts the upload so the orchestrator doesn't take partial data for
+// the full results.
+func writeSegments(pw *io.PipeWriter, w *multipart.Writer, segments []*core.TranscodedSegmentData) {
+	for _, v := range segments {
+		hdrs := textproto.MIMEHeader{
+			"Content-Type":   {"video/MP2T"},
+			"Content-Length": {strconv.Itoa(len(v.Data))},
+			"Pixels":         {strconv.FormatInt(v.Pixels, 10)},
+		}
+		fw, err := w.CreatePart(hdrs)
+		if err != nil {
+			glog.Error("Could not create multipart part ", err)
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := fw.Write(v.Data); err != nil {
+			glog.Error("Could not write multipart part ", err)
+			pw.CloseWithError(err)
+			return
+		}
+	}
+	pw.CloseWithError(w.Close())
+}
+
 // Orchestrator gRPC
 
 func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transcoder_RegisterTranscoderServer) error {
 	from := common.GetConnectionAddr(stream.Context())
-	glog.Infof("Got a RegisterTranscoder request from transcoder=%s capacity=%d", from, req.Capacity)
+	glog.Infof("Got a RegisterTranscoder request from transcoder=%s capacity=%d capabilities=%v", from, req.Capacity, req.Capabilities)
 
-	if req.Secret != h.orchestrator.TranscoderSecret() {
+	name, ok := h.orchestrator.AuthenticateTranscoder(req.Secret)
+	if !ok {
 		glog.Info(errSecret.Error())
 		return errSecret
 	}
@@ -200,10 +284,26 @@ func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transco
 	}
 
 	// blocks until stream is finished
-	h.orchestrator.ServeTranscoder(stream, int(req.Capacity))
+	h.orchestrator.ServeTranscoder(stream, int(req.Capacity), req.Capabilities, name, req.Heartbeat)
 	return nil
 }
 
+func (h *lphttp) Pong(ctx context.Context, req *net.PongRequest) (*net.PingPong, error) {
+	if _, ok := h.orchestrator.AuthenticateTranscoder(req.Secret); !ok {
+		return nil, errSecret
+	}
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(core.TranscoderIDKey); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if err := h.orchestrator.TranscoderPong(req.PingId, id); err != nil {
+		return nil, err
+	}
+	return &net.PingPong{}, nil
+}
+
 // Orchestrator HTTP
 
 func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
@@ -217,8 +317,8 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if creds != orch.TranscoderSecret() {
-		glog.Error("Invalid shared secret")
+	if _, ok := orch.AuthenticateTranscoder(creds); !ok {
+		glog.Error("Invalid transcoder credentials")
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -236,6 +336,8 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
 		return
 	}
+	// Checked against the connection the task was sent over
+	transcoderID := r.Header.Get("TranscoderId")
 
 	decodedPixels, err := strconv.ParseInt(r.Header.Get("Pixels"), 10, 64)
 	if err != nil {
@@ -246,7 +348,6 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 
 	var res core.RemoteTranscoderResult
 	if transcodingErrorMimeType == mediaType {
-		w.Write([]byte("OK"))
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			glog.Errorf("Unable to read transcoding error body taskID=%v err=%v", tid, err)
@@ -255,7 +356,11 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 			res.Err = fmt.Errorf(string(body))
 		}
 		glog.Errorf("Trascoding error for taskID=%v err=%v", tid, res.Err)
-		orch.TranscoderResults(tid, &res)
+		if err := orch.TranscoderResults(tid, transcoderID, &res); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("OK"))
 		return
 	}
 
@@ -272,7 +377,7 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 				res.Err = err
 				break
 			}
-			body, err := ioutil.ReadAll(p)
+			body, err := readPart(p)
 			if err != nil {
 				glog.Error("Error reading body ", err)
 				res.Err = err
@@ -292,7 +397,10 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 			Segments: segments,
 			Pixels:   decodedPixels,
 		}
-		orch.TranscoderResults(tid, &res)
+		if err := orch.TranscoderResults(tid, transcoderID, &res); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 	}
 	if res.Err != nil {
 		http.Error(w, res.Err.Error(), http.StatusInternalServerError)
@@ -300,3 +408,36 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write([]byte("OK"))
 }
+
+// Largest rendition length accepted from a transcoder
+var maxSegmentSize int64 = 256 * 1024 * 1024
+
+// readPart reads a rendition from the results. Parts are read one at a time
+// as they arrive, into a buffer sized from the part's Content-Length so the
+// data isn't copied around while the buffer grows. Parts longer than their
+// Content-Length are rejected rather than truncated.
+func readPart(p *multipart.Part) ([]byte, error) {
+	size, err := strconv.ParseInt(p.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		// length is optional, but the size limit still applies
+		data, err := ioutil.ReadAll(io.LimitReader(p, maxSegmentSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxSegmentSize {
+			return nil, fmt.Errorf("Part longer than the maximum length %d", maxSegmentSize)
+		}
+		return data, nil
+	}
+	if size < 0 || size > maxSegmentSize {
+		return nil, fmt.Errorf("Invalid part length %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(p, data); err != nil {
+		return nil, err
+	}
+	if n, _ := p.Read(make([]byte, 1)); n > 0 {
+		return nil, fmt.Errorf("Part longer than its length %d", size)
+	}
+	return data, nil
+}
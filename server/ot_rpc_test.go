@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -11,8 +12,10 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/livepeer/go-livepeer/common"
@@ -20,12 +23,16 @@ import (
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
 )
 
 type stubTranscoder struct {
-	called int
-	fname  string
-	err    error
+	called   int
+	fname    string
+	profiles []ffmpeg.VideoProfile
+	err      error
 }
 
 var testRemoteTranscoderResults = &core.TranscodeData{
@@ -39,6 +46,7 @@ var testRemoteTranscoderResults = &core.TranscodeData{
 func (st *stubTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*core.TranscodeData, error) {
 	st.called++
 	st.fname = fname
+	st.profiles = profiles
 	if st.err != nil {
 		return nil, st.err
 	}
@@ -63,26 +71,31 @@ func TestRemoteTranscoder(t *testing.T) {
 	node.OrchSecret = "verbigsecret"
 	node.Transcoder = tr
 
-	runTranscode(node, "badaddress", httpc, notify)
+	runTranscode(node, "badaddress", "conn1", httpc, notify, nil)
 	assert.Equal(1, tr.called)
 	assert.Equal("linktomanifest", tr.fname)
 
 	var headers http.Header
 	var body []byte
+	var contentLength int64
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		out, err := ioutil.ReadAll(r.Body)
 		assert.NoError(err)
 		headers = r.Header
 		body = out
+		contentLength = r.ContentLength
 		w.Write(nil)
 	}))
 	defer ts.Close()
 	parsedURL, _ := url.Parse(ts.URL)
 	rand.Seed(123)
-	runTranscode(node, parsedURL.Host, httpc, notify)
+	runTranscode(node, parsedURL.Host, "conn1", httpc, notify, nil)
 	assert.Equal(2, tr.called)
 	assert.NotNil(body)
+	// streamed, so the length isn't known upfront
+	assert.Equal(int64(-1), contentLength)
 	assert.Equal("742", headers.Get("TaskId"))
+	assert.Equal("conn1", headers.Get("TranscoderId"))
 	assert.Equal("999", headers.Get("Pixels"))
 	assert.Equal("multipart/mixed; boundary=17b336b6e6ae071e928f", headers.Get("Content-Type"))
 	assert.Equal(node.OrchSecret, headers.Get("Credentials"))
@@ -110,6 +123,26 @@ func TestRemoteTranscoder(t *testing.T) {
 	}
 }
 
+func TestRemoteTranscoder_FullProfiles(t *testing.T) {
+	assert := assert.New(t)
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	custom := ffmpeg.VideoProfile{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, custom}
+	notify := &net.NotifySegment{
+		TaskId:       742,
+		Profiles:     common.ProfilesToTranscodeOpts(profiles),
+		FullProfiles: common.ProfilesToNetProfiles(profiles),
+		Url:          "linktomanifest",
+	}
+	tr := &stubTranscoder{}
+	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
+	node.Transcoder = tr
+
+	runTranscode(node, "badaddress", "conn1", httpc, notify, nil)
+	assert.Equal(1, tr.called)
+	assert.Equal(profiles, tr.profiles)
+}
+
 func TestRemoteTranscoderError(t *testing.T) {
 	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}
@@ -139,7 +172,7 @@ func TestRemoteTranscoderError(t *testing.T) {
 	}))
 	defer ts.Close()
 	parsedURL, _ := url.Parse(ts.URL)
-	runTranscode(node, parsedURL.Host, httpc, notify)
+	runTranscode(node, parsedURL.Host, "conn1", httpc, notify, nil)
 	assert.Equal(1, tr.called)
 	assert.NotNil(body)
 	assert.Equal("742", headers.Get("TaskId"))
@@ -148,3 +181,137 @@ func TestRemoteTranscoderError(t *testing.T) {
 	assert.Equal(protoVerLPT, headers.Get("Authorization"))
 	assert.Equal(errText, string(body))
 }
+
+func TestTranscodeResults_Streamed(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	lp := &lphttp{orchestrator: orch}
+	ts := httptest.NewTLSServer(http.HandlerFunc(lp.TranscodeResults))
+	defer ts.Close()
+
+	var res *core.RemoteTranscoderResult
+	orch.On("AuthenticateTranscoder", "verbigsecret").Return("", true)
+	orch.On("TranscoderResults", int64(742), "conn1", mock.Anything).Run(func(args mock.Arguments) {
+		res = args.Get(2).(*core.RemoteTranscoderResult)
+	}).Return(nil)
+
+	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
+	node.OrchSecret = "verbigsecret"
+	node.Transcoder = &stubTranscoder{}
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	parsedURL, _ := url.Parse(ts.URL)
+	runTranscode(node, parsedURL.Host, "conn1", httpc, &net.NotifySegment{TaskId: 742}, nil)
+
+	orch.AssertNumberOfCalls(t, "TranscoderResults", 1)
+	assert.Nil(res.Err)
+	assert.Equal(testRemoteTranscoderResults, res.TranscodeData)
+}
+
+func TestReadPart(t *testing.T) {
+	assert := assert.New(t)
+	part := func(length, data string) *multipart.Part {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		hdrs := textproto.MIMEHeader{}
+		if length != "" {
+			hdrs.Set("Content-Length", length)
+		}
+		fw, _ := w.CreatePart(hdrs)
+		fw.Write([]byte(data))
+		w.Close()
+		p, err := multipart.NewReader(&buf, w.Boundary()).NextPart()
+		require.Nil(t, err)
+		return p
+	}
+
+	data, err := readPart(part("5", "body1"))
+	assert.Nil(err)
+	assert.Equal([]byte("body1"), data)
+
+	// length is optional
+	data, err = readPart(part("", "body1"))
+	assert.Nil(err)
+	assert.Equal([]byte("body1"), data)
+
+	_, err = readPart(part("6", "body1"))
+	assert.Equal(io.ErrUnexpectedEOF, err)
+
+	_, err = readPart(part("4", "body1"))
+	assert.EqualError(err, "Part longer than its length 4")
+
+	_, err = readPart(part("-1", "body1"))
+	assert.EqualError(err, "Invalid part length -1")
+
+	defer func(max int64) { maxSegmentSize = max }(maxSegmentSize)
+	maxSegmentSize = 4
+	_, err = readPart(part("5", "body1"))
+	assert.EqualError(err, "Invalid part length 5")
+	// including parts without a length
+	_, err = readPart(part("", "body1"))
+	assert.EqualError(err, "Part longer than the maximum length 4")
+	data, err = readPart(part("", "body"))
+	assert.Nil(err)
+	assert.Equal([]byte("body"), data)
+}
+
+func TestTranscodeResults_Credentials(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	lp := &lphttp{orchestrator: orch}
+	handler := http.HandlerFunc(lp.TranscodeResults)
+
+	orch.On("AuthenticateTranscoder", "badtoken").Return("", false)
+	orch.On("AuthenticateTranscoder", "verbigsecret").Return("", true)
+	orch.On("TranscoderResults", int64(742), "conn2", mock.Anything).Return(core.ErrTranscoderTaskMismatch)
+	orch.On("TranscoderResults", int64(742), "conn1", mock.Anything).Return(nil)
+
+	post := func(creds, id string) *http.Response {
+		headers := map[string]string{
+			"Authorization": protoVerLPT,
+			"Credentials":   creds,
+			"Content-Type":  transcodingErrorMimeType,
+			"TaskId":        "742",
+			"TranscoderId":  id,
+			"Pixels":        "0",
+		}
+		return httpPostResp(handler, strings.NewReader("error"), headers)
+	}
+
+	assert.Equal(http.StatusUnauthorized, post("badtoken", "conn1").StatusCode)
+
+	// results from a connection other than the one assigned the task, even
+	// with the same credentials
+	resp := post("verbigsecret", "conn2")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusForbidden, resp.StatusCode)
+	assert.Equal(core.ErrTranscoderTaskMismatch.Error(), strings.TrimSpace(string(body)))
+
+	resp = post("verbigsecret", "conn1")
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("OK", string(body))
+	orch.AssertNumberOfCalls(t, "TranscoderResults", 2)
+}
+
+func TestPong(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	lp := &lphttp{orchestrator: orch}
+
+	orch.On("AuthenticateTranscoder", "badtoken").Return("", false)
+	orch.On("AuthenticateTranscoder", "verbigsecret").Return("", true)
+	orch.On("TranscoderPong", int64(3), "conn2").Return(core.ErrTranscoderTaskMismatch)
+	orch.On("TranscoderPong", int64(3), "conn1").Return(nil)
+	ctx := func(id string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(core.TranscoderIDKey, id))
+	}
+
+	_, err := lp.Pong(ctx("conn1"), &net.PongRequest{Secret: "badtoken", PingId: 3})
+	assert.Equal(errSecret, err)
+	_, err = lp.Pong(ctx("conn2"), &net.PongRequest{Secret: "verbigsecret", PingId: 3})
+	assert.Equal(core.ErrTranscoderTaskMismatch, err)
+	res, err := lp.Pong(ctx("conn1"), &net.PongRequest{Secret: "verbigsecret", PingId: 3})
+	assert.Nil(err)
+	assert.NotNil(res)
+	orch.AssertNumberOfCalls(t, "TranscoderPong", 2)
+}
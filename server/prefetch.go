@@ -0,0 +1,197 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// How long a hinted segment is waited for. The orchestrator only stores a
+// segment once it comes in, so hints are polled for until then.
+var prefetchTimeout = 10 * time.Second
+var prefetchRetryInterval = 250 * time.Millisecond
+
+// Number of fetched segments kept around waiting to be transcoded. Hinted
+// segments that end up going to another transcoder are dropped past this.
+var segmentCacheSize = 8
+
+// SegmentCache downloads the input segments of a standalone transcoder. The
+// orchestrator hints at the segments that come next, which are fetched ahead
+// of time so the download isn't part of the transcode. Segments are kept in
+// memory, or on disk if a directory is given.
+type SegmentCache struct {
+	dir   string
+	httpc *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*cachedSegment
+	// URLs in the order they were added, for eviction
+	order []string
+}
+
+type cachedSegment struct {
+	// Closed once the fetch is over
+	done chan struct{}
+	// Cuts short the wait before polling again
+	wake chan struct{}
+	data []byte
+	file string
+	err  error
+}
+
+// NewSegmentCache creates a cache storing segments under dir, or in memory if
+// dir is empty
+func NewSegmentCache(dir string) (*SegmentCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &SegmentCache{
+		dir: dir,
+		httpc: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			Timeout:   common.HTTPTimeout,
+		},
+		entries: make(map[string]*cachedSegment),
+	}, nil
+}
+
+// Prefetch starts fetching a segment in the background, unless it is already
+// being fetched
+func (c *SegmentCache) Prefetch(url string) {
+	if !isHTTP(url) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[url]; ok {
+		return
+	}
+	go c.fetch(url, c.add(url), prefetchTimeout)
+}
+
+// Get returns the name of a local file holding the segment, fetching it if
+// it wasn't prefetched. The release function removes the file once the
+// caller is done with it.
+func (c *SegmentCache) Get(workDir, url string) (string, func(), error) {
+	if !isHTTP(url) {
+		return "", nil, fmt.Errorf("Not an HTTP URL: %s", url)
+	}
+	c.mu.Lock()
+	e, ok := c.entries[url]
+	if !ok {
+		e = c.add(url)
+		go c.fetch(url, e, 0)
+	}
+	// A segment is only fetched once; retries of it are downloaded again
+	c.remove(url)
+	c.mu.Unlock()
+
+	// The segment is available by now, so don't wait for the next poll
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	<-e.done
+	if e.err != nil {
+		return "", nil, e.err
+	}
+	release := func() { os.Remove(e.file) }
+	if e.file != "" {
+		return e.file, release, nil
+	}
+	// The transcoder reads from files
+	fname := filepath.Join(workDir, common.RandName()+".ts")
+	if err := ioutil.WriteFile(fname, e.data, 0644); err != nil {
+		return "", nil, err
+	}
+	return fname, func() { os.Remove(fname) }, nil
+}
+
+// Caller should hold the lock
+func (c *SegmentCache) add(url string) *cachedSegment {
+	e := &cachedSegment{done: make(chan struct{}), wake: make(chan struct{}, 1)}
+	c.entries[url] = e
+	c.order = append(c.order, url)
+	for len(c.order) > segmentCacheSize {
+		old := c.entries[c.order[0]]
+		c.remove(c.order[0])
+		go old.discard()
+	}
+	return e
+}
+
+// Caller should hold the lock
+func (c *SegmentCache) remove(url string) {
+	delete(c.entries, url)
+	for i, u := range c.order {
+		if u == url {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// fetch downloads the segment, retrying until it shows up for up to wait
+func (c *SegmentCache) fetch(url string, e *cachedSegment, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	var data []byte
+	var err error
+	for {
+		data, err = c.download(url)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		timer := time.NewTimer(prefetchRetryInterval)
+		select {
+		case <-timer.C:
+		case <-e.wake:
+			timer.Stop()
+		}
+	}
+	if err != nil {
+		glog.Errorf("Error fetching segment url=%s err=%v", url, err)
+	} else if c.dir != "" {
+		fname := filepath.Join(c.dir, common.RandName()+".ts")
+		if err = ioutil.WriteFile(fname, data, 0644); err == nil {
+			e.file = fname
+		}
+		data = nil
+	}
+	e.data, e.err = data, err
+	close(e.done)
+}
+
+func (c *SegmentCache) download(url string) ([]byte, error) {
+	resp, err := c.httpc.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// discard cleans up after a segment that won't be used
+func (e *cachedSegment) discard() {
+	<-e.done
+	if e.file != "" {
+		os.Remove(e.file)
+	}
+}
+
+func isHTTP(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
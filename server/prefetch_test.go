@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// segmentServer serves the segments it has, and counts requests per path
+type segmentServer struct {
+	mu       sync.Mutex
+	segments map[string]string
+	requests map[string]int
+}
+
+func newSegmentServer() (*segmentServer, *httptest.Server) {
+	ss := &segmentServer{segments: make(map[string]string), requests: make(map[string]int)}
+	return ss, httptest.NewTLSServer(ss)
+}
+
+func (ss *segmentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.requests[r.URL.Path]++
+	data, ok := ss.segments[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(data))
+}
+
+func (ss *segmentServer) set(path, data string) {
+	ss.mu.Lock()
+	ss.segments[path] = data
+	ss.mu.Unlock()
+}
+
+func (ss *segmentServer) count(path string) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.requests[path]
+}
+
+func TestSegmentCache_Get(t *testing.T) {
+	assert := assert.New(t)
+	ss, ts := newSegmentServer()
+	defer ts.Close()
+	ss.set("/1.ts", "data1")
+	workDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(workDir)
+
+	for _, dir := range []string{"", filepath.Join(workDir, "cache")} {
+		c, err := NewSegmentCache(dir)
+		require.Nil(t, err)
+
+		fname, release, err := c.Get(workDir, ts.URL+"/1.ts")
+		require.Nil(t, err)
+		data, err := ioutil.ReadFile(fname)
+		assert.Nil(err)
+		assert.Equal("data1", string(data))
+		release()
+		_, err = os.Stat(fname)
+		assert.True(os.IsNotExist(err))
+
+		_, _, err = c.Get(workDir, ts.URL+"/2.ts")
+		assert.EqualError(err, "404 Not Found")
+		_, _, err = c.Get(workDir, "/tmp/1.ts")
+		assert.EqualError(err, "Not an HTTP URL: /tmp/1.ts")
+		assert.Empty(c.entries)
+	}
+}
+
+func TestSegmentCache_Prefetch(t *testing.T) {
+	assert := assert.New(t)
+	ss, ts := newSegmentServer()
+	defer ts.Close()
+	workDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(workDir)
+	defer func(interval time.Duration) { prefetchRetryInterval = interval }(prefetchRetryInterval)
+	prefetchRetryInterval = 5 * time.Millisecond
+
+	c, err := NewSegmentCache(filepath.Join(workDir, "cache"))
+	require.Nil(t, err)
+
+	// polled for until it shows up
+	c.Prefetch(ts.URL + "/1.ts")
+	c.Prefetch(ts.URL + "/1.ts")
+	time.Sleep(20 * time.Millisecond)
+	ss.set("/1.ts", "data1")
+	time.Sleep(20 * time.Millisecond)
+	requests := ss.count("/1.ts")
+	assert.True(requests > 1)
+
+	// already fetched
+	fname, release, err := c.Get(workDir, ts.URL+"/1.ts")
+	require.Nil(t, err)
+	defer release()
+	data, _ := ioutil.ReadFile(fname)
+	assert.Equal("data1", string(data))
+	assert.Equal(requests, ss.count("/1.ts"))
+
+	// a pending prefetch is cut short by Get
+	prefetchRetryInterval = time.Minute
+	c.Prefetch(ts.URL + "/2.ts")
+	time.Sleep(20 * time.Millisecond)
+	ss.set("/2.ts", "data2")
+	_, release2, err := c.Get(workDir, ts.URL+"/2.ts")
+	require.Nil(t, err)
+	release2()
+	assert.Equal(2, ss.count("/2.ts"))
+}
+
+func TestSegmentCache_Evict(t *testing.T) {
+	assert := assert.New(t)
+	ss, ts := newSegmentServer()
+	defer ts.Close()
+	ss.set("/1.ts", "data1")
+	ss.set("/2.ts", "data2")
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	defer func(size int) { segmentCacheSize = size }(segmentCacheSize)
+	segmentCacheSize = 1
+
+	c, err := NewSegmentCache(dir)
+	require.Nil(t, err)
+	c.Prefetch(ts.URL + "/1.ts")
+	time.Sleep(20 * time.Millisecond)
+	c.Prefetch(ts.URL + "/2.ts")
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	assert.Equal([]string{ts.URL + "/2.ts"}, c.order)
+	assert.Len(c.entries, 1)
+	c.mu.Unlock()
+	// the evicted segment's file is removed
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(files, 1)
+}
+
+func TestRemoteTranscoder_SegmentCache(t *testing.T) {
+	assert := assert.New(t)
+	ss, ts := newSegmentServer()
+	defer ts.Close()
+	ss.set("/stream/abc/1.ts", "data1")
+	ss.set("/stream/abc/2.ts", "data2")
+	workDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(workDir)
+
+	// results are posted to the same server; a 404 is fine here
+	c, err := NewSegmentCache("")
+	require.Nil(t, err)
+	tr := &stubTranscoder{}
+	node, _ := core.NewLivepeerNode(nil, workDir, nil)
+	node.Transcoder = tr
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	parsedURL, _ := url.Parse(ts.URL)
+	notify := &net.NotifySegment{
+		TaskId:       742,
+		Url:          ts.URL + "/stream/abc/1.ts",
+		PrefetchUrls: []string{ts.URL + "/stream/abc/2.ts"},
+	}
+	runTranscode(node, parsedURL.Host, "conn1", httpc, notify, c)
+
+	// transcoded from a local copy
+	assert.Equal(1, tr.called)
+	assert.True(strings.HasPrefix(tr.fname, workDir))
+	_, err = os.Stat(tr.fname)
+	assert.True(os.IsNotExist(err))
+
+	// the next segment was fetched ahead of time
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(1, ss.count("/stream/abc/2.ts"))
+	c.mu.Lock()
+	assert.Contains(c.entries, ts.URL+"/stream/abc/2.ts")
+	c.mu.Unlock()
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/lpms/ffmpeg"
 )
 
 func requestSetup(s *LivepeerServer) (http.Handler, *strings.Reader, *httptest.ResponseRecorder) {
@@ -188,3 +189,67 @@ func TestWebhookRequestURL(t *testing.T) {
 
 	assert.Equal(200, resp.StatusCode)
 }
+
+func TestPushProfiles(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	AuthWebhookURL = ""
+	s.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	defer func() { s.rtmpConnections = map[core.ManifestID]*rtmpConnection{} }()
+
+	push := func(url string, header string) *http.Response {
+		handler, reader, w := requestSetup(s)
+		req := httptest.NewRequest("POST", url, reader)
+		if header != "" {
+			req.Header.Set("Content-Profiles", header)
+		}
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+	profiles := func(mid core.ManifestID) []ffmpeg.VideoProfile {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		cxn, ok := s.rtmpConnections[mid]
+		require.True(t, ok)
+		return cxn.params.profiles
+	}
+
+	// Defaults without any profiles
+	resp := push("/live/defaults/1.ts", "")
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(BroadcastJobVideoProfiles, profiles("defaults"))
+
+	// Profiles via header
+	resp = push("/live/header/1.ts", "P144p30fps16x9,1280x720:3000k:30")
+	assert.Equal(200, resp.StatusCode)
+	expected := []ffmpeg.VideoProfile{
+		ffmpeg.P144p30fps16x9,
+		{Name: "1280x720_3000k_30fps", Resolution: "1280x720", Bitrate: "3000k", Framerate: 30},
+	}
+	assert.Equal(expected, profiles("header"))
+
+	// Profiles persist for the stream; later pushes can't change them
+	resp = push("/live/header/2.ts", "P720p30fps16x9")
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(expected, profiles("header"))
+
+	// Profiles via query param; header takes precedence
+	resp = push("/live/query/1.ts?profiles=P720p30fps16x9", "")
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9}, profiles("query"))
+	resp = push("/live/both/1.ts?profiles=P720p30fps16x9", "P144p30fps16x9")
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, profiles("both"))
+
+	// Invalid profiles are rejected without creating the stream
+	resp = push("/live/invalid/1.ts", "P144p30fps16x9,nope")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(string(body), "Invalid profiles")
+	resp = push("/live/invalid/1.ts?profiles=,", "")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.connectionLock.RLock()
+	_, exists := s.rtmpConnections["invalid"]
+	s.connectionLock.RUnlock()
+	assert.False(exists)
+}
@@ -33,14 +33,15 @@ const GRPCTimeout = 8 * time.Second
 type Orchestrator interface {
 	ServiceURI() *url.URL
 	Address() ethcommon.Address
-	TranscoderSecret() string
+	AuthenticateTranscoder(creds string) (string, bool)
 	Sign([]byte) ([]byte, error)
 	VerifySig(ethcommon.Address, string, []byte) bool
 	CurrentBlock() *big.Int
 	CheckCapacity(core.ManifestID) error
 	TranscodeSeg(*core.SegTranscodingMetadata, *stream.HLSSegment) (*core.TranscodeResult, error)
-	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int)
-	TranscoderResults(job int64, res *core.RemoteTranscoderResult)
+	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool)
+	TranscoderResults(job int64, transcoderID string, res *core.RemoteTranscoderResult) error
+	TranscoderPong(pingID int64, transcoderID string) error
 	ProcessPayment(payment net.Payment, manifestID core.ManifestID) error
 	TicketParams(sender ethcommon.Address) (*net.TicketParams, error)
 	PriceInfo(sender ethcommon.Address) (*net.PriceInfo, error)
@@ -98,12 +99,22 @@ type BroadcastSession struct {
 	Sender           pm.Sender
 	PMSessionID      string
 	Balance          Balance
+	// Overrides BroadcastCfg.MaxPrice if set
+	MaxPrice *big.Rat
+
+	// Timings of the last submitted segment, used to score the session
+	uploadDur    time.Duration
+	transcodeDur time.Duration
+	// Payment sent with the last submitted segment
+	ticketsSent int
+	evSent      *big.Rat
 }
 
 type lphttp struct {
 	orchestrator Orchestrator
 	orchRPC      *grpc.Server
 	transRPC     *http.ServeMux
+	segCache     *segResultCache
 }
 
 // grpc methods
@@ -131,6 +142,7 @@ func StartTranscodeServer(orch Orchestrator, bind string, mux *http.ServeMux, wo
 		orchestrator: orch,
 		orchRPC:      s,
 		transRPC:     mux,
+		segCache:     newSegResultCache(segResultCacheTTL),
 	}
 	net.RegisterOrchestratorServer(s, &lp)
 	lp.transRPC.HandleFunc("/segment", lp.ServeSegment)
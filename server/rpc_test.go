@@ -139,12 +139,16 @@ func newStubOrchestrator() *stubOrchestrator {
 func (r *stubOrchestrator) CheckCapacity(mid core.ManifestID) error {
 	return r.sessCapErr
 }
-func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) {
 }
-func (r *stubOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
+func (r *stubOrchestrator) TranscoderResults(job int64, transcoderID string, res *core.RemoteTranscoderResult) error {
+	return nil
+}
+func (r *stubOrchestrator) TranscoderPong(pingID int64, transcoderID string) error {
+	return nil
 }
-func (r *stubOrchestrator) TranscoderSecret() string {
-	return ""
+func (r *stubOrchestrator) AuthenticateTranscoder(creds string) (string, bool) {
+	return "", false
 }
 func stubBroadcaster2() *stubOrchestrator {
 	return newStubOrchestrator() // lazy; leverage subtyping for interface commonalities
@@ -269,6 +273,44 @@ func TestRPCSeg(t *testing.T) {
 	o.sessCapErr = nil
 }
 
+func TestRPCSeg_CustomProfiles(t *testing.T) {
+	assert := assert.New(t)
+	b := stubBroadcaster2()
+	o := newStubOrchestrator()
+	custom := ffmpeg.VideoProfile{Name: "custom", Resolution: "1280x720", Bitrate: "3000000", Framerate: 30}
+	s := &BroadcastSession{
+		Broadcaster: b,
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, custom},
+	}
+	baddr := ethcrypto.PubkeyToAddress(b.priv.PublicKey)
+
+	creds, err := genSegCreds(s, &stream.HLSSegment{})
+	assert.Nil(err)
+	md, err := verifySegCreds(o, creds, baddr)
+	assert.Nil(err)
+	assert.Equal(s.Profiles, md.Profiles)
+
+	// Full profiles are only sent when needed
+	buf, _ := base64.StdEncoding.DecodeString(creds)
+	var segData net.SegData
+	assert.Nil(proto.Unmarshal(buf, &segData))
+	assert.Len(segData.FullProfiles, 2)
+	presetSess := &BroadcastSession{Broadcaster: b, ManifestID: s.ManifestID, Profiles: []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}}
+	presetCreds, err := genSegCreds(presetSess, &stream.HLSSegment{})
+	assert.Nil(err)
+	buf, _ = base64.StdEncoding.DecodeString(presetCreds)
+	var presetData net.SegData
+	assert.Nil(proto.Unmarshal(buf, &presetData))
+	assert.Empty(presetData.FullProfiles)
+
+	// Tampering with the profile parameters invalidates the signature
+	segData.FullProfiles[0].Bitrate = "6000000" // custom sorts first
+	data, _ := proto.Marshal(&segData)
+	_, err = verifySegCreds(o, base64.StdEncoding.EncodeToString(data), baddr)
+	assert.Equal(errSegSig, err)
+}
+
 func TestEstimateFee(t *testing.T) {
 	assert := assert.New(t)
 
@@ -603,6 +645,13 @@ func TestValidatePrice(t *testing.T) {
 	err = validatePrice(s)
 	assert.EqualError(err, fmt.Sprintf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", int64(1), int64(5)))
 
+	// Stream MaxPrice overrides B MaxPrice
+	s.MaxPrice = big.NewRat(1, 3)
+	assert.Nil(validatePrice(s))
+	s.MaxPrice = big.NewRat(1, 4)
+	assert.EqualError(validatePrice(s), "Orchestrator price higher than the set maximum price of 1 wei per 4 pixels")
+	s.MaxPrice = nil
+
 	// O.PriceInfo is nil
 	s.OrchestratorInfo.PriceInfo = nil
 	err = validatePrice(s)
@@ -835,9 +884,9 @@ func (o *mockOrchestrator) Address() ethcommon.Address {
 	o.Called()
 	return ethcommon.Address{}
 }
-func (o *mockOrchestrator) TranscoderSecret() string {
-	o.Called()
-	return ""
+func (o *mockOrchestrator) AuthenticateTranscoder(creds string) (string, bool) {
+	args := o.Called(creds)
+	return args.String(0), args.Bool(1)
 }
 func (o *mockOrchestrator) Sign(msg []byte) ([]byte, error) {
 	o.Called(msg)
@@ -861,11 +910,16 @@ func (o *mockOrchestrator) TranscodeSeg(md *core.SegTranscodingMetadata, seg *st
 
 	return res, args.Error(1)
 }
-func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, caps *net.TranscoderCapabilities, name string, heartbeat bool) {
 	o.Called(stream)
 }
-func (o *mockOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
-	o.Called(job, res)
+func (o *mockOrchestrator) TranscoderResults(job int64, transcoderID string, res *core.RemoteTranscoderResult) error {
+	args := o.Called(job, transcoderID, res)
+	return args.Error(0)
+}
+func (o *mockOrchestrator) TranscoderPong(pingID int64, transcoderID string) error {
+	args := o.Called(pingID, transcoderID)
+	return args.Error(0)
 }
 func (o *mockOrchestrator) ProcessPayment(payment net.Payment, manifestID core.ManifestID) error {
 	args := o.Called(payment, manifestID)
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// How long transcode results are kept around for retries of the same segment
+var segResultCacheTTL = 1 * time.Minute
+
+// segResultCache keeps the results of recently transcoded segments so a
+// broadcaster retrying a segment gets the same results back without the
+// segment being transcoded or paid for again.
+type segResultCache struct {
+	mu      sync.Mutex
+	entries map[ethcommon.Hash]*segResult
+	ttl     time.Duration
+}
+
+type segResult struct {
+	// Closed once the result is known
+	done    chan struct{}
+	data    *net.TranscodeData
+	expires time.Time
+}
+
+func newSegResultCache(ttl time.Duration) *segResultCache {
+	return &segResultCache{
+		entries: make(map[ethcommon.Hash]*segResult),
+		ttl:     ttl,
+	}
+}
+
+// segResultKey identifies a segment by the signed metadata and its signer
+func segResultKey(sender ethcommon.Address, md *core.SegTranscodingMetadata) ethcommon.Hash {
+	return crypto.Keccak256Hash(sender.Bytes(), md.Flatten())
+}
+
+// claim returns the entry for a segment. If owner is true, the caller is the
+// first to submit the segment and has to complete the entry. Otherwise the
+// entry belongs to an earlier submission; its result is available once the
+// done channel is closed.
+func (c *segResultCache) claim(key ethcommon.Hash) (entry *segResult, owner bool) {
+	if c == nil {
+		return &segResult{done: make(chan struct{})}, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+	e := &segResult{done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true
+}
+
+// complete stores the result of a claimed entry and wakes up any waiting
+// submissions. A nil result means the segment failed; the entry is dropped so
+// the next submission transcodes it again.
+func (c *segResultCache) complete(key ethcommon.Hash, entry *segResult, data *net.TranscodeData) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	entry.data = data
+	if data == nil {
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+	} else {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegResultKey(t *testing.T) {
+	assert := assert.New(t)
+
+	md := &core.SegTranscodingMetadata{ManifestID: "foo", Seq: 1, Hash: ethcommon.BytesToHash([]byte("bar"))}
+	key := segResultKey(ethcommon.Address{}, md)
+
+	// same metadata and sender
+	md2 := *md
+	assert.Equal(key, segResultKey(ethcommon.Address{}, &md2))
+
+	// different sender
+	assert.NotEqual(key, segResultKey(ethcommon.BytesToAddress([]byte("baz")), md))
+
+	// different seq
+	md2.Seq = 2
+	assert.NotEqual(key, segResultKey(ethcommon.Address{}, &md2))
+}
+
+func TestSegResultCache(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newSegResultCache(time.Minute)
+	key := ethcommon.BytesToHash([]byte("foo"))
+
+	entry, owner := c.claim(key)
+	assert.True(owner)
+
+	// a second claim waits for the first
+	entry2, owner := c.claim(key)
+	assert.False(owner)
+	assert.Equal(entry, entry2)
+	select {
+	case <-entry2.done:
+		t.Error("Entry completed too early")
+	default:
+	}
+
+	data := &net.TranscodeData{Sig: []byte("sig")}
+	c.complete(key, entry, data)
+	<-entry2.done
+	assert.Equal(data, entry2.data)
+
+	// completed entries are returned as is
+	entry3, owner := c.claim(key)
+	assert.False(owner)
+	assert.Equal(data, entry3.data)
+
+	// failed results are dropped
+	key2 := ethcommon.BytesToHash([]byte("bar"))
+	entry, owner = c.claim(key2)
+	assert.True(owner)
+	c.complete(key2, entry, nil)
+	<-entry.done
+	_, owner = c.claim(key2)
+	assert.True(owner)
+
+	// expired results are dropped
+	c.mu.Lock()
+	c.entries[key].expires = time.Now().Add(-time.Second)
+	c.mu.Unlock()
+	_, owner = c.claim(key)
+	assert.True(owner)
+}
+
+func TestSegResultCache_Nil(t *testing.T) {
+	assert := assert.New(t)
+
+	var c *segResultCache
+	key := ethcommon.BytesToHash([]byte("foo"))
+
+	entry, owner := c.claim(key)
+	assert.True(owner)
+	c.complete(key, entry, &net.TranscodeData{})
+
+	// nothing is cached
+	_, owner = c.claim(key)
+	assert.True(owner)
+}
@@ -134,6 +134,27 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.(http.Flusher).Flush()
 
+	// Retries of a segment get the results of the earlier submission, if
+	// any, without transcoding or debiting fees again
+	key := segResultKey(sender, segData)
+	entry, owner := h.segCache.claim(key)
+	for !owner {
+		<-entry.done
+		if entry.data != nil {
+			glog.V(common.DEBUG).Infof("Returning cached results for manifestID=%s seqNo=%d", segData.ManifestID, segData.Seq)
+			writeTranscodeResult(w, &net.TranscodeResult{
+				Seq:    segData.Seq,
+				Result: &net.TranscodeResult_Data{Data: entry.data},
+				Info:   oInfo,
+			})
+			return
+		}
+		// earlier submission failed; try again
+		entry, owner = h.segCache.claim(key)
+	}
+	var cacheData *net.TranscodeData
+	defer func() { h.segCache.complete(key, entry, cacheData) }()
+
 	hlsStream := stream.HLSSegment{
 		SeqNo: uint64(segData.Seq),
 		Data:  data,
@@ -141,18 +162,35 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res, err := orch.TranscodeSeg(segData, &hlsStream) // ANGIE - NEED TO CHANGE ALL JOBIDS IN TRANSCODING LOOP INTO STRINGS
+	if err == nil && len(res.TranscodeData.Segments) != len(segData.Profiles) {
+		err = fmt.Errorf("transcoder returned %d renditions for %d profiles", len(res.TranscodeData.Segments), len(segData.Profiles))
+	}
 
 	// Upload to OS and construct segment result set
 	var segments []*net.TranscodedSegmentData
 	var pixels int64
+	var segHashes [][]byte
+	var uploadErr error
 	for i := 0; err == nil && i < len(res.TranscodeData.Segments); i++ {
+		if perr := res.TranscodeData.Segments[i].Err; perr != nil {
+			segments = append(segments, &net.TranscodedSegmentData{Error: perr.Error()})
+			continue
+		}
 		name := fmt.Sprintf("%s/%d.ts", segData.Profiles[i].Name, segData.Seq) // ANGIE - NEED TO EDIT OUT JOB PROFILES
-		uri, err := res.OS.SaveData(name, res.TranscodeData.Segments[i].Data)
-		if err != nil {
-			glog.Error("Could not upload segment ", segData.Seq)
-			break
+		uri, uerr := res.OS.SaveData(name, res.TranscodeData.Segments[i].Data)
+		if uerr != nil {
+			glog.Errorf("Could not upload segment manifestID=%s seqNo=%d profile=%s err=%v", segData.ManifestID, segData.Seq, segData.Profiles[i].Name, uerr)
+			if !segData.PartialResults {
+				err = uerr
+				break
+			}
+			// Reported like a failed rendition so the broadcaster retries it
+			uploadErr = uerr
+			segments = append(segments, &net.TranscodedSegmentData{Error: uerr.Error()})
+			continue
 		}
 		pixels += res.TranscodeData.Segments[i].Pixels
+		segHashes = append(segHashes, crypto.Keccak256(res.TranscodeData.Segments[i].Data))
 		d := &net.TranscodedSegmentData{
 			Url:    uri,
 			Pixels: res.TranscodeData.Segments[i].Pixels,
@@ -160,6 +198,18 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		segments = append(segments, d)
 	}
 
+	var sig []byte
+	if err == nil {
+		sig = res.Sig
+		// The transcoder signed renditions that were not uploaded; sign
+		// again over the ones actually returned
+		if uploadErr != nil && len(segHashes) == 0 {
+			err = uploadErr
+		} else if uploadErr != nil && len(sig) > 0 {
+			sig, err = orch.Sign(bytes.Join(segHashes, nil))
+		}
+	}
+
 	// Debit the fee for the total pixel count
 	orch.DebitFees(sender, segData.ManifestID, payment.GetExpectedPrice(), pixels)
 
@@ -169,12 +219,11 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		glog.Errorf("Could not transcode manifestID=%s seqNo=%d err=%v", segData.ManifestID, segData.Seq, err)
 		result = net.TranscodeResult{Result: &net.TranscodeResult_Error{Error: err.Error()}}
 	} else {
-		result = net.TranscodeResult{Result: &net.TranscodeResult_Data{
-			Data: &net.TranscodeData{
-				Segments: segments,
-				Sig:      res.Sig,
-			}},
+		cacheData = &net.TranscodeData{
+			Segments: segments,
+			Sig:      sig,
 		}
+		result = net.TranscodeResult{Result: &net.TranscodeResult_Data{Data: cacheData}}
 	}
 
 	tr := &net.TranscodeResult{
@@ -182,6 +231,10 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		Result: result.Result,
 		Info:   oInfo, // oInfo will be non-nil if we need to send an update to the broadcaster
 	}
+	writeTranscodeResult(w, tr)
+}
+
+func writeTranscodeResult(w http.ResponseWriter, tr *net.TranscodeResult) {
 	buf, err := proto.Marshal(tr)
 	if err != nil {
 		glog.Error("Unable to marshal transcode result ", err)
@@ -222,7 +275,7 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 		glog.Error("Unable to unmarshal ", err)
 		return nil, err
 	}
-	profiles, err := common.BytesToVideoProfile(segData.Profiles)
+	profiles, err := common.DecodeProfiles(segData.Profiles, segData.FullProfiles)
 	if err != nil {
 		glog.Error("Unable to deserialize profiles ", err)
 		return nil, err
@@ -240,6 +293,8 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 		Hash:       ethcommon.BytesToHash(segData.Hash),
 		Profiles:   profiles,
 		OS:         os,
+
+		PartialResults: segData.PartialResults,
 	}
 
 	if !orch.VerifySig(broadcaster, string(md.Flatten()), segData.Sig) {
@@ -256,9 +311,16 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 }
 
 func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (*net.TranscodeData, error) {
+	return submitSegment(sess, seg, nonce, sess.Profiles)
+}
+
+// submitSegment transcodes the segment into the given subset of the session's
+// profiles, eg to retry the profiles that failed with another orchestrator
+func submitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64, profiles []ffmpeg.VideoProfile) (*net.TranscodeData, error) {
 	uploaded := seg.Name != "" // hijack seg.Name to convey the uploaded URI
+	sess.ticketsSent, sess.evSent = 0, nil
 
-	segCreds, err := genSegCreds(sess, seg)
+	segCreds, err := genProfileSegCreds(sess, seg, profiles)
 	if err != nil {
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorGenCreds, err.Error(), false)
@@ -275,7 +337,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		return nil, err
 	}
 
-	fee, err := estimateFee(seg, sess.Profiles, priceInfo)
+	fee, err := estimateFee(seg, profiles, priceInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -337,6 +399,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	// If the segment was submitted then we assume that any payment included was
 	// submitted as well so we consider the update's credit as spent
 	balUpdate.Status = CreditSpent
+	sess.ticketsSent, sess.evSent = balUpdate.NumTickets, balUpdate.NewCredit
 	if monitor.Enabled && sess.OrchestratorInfo.TicketParams != nil {
 		recipient := ethcommon.BytesToAddress(sess.OrchestratorInfo.TicketParams.Recipient).String()
 		mid := string(sess.ManifestID)
@@ -432,9 +495,12 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		balUpdate.Debit.Mul(new(big.Rat).SetInt64(pixelCount), priceInfo)
 	}
 
+	sess.uploadDur = uploadDur
+	sess.transcodeDur = transcodeDur
+
 	// transcode succeeded; continue processing response
 	if monitor.Enabled {
-		monitor.SegmentTranscoded(nonce, seg.SeqNo, transcodeDur, common.ProfilesNames(sess.Profiles))
+		monitor.SegmentTranscoded(nonce, seg.SeqNo, transcodeDur, common.ProfilesNames(profiles))
 	}
 
 	glog.Infof("Successfully transcoded segment nonce=%d manifestID=%s segName=%s seqNo=%d", nonce, string(sess.ManifestID), seg.Name, seg.SeqNo)
@@ -460,6 +526,10 @@ func updateOrchestratorInfo(sess *BroadcastSession, oInfo *net.OrchestratorInfo)
 }
 
 func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error) {
+	return genProfileSegCreds(sess, seg, sess.Profiles)
+}
+
+func genProfileSegCreds(sess *BroadcastSession, seg *stream.HLSSegment, profiles []ffmpeg.VideoProfile) (string, error) {
 
 	// Generate signature for relevant parts of segment
 	hash := crypto.Keccak256(seg.Data)
@@ -467,7 +537,7 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 		ManifestID: sess.ManifestID,
 		Seq:        int64(seg.SeqNo),
 		Hash:       ethcommon.BytesToHash(hash),
-		Profiles:   sess.Profiles,
+		Profiles:   profiles,
 	}
 	sig, err := sess.Broadcaster.Sign(md.Flatten())
 	if err != nil {
@@ -485,9 +555,14 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 		ManifestId: []byte(md.ManifestID),
 		Seq:        md.Seq,
 		Hash:       hash,
-		Profiles:   common.ProfilesToTranscodeOpts(sess.Profiles),
+		Profiles:   common.ProfilesToTranscodeOpts(profiles),
 		Sig:        sig,
 		Storage:    storage,
+
+		PartialResults: true,
+	}
+	if common.HasCustomProfiles(profiles) {
+		segData.FullProfiles = common.ProfilesToNetProfiles(profiles)
 	}
 	data, err := proto.Marshal(segData)
 	if err != nil {
@@ -633,7 +708,17 @@ func genPayment(sess *BroadcastSession, numTickets int) (string, error) {
 }
 
 func validatePrice(sess *BroadcastSession) error {
-	oPrice, err := ratPriceInfo(sess.OrchestratorInfo.GetPriceInfo())
+	maxPrice := BroadcastCfg.MaxPrice()
+	if sess.MaxPrice != nil {
+		maxPrice = sess.MaxPrice
+	}
+	return checkPrice(sess.OrchestratorInfo.GetPriceInfo(), maxPrice)
+}
+
+// checkPrice returns an error if the orchestrator's price is missing or
+// higher than maxPrice
+func checkPrice(priceInfo *net.PriceInfo, maxPrice *big.Rat) error {
+	oPrice, err := ratPriceInfo(priceInfo)
 	if err != nil {
 		return err
 	}
@@ -641,7 +726,6 @@ func validatePrice(sess *BroadcastSession) error {
 		return errors.New("missing orchestrator price")
 	}
 
-	maxPrice := BroadcastCfg.MaxPrice()
 	if maxPrice != nil && oPrice.Cmp(maxPrice) == 1 {
 		return fmt.Errorf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", maxPrice.Num().Int64(), maxPrice.Denom().Int64())
 	}
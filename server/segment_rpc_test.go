@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"io/ioutil"
 	"math/big"
@@ -11,8 +12,10 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/protobuf/proto"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
@@ -203,10 +206,10 @@ func TestServeSegment_OSSaveDataError(t *testing.T) {
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
 
-	res, ok := tr.Result.(*net.TranscodeResult_Data)
+	// Nothing left to return once the only rendition fails to upload
+	res, ok := tr.Result.(*net.TranscodeResult_Error)
 	assert.True(ok)
-	assert.Equal([]byte("foo"), res.Data.Sig)
-	assert.Equal(0, len(res.Data.Segments))
+	assert.Equal("SaveData error", res.Error)
 }
 
 func TestServeSegment_ReturnSingleTranscodedSegmentData(t *testing.T) {
@@ -324,6 +327,70 @@ func TestServeSegment_ReturnMultipleTranscodedSegmentData(t *testing.T) {
 	assert.Equal(2, len(res.Data.Segments))
 }
 
+func TestServeSegment_PartialResults(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := serveSegmentHandler(orch)
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles: []ffmpeg.VideoProfile{
+			ffmpeg.P720p60fps16x9,
+			ffmpeg.P240p30fps16x9,
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+	assert.True(md.PartialResults)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", mock.Anything, s.ManifestID).Return(true)
+
+	tRes := &core.TranscodeResult{
+		TranscodeData: &core.TranscodeData{Segments: []*core.TranscodedSegmentData{
+			&core.TranscodedSegmentData{Err: errors.New("ZeroSegments")},
+			&core.TranscodedSegmentData{Data: []byte("foo"), Pixels: 100},
+		}},
+		Sig: []byte("foo"),
+		OS:  drivers.NewMemoryDriver(nil).NewSession(""),
+	}
+	orch.On("TranscodeSeg", md, seg).Return(tRes, nil)
+	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, int64(100))
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+
+	var tr net.TranscodeResult
+	err = proto.Unmarshal(body, &tr)
+	require.Nil(err)
+
+	res, ok := tr.Result.(*net.TranscodeResult_Data)
+	require.True(ok)
+	require.Len(res.Data.Segments, 2)
+	// Only the successful profile is stored and billed
+	assert.Equal(&net.TranscodedSegmentData{Error: "ZeroSegments"}, res.Data.Segments[0])
+	assert.Equal("", res.Data.Segments[1].Error)
+	assert.Equal(int64(100), res.Data.Segments[1].Pixels)
+	assert.Contains(res.Data.Segments[1].Url, "P240p30fps16x9/0.ts")
+	orch.AssertExpectations(t)
+}
+
 func TestServeSegment_UnacceptableProcessPaymentError(t *testing.T) {
 	orch := &mockOrchestrator{}
 	handler := serveSegmentHandler(orch)
@@ -656,7 +723,7 @@ func TestServeSegment_DebitFees_MultipleRenditions(t *testing.T) {
 }
 
 // break loop for adding pixelcounts when OS upload fails
-func TestServeSegment_DebitFees_OSSaveDataError_BreakLoop(t *testing.T) {
+func TestServeSegment_DebitFees_OSSaveDataError(t *testing.T) {
 	orch := &mockOrchestrator{}
 	handler := serveSegmentHandler(orch)
 
@@ -702,6 +769,7 @@ func TestServeSegment_DebitFees_OSSaveDataError_BreakLoop(t *testing.T) {
 	mos.On("SaveData", mock.Anything, mock.Anything).Return("720pdotcom", nil).Once()
 	mos.On("SaveData", mock.Anything, mock.Anything).Return("", errors.New("SaveData error")).Once()
 
+	orch.On("Sign", mock.Anything)
 	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, tData720.Pixels)
 
 	headers := map[string]string{
@@ -723,12 +791,99 @@ func TestServeSegment_DebitFees_OSSaveDataError_BreakLoop(t *testing.T) {
 
 	res, ok := tr.Result.(*net.TranscodeResult_Data)
 	assert.True(ok)
-	assert.Equal([]byte("foo"), res.Data.Sig)
-	assert.Equal(1, len(res.Data.Segments))
+	// The failed upload is reported as a failed rendition
+	assert.Equal(2, len(res.Data.Segments))
 	assert.Equal(res.Data.Segments[0].Pixels, tData720.Pixels)
+	assert.Equal("", res.Data.Segments[0].Error)
+	assert.Equal("SaveData error", res.Data.Segments[1].Error)
+	// and the results are signed again without it
+	orch.AssertCalled(t, "Sign", crypto.Keccak256(tData720.Data))
 	orch.AssertCalled(t, "DebitFees", mock.Anything, md.ManifestID, mock.Anything, tData720.Pixels)
 }
 
+func TestServeSegment_OSSaveDataError_NoPartialResults(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := serveSegmentHandler(orch)
+
+	require := require.New(t)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles: []ffmpeg.VideoProfile{
+			ffmpeg.P720p60fps16x9,
+			ffmpeg.P240p30fps16x9,
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	// Older broadcasters do not accept partial results
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	require.Nil(err)
+	var segData net.SegData
+	require.Nil(proto.Unmarshal(buf, &segData))
+	segData.PartialResults = false
+	buf, err = proto.Marshal(&segData)
+	require.Nil(err)
+	creds = base64.StdEncoding.EncodeToString(buf)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+	require.False(md.PartialResults)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", mock.Anything, s.ManifestID).Return(true)
+
+	mos := &mockOSSession{}
+
+	tData720 := &core.TranscodedSegmentData{
+		Data:   []byte("foo"),
+		Pixels: int64(110592000),
+	}
+	tData240 := &core.TranscodedSegmentData{
+		Data:   []byte("bar"),
+		Pixels: int64(6134400),
+	}
+	tRes := &core.TranscodeResult{
+		TranscodeData: &core.TranscodeData{Segments: []*core.TranscodedSegmentData{tData720, tData240}},
+		Sig:           []byte("foo"),
+		OS:            mos,
+	}
+	orch.On("TranscodeSeg", md, seg).Return(tRes, nil)
+
+	mos.On("SaveData", mock.Anything, mock.Anything).Return("720pdotcom", nil).Once()
+	mos.On("SaveData", mock.Anything, mock.Anything).Return("", errors.New("SaveData error")).Once()
+
+	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, tData720.Pixels)
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+
+	var tr net.TranscodeResult
+	err = proto.Unmarshal(body, &tr)
+	require.Nil(err)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// The whole segment fails rather than returning a partial result
+	res, ok := tr.Result.(*net.TranscodeResult_Error)
+	assert.True(ok)
+	assert.Equal("SaveData error", res.Error)
+	orch.AssertNotCalled(t, "Sign", mock.Anything)
+}
+
 func TestServeSegment_DebitFees_TranscodeSegError_ZeroPixelsBilled(t *testing.T) {
 	orch := &mockOrchestrator{}
 	handler := serveSegmentHandler(orch)
@@ -779,6 +934,190 @@ func TestServeSegment_DebitFees_TranscodeSegError_ZeroPixelsBilled(t *testing.T)
 	orch.AssertCalled(t, "DebitFees", mock.Anything, md.ManifestID, mock.Anything, int64(0))
 }
 
+func TestServeSegment_CachedResults(t *testing.T) {
+	orch := &mockOrchestrator{}
+	lp := lphttp{
+		orchestrator: orch,
+		segCache:     newSegResultCache(time.Minute),
+	}
+	handler := http.HandlerFunc(lp.ServeSegment)
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles: []ffmpeg.VideoProfile{
+			ffmpeg.P720p60fps16x9,
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", mock.Anything, s.ManifestID).Return(true)
+
+	tData := &core.TranscodeData{Segments: []*core.TranscodedSegmentData{&core.TranscodedSegmentData{Data: []byte("foo"), Pixels: int64(110592000)}}}
+	tRes := &core.TranscodeResult{
+		TranscodeData: tData,
+		Sig:           []byte("foo"),
+		OS:            drivers.NewMemoryDriver(nil).NewSession(""),
+	}
+	orch.On("TranscodeSeg", md, seg).Return(tRes, nil).Once()
+	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, tData.Segments[0].Pixels).Once()
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	submit := func() *net.TranscodeData {
+		resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.Nil(err)
+
+		var tr net.TranscodeResult
+		require.Nil(proto.Unmarshal(body, &tr))
+		assert.Equal(int64(seg.SeqNo), tr.Seq)
+		res, ok := tr.Result.(*net.TranscodeResult_Data)
+		require.True(ok)
+		return res.Data
+	}
+
+	first := submit()
+	second := submit()
+	assert.Equal([]byte("foo"), second.Sig)
+	require.Len(second.Segments, 1)
+	assert.Equal(first.Segments[0].Url, second.Segments[0].Url)
+	assert.Equal(tData.Segments[0].Pixels, second.Segments[0].Pixels)
+
+	orch.AssertNumberOfCalls(t, "TranscodeSeg", 1)
+	orch.AssertNumberOfCalls(t, "DebitFees", 1)
+	// payment for the retry is still processed
+	orch.AssertNumberOfCalls(t, "ProcessPayment", 2)
+}
+
+func TestServeSegment_CachedResults_ErrorNotCached(t *testing.T) {
+	orch := &mockOrchestrator{}
+	lp := lphttp{
+		orchestrator: orch,
+		segCache:     newSegResultCache(time.Minute),
+	}
+	handler := http.HandlerFunc(lp.ServeSegment)
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles: []ffmpeg.VideoProfile{
+			ffmpeg.P720p60fps16x9,
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", mock.Anything, s.ManifestID).Return(true)
+	orch.On("TranscodeSeg", md, seg).Return(nil, errors.New("TranscodeSeg error"))
+	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, int64(0))
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	for i := 0; i < 2; i++ {
+		resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(err)
+
+		var tr net.TranscodeResult
+		require.Nil(proto.Unmarshal(body, &tr))
+		res, ok := tr.Result.(*net.TranscodeResult_Error)
+		require.True(ok)
+		assert.Equal("TranscodeSeg error", res.Error)
+	}
+
+	// failures are retried
+	orch.AssertNumberOfCalls(t, "TranscodeSeg", 2)
+}
+
+func TestServeSegment_MismatchedRenditionCount(t *testing.T) {
+	orch := &mockOrchestrator{}
+	lp := lphttp{
+		orchestrator: orch,
+		segCache:     newSegResultCache(time.Minute),
+	}
+	handler := http.HandlerFunc(lp.ServeSegment)
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles: []ffmpeg.VideoProfile{
+			ffmpeg.P720p60fps16x9,
+			ffmpeg.P240p30fps16x9,
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", mock.Anything, s.ManifestID).Return(true)
+	tRes := &core.TranscodeResult{
+		TranscodeData: &core.TranscodeData{Segments: []*core.TranscodedSegmentData{&core.TranscodedSegmentData{Data: []byte("foo"), Pixels: 100}}},
+		Sig:           []byte("foo"),
+		OS:            drivers.NewMemoryDriver(nil).NewSession(""),
+	}
+	orch.On("TranscodeSeg", md, seg).Return(tRes, nil)
+	orch.On("DebitFees", mock.Anything, md.ManifestID, mock.Anything, int64(0))
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	for i := 0; i < 2; i++ {
+		resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(err)
+
+		var tr net.TranscodeResult
+		require.Nil(proto.Unmarshal(body, &tr))
+		res, ok := tr.Result.(*net.TranscodeResult_Error)
+		require.True(ok)
+		assert.Equal("transcoder returned 1 renditions for 2 profiles", res.Error)
+	}
+
+	// Short results are neither billed nor cached
+	orch.AssertNumberOfCalls(t, "TranscodeSeg", 2)
+}
+
 func TestSubmitSegment_GenSegCredsError(t *testing.T) {
 	b := stubBroadcaster2()
 	b.signErr = errors.New("Sign error")
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	srt "github.com/datarhei/gosrt"
+	"github.com/golang/glog"
+	"github.com/livepeer/joy4/format/ts"
+	"github.com/livepeer/lpms/stream"
+)
+
+// SRTLatency is how long SRT ingest waits for lost packets to be resent.
+// Callers asking for a higher latency get theirs.
+var SRTLatency = 120 * time.Millisecond
+
+var errSRTDenied = errors.New("stream denied")
+
+// srtPublish is the stream an SRT caller was authorized to publish
+type srtPublish struct {
+	url    *url.URL
+	params stream.AppData
+}
+
+// tsDemuxCloser reads the MPEG-TS sent by an SRT caller. Closing it
+// disconnects the caller.
+type tsDemuxCloser struct {
+	*ts.Demuxer
+	io.Closer
+}
+
+// serveSRT accepts streams published over SRT. They go through the same
+// authentication and segmenting as streams published over RTMP.
+func (s *LivepeerServer) serveSRT(ctx context.Context, addr string) error {
+	cfg := srt.DefaultConfig()
+	cfg.ReceiverLatency = SRTLatency
+	l, err := srt.Listen("srt", addr, cfg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	glog.V(4).Infof("SRT Server listening on srt://%v", addr)
+	authorize := authorizeSRT(s, addr)
+	for {
+		req, err := l.Accept2()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// The auth webhook may take a while; don't hold up other callers
+		go acceptSRT(s, req, authorize)
+	}
+}
+
+// acceptSRT accepts a caller that is allowed to publish, and rejects any
+// other
+func acceptSRT(s *LivepeerServer, req srt.ConnRequest, authorize func(streamID string) (*srtPublish, error)) {
+	if req.IsEncrypted() {
+		glog.Errorf("Rejecting encrypted SRT caller %v; only plaintext streams are supported", req.RemoteAddr())
+		req.Reject(srt.REJ_UNSECURE)
+		return
+	}
+	pub, err := authorize(req.StreamId())
+	if err != nil {
+		glog.Errorf("Rejecting SRT caller %v streamID=%q: %v", req.RemoteAddr(), req.StreamId(), err)
+		if err == errSRTDenied {
+			req.Reject(srt.REJX_UNAUTHORIZED)
+		} else {
+			req.Reject(srt.REJX_BAD_REQUEST)
+		}
+		return
+	}
+	conn, err := req.Accept()
+	if err != nil {
+		glog.Errorf("Error accepting SRT caller %v: %v", req.RemoteAddr(), err)
+		return
+	}
+	glog.V(2).Infof("SRT server got upstream: %v from %v", pub.url, conn.RemoteAddr())
+	publishSRT(s, pub, conn)
+}
+
+// authorizeSRT runs the stream ID sent by SRT callers through the RTMP
+// stream ID handler, and with it the auth webhook
+func authorizeSRT(s *LivepeerServer, host string) func(streamID string) (*srtPublish, error) {
+	return func(streamID string) (*srtPublish, error) {
+		u, err := srtURL(host, streamID)
+		if err != nil {
+			return nil, err
+		}
+		params := createRTMPStreamIDHandler(s)(u)
+		if params == nil {
+			return nil, errSRTDenied
+		}
+		return &srtPublish{url: u, params: params}, nil
+	}
+}
+
+// publishSRT feeds the stream read from an SRT caller to the segmenter,
+// until the caller disconnects or the stream is ended
+func publishSRT(s *LivepeerServer, pub *srtPublish, conn io.ReadCloser) {
+	strm := stream.NewBasicRTMPVideoStream(pub.params)
+	eof, err := strm.WriteRTMPToStream(context.Background(), &tsDemuxCloser{ts.NewDemuxer(conn), conn})
+	if err != nil {
+		glog.Errorf("Error reading SRT stream url=%s: %v", pub.url, err)
+		conn.Close()
+		return
+	}
+	if err := gotRTMPStreamHandler(s)(pub.url, strm); err != nil {
+		glog.Errorf("Error SRT gotStream handler url=%s: %v", pub.url, err)
+		endRTMPStreamHandler(s)(pub.url, strm)
+		conn.Close()
+		return
+	}
+	<-eof
+	endRTMPStreamHandler(s)(pub.url, strm)
+}
+
+// srtURL gives the URL a stream published over SRT would have over RTMP.
+// Stream IDs either follow the SRT access control syntax, eg
+// "#!::r=live/abc,m=publish", or are the path themselves. With the former,
+// the resource becomes the path and keys other than the mode and host are
+// kept as query parameters.
+func srtURL(host, streamID string) (*url.URL, error) {
+	if !strings.HasPrefix(streamID, "#!::") {
+		return url.Parse("srt://" + host + "/" + strings.TrimLeft(streamID, "/"))
+	}
+	u := &url.URL{Scheme: "srt", Host: host}
+	q := url.Values{}
+	for _, kv := range strings.Split(strings.TrimPrefix(streamID, "#!::"), ",") {
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stream ID %q", streamID)
+		}
+		switch parts[0] {
+		case "r":
+			u.Path = "/" + strings.TrimLeft(parts[1], "/")
+		case "h":
+			u.Host = parts[1]
+		case "m":
+			if parts[1] != "publish" {
+				return nil, fmt.Errorf("unsupported mode %q; streams can only be published", parts[1])
+			}
+		default:
+			q.Set(parts[0], parts[1])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	srt "github.com/datarhei/gosrt"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/joy4/av/avutil"
+	"github.com/livepeer/joy4/format/flv"
+	"github.com/livepeer/joy4/format/ts"
+	lpmscore "github.com/livepeer/lpms/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRTURL(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		streamID string
+		url      string
+	}{
+		{"", "srt://127.0.0.1:9000/"},
+		{"live/abc", "srt://127.0.0.1:9000/live/abc"},
+		{"/abc?key=1", "srt://127.0.0.1:9000/abc?key=1"},
+		{"#!::r=live/abc", "srt://127.0.0.1:9000/live/abc"},
+		{"#!::r=/abc,m=publish,u=user,s=123", "srt://127.0.0.1:9000/abc?s=123&u=user"},
+		{"#!::h=example.com,r=abc", "srt://example.com/abc"},
+		{"#!::", "srt://127.0.0.1:9000"},
+	}
+	for _, tt := range tests {
+		u, err := srtURL("127.0.0.1:9000", tt.streamID)
+		if assert.Nil(err, tt.streamID) {
+			assert.Equal(tt.url, u.String(), tt.streamID)
+		}
+	}
+
+	_, err := srtURL("127.0.0.1:9000", "#!::r=abc,m=request")
+	assert.EqualError(err, `unsupported mode "request"; streams can only be published`)
+	_, err = srtURL("127.0.0.1:9000", "#!::r=abc,publish")
+	assert.EqualError(err, `invalid stream ID "#!::r=abc,publish"`)
+}
+
+func TestAuthorizeSRT(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer func() { AuthWebhookURL = "" }()
+
+	urls := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authWebhookReq
+		out, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(out, &req)
+		urls <- req.URL
+		if req.URL == "srt://127.0.0.1:9000/live/denied" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"manifestID":"srt"}`))
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+	authorize := authorizeSRT(s, "127.0.0.1:9000")
+
+	pub, err := authorize("#!::r=live/abc,u=user")
+	require.Nil(err)
+	assert.Equal("srt://127.0.0.1:9000/live/abc?u=user", <-urls)
+	assert.Equal("srt://127.0.0.1:9000/live/abc?u=user", pub.url.String())
+	assert.Equal(core.ManifestID("srt"), pub.params.(*streamParameters).mid)
+
+	_, err = authorize("live/denied")
+	assert.Equal(errSRTDenied, err)
+	assert.Equal("srt://127.0.0.1:9000/live/denied", <-urls)
+
+	// Callers that want to play aren't let through to the webhook
+	_, err = authorize("#!::r=live/abc,m=request")
+	assert.NotNil(err)
+	assert.Empty(urls)
+}
+
+func TestPublishSRT(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer func(seg lpmscore.RTMPSegmenter) { s.RTMPSegmenter = seg }(s.RTMPSegmenter)
+	s.RTMPSegmenter = &StubSegmenter{skip: true}
+
+	// Callers send MPEG-TS
+	f, err := os.Open("test.flv")
+	require.Nil(err)
+	defer f.Close()
+	var buf bytes.Buffer
+	require.Nil(avutil.CopyFile(ts.NewMuxer(&buf), flv.NewDemuxer(f)))
+
+	mid := core.ManifestID(t.Name())
+	u, _ := url.Parse("srt://127.0.0.1:9000/live/" + string(mid))
+	pub := &srtPublish{url: u, params: &streamParameters{mid: mid}}
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		publishSRT(s, pub, r)
+		close(done)
+	}()
+	go io.Copy(w, &buf)
+
+	live := func() bool {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		_, ok := s.rtmpConnections[mid]
+		return ok
+	}
+	assert.Eventually(live, time.Second, 10*time.Millisecond)
+
+	// Ends with the caller
+	w.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stream didn't end")
+	}
+	assert.False(live())
+
+	// Callers that never send a stream are disconnected
+	r, w = io.Pipe()
+	w.CloseWithError(io.ErrUnexpectedEOF)
+	publishSRT(s, pub, r)
+	assert.False(live())
+}
+
+// srtTestAddr returns a local address with a free UDP port
+func srtTestAddr(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer pc.Close()
+	return pc.LocalAddr().String()
+}
+
+// segmentsIngested is the number of segments of the stream that reached
+// processSegment
+func segmentsIngested(s *LivepeerServer, mid core.ManifestID) int {
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !ok {
+		return 0
+	}
+	cxn.stats.mu.Lock()
+	defer cxn.stats.mu.Unlock()
+	return cxn.stats.ingested
+}
+
+func TestServeSRT(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer func(seg lpmscore.RTMPSegmenter) { s.RTMPSegmenter = seg }(s.RTMPSegmenter)
+	s.RTMPSegmenter = &StubSegmenter{}
+	defer func() { AuthWebhookURL = "" }()
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authWebhookReq
+		out, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(out, &req)
+		if strings.HasSuffix(req.URL, "/denied") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer hook.Close()
+	AuthWebhookURL = hook.URL
+
+	addr := srtTestAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.serveSRT(ctx, addr) }()
+	defer func() {
+		cancel()
+		assert.Equal(context.Canceled, <-done)
+	}()
+
+	dial := func(cfg srt.Config) (srt.Conn, error) {
+		var conn srt.Conn
+		var err error
+		// The listener may still be starting
+		cfg.ConnectionTimeout = 200 * time.Millisecond
+		for i := 0; i < 10; i++ {
+			if conn, err = srt.Dial("srt", addr, cfg); err == nil || strings.Contains(err.Error(), "rejected") {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return conn, err
+	}
+
+	// Denied by the auth webhook
+	cfg := srt.DefaultConfig()
+	cfg.StreamId = "live/denied"
+	_, err := dial(cfg)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "connection rejected")
+	}
+
+	// Encrypted callers are turned away
+	cfg.StreamId = "live/secret"
+	cfg.Passphrase = "0123456789"
+	_, err = dial(cfg)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "connection rejected")
+	}
+
+	// Published streams go through the segmenter to processSegment
+	mid := core.ManifestID(t.Name())
+	cfg = srt.DefaultConfig()
+	cfg.StreamId = "#!::r=live/" + string(mid) + ",m=publish"
+	conn, err := dial(cfg)
+	require.Nil(err)
+
+	f, err := os.Open("test.flv")
+	require.Nil(err)
+	defer f.Close()
+	var buf bytes.Buffer
+	require.Nil(avutil.CopyFile(ts.NewMuxer(&buf), flv.NewDemuxer(f)))
+	// Paced, since live mode callers don't queue up much
+	for data := buf.Bytes(); len(data) > 0 && segmentsIngested(s, mid) == 0; {
+		n := len(data)
+		if n > 1316 {
+			n = 1316
+		}
+		_, err := conn.Write(data[:n])
+		require.Nil(err)
+		data = data[n:]
+		time.Sleep(time.Millisecond)
+	}
+	assert.Eventually(func() bool { return segmentsIngested(s, mid) > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// The stream ends with the caller
+	conn.Close()
+	live := func() bool {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		_, ok := s.rtmpConnections[mid]
+		return ok
+	}
+	assert.Eventually(func() bool { return !live() }, 5*time.Second, 10*time.Millisecond)
+}
+
+// Publishes with ffmpeg, so that the stream is segmented by the real
+// segmenter. Needs an ffmpeg built with libsrt.
+func TestServeSRT_FFmpeg(t *testing.T) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg not found")
+	}
+	if out, err := exec.Command(ffmpegPath, "-hide_banner", "-protocols").Output(); err != nil || !strings.Contains(string(out), "srt") {
+		t.Skip("ffmpeg built without SRT support")
+	}
+
+	s := setupServer()
+	defer func(seg lpmscore.RTMPSegmenter) { s.RTMPSegmenter = seg }(s.RTMPSegmenter)
+	s.RTMPSegmenter = s.LPMS
+
+	addr := srtTestAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.serveSRT(ctx, addr)
+
+	mid := core.ManifestID(t.Name())
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-loglevel", "error",
+		"-re", "-stream_loop", "-1", "-i", "test.flv", "-c", "copy",
+		"-f", "mpegts", fmt.Sprintf("srt://%s?streamid=%s", addr, mid))
+	require.Nil(t, cmd.Start())
+	defer cmd.Wait()
+
+	assert.Eventually(t, func() bool { return segmentsIngested(s, mid) > 1 }, 20*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// Number of recent latencies kept per rendition to compute percentiles
+const latencySamples = 100
+
+// StreamStats are the figures reported by /streamStats for a live stream
+type StreamStats struct {
+	ManifestID         core.ManifestID
+	SegmentsIngested   int
+	SegmentsTranscoded int
+	SegmentsFailed     int
+	// Time from a segment being ingested to each rendition being ready,
+	// over the last few segments
+	RenditionLatency map[string]LatencyPercentiles
+	Orchestrators    []OrchestratorStats
+	TicketsSent      int
+	EVSpent          *big.Rat
+}
+
+// LatencyPercentiles are in seconds
+type LatencyPercentiles struct {
+	P50     float64
+	P90     float64
+	P99     float64
+	Samples int
+}
+
+// OrchestratorStats describes how much a stream used an orchestrator
+type OrchestratorStats struct {
+	Transcoder  string
+	Address     *ethcommon.Address `json:",omitempty"`
+	Segments    int
+	Failures    int
+	TicketsSent int
+	EVSpent     *big.Rat
+	// Credit the broadcaster holds with the orchestrator for the stream
+	Balance *big.Rat `json:",omitempty"`
+}
+
+// streamStats accumulates the figures for a stream as its segments are
+// processed. Methods are safe to call on a nil streamStats.
+type streamStats struct {
+	mu sync.Mutex
+
+	ingested   int
+	transcoded int
+	failed     int
+	// When the segments being processed were ingested, by seqNo
+	ingestedAt map[uint64]time.Time
+	// Recent latencies per rendition, oldest first
+	latencies map[string][]time.Duration
+	// Keyed by transcoder URI
+	orchs map[string]*OrchestratorStats
+}
+
+func newStreamStats() *streamStats {
+	return &streamStats{
+		ingestedAt: make(map[uint64]time.Time),
+		latencies:  make(map[string][]time.Duration),
+		orchs:      make(map[string]*OrchestratorStats),
+	}
+}
+
+func (s *streamStats) segmentIngested(seqNo uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ingested++
+	s.ingestedAt[seqNo] = time.Now()
+}
+
+// segmentDone is called once a segment is no longer being processed
+func (s *streamStats) segmentDone(seqNo uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ingestedAt, seqNo)
+}
+
+func (s *streamStats) segmentTranscoded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcoded++
+}
+
+func (s *streamStats) segmentFailed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+}
+
+func (s *streamStats) renditionReady(profile string, seqNo uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.ingestedAt[seqNo]
+	if !ok {
+		return
+	}
+	l := append(s.latencies[profile], time.Since(at))
+	if len(l) > latencySamples {
+		l = l[len(l)-latencySamples:]
+	}
+	s.latencies[profile] = l
+}
+
+// orchestratorUsed records a segment submitted to the session's
+// orchestrator, along with any payment sent with it
+func (s *streamStats) orchestratorUsed(sess *BroadcastSession, ok bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sess.OrchestratorInfo.GetTranscoder()
+	o, exists := s.orchs[key]
+	if !exists {
+		o = &OrchestratorStats{Transcoder: key, EVSpent: big.NewRat(0, 1)}
+		s.orchs[key] = o
+	}
+	if tp := sess.OrchestratorInfo.GetTicketParams(); tp != nil && len(tp.Recipient) > 0 {
+		addr := ethcommon.BytesToAddress(tp.Recipient)
+		o.Address = &addr
+	}
+	if ok {
+		o.Segments++
+	} else {
+		o.Failures++
+	}
+	o.TicketsSent += sess.ticketsSent
+	if sess.evSent != nil {
+		o.EVSpent.Add(o.EVSpent, sess.evSent)
+	}
+}
+
+func (s *streamStats) snapshot(mid core.ManifestID) *StreamStats {
+	res := &StreamStats{
+		ManifestID:       mid,
+		RenditionLatency: make(map[string]LatencyPercentiles),
+		Orchestrators:    []OrchestratorStats{},
+		EVSpent:          big.NewRat(0, 1),
+	}
+	if s == nil {
+		return res
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res.SegmentsIngested, res.SegmentsTranscoded, res.SegmentsFailed = s.ingested, s.transcoded, s.failed
+	for profile, l := range s.latencies {
+		res.RenditionLatency[profile] = percentiles(l)
+	}
+	for _, o := range s.orchs {
+		cp := *o
+		cp.EVSpent = new(big.Rat).Set(o.EVSpent)
+		res.Orchestrators = append(res.Orchestrators, cp)
+		res.TicketsSent += o.TicketsSent
+		res.EVSpent.Add(res.EVSpent, o.EVSpent)
+	}
+	sort.Slice(res.Orchestrators, func(i, j int) bool {
+		return res.Orchestrators[i].Transcoder < res.Orchestrators[j].Transcoder
+	})
+	return res
+}
+
+// percentiles uses the nearest-rank method
+func percentiles(l []time.Duration) LatencyPercentiles {
+	sorted := append([]time.Duration(nil), l...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i].Seconds()
+	}
+	return LatencyPercentiles{P50: rank(.50), P90: rank(.90), P99: rank(.99), Samples: len(sorted)}
+}
+
+// StreamStats returns the figures for a live stream, including the current
+// balance with each orchestrator it used
+func (s *LivepeerServer) StreamStats(mid core.ManifestID) (*StreamStats, error) {
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !ok {
+		return nil, errUnknownStream
+	}
+	stats := cxn.stats.snapshot(mid)
+	if balances := s.LivepeerNode.Balances; balances != nil {
+		for i, o := range stats.Orchestrators {
+			if o.Address != nil {
+				stats.Orchestrators[i].Balance = balances.Balance(*o.Address, mid)
+			}
+		}
+	}
+	return stats, nil
+}
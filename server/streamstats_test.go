@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentiles(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(LatencyPercentiles{}, percentiles(nil))
+
+	var l []time.Duration
+	for i := 100; i > 0; i-- {
+		l = append(l, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(LatencyPercentiles{P50: .050, P90: .090, P99: .099, Samples: 100}, percentiles(l))
+	assert.Equal(100*time.Millisecond, l[0], "Samples were reordered")
+
+	assert.Equal(LatencyPercentiles{P50: 1, P90: 1, P99: 1, Samples: 1}, percentiles([]time.Duration{time.Second}))
+}
+
+func TestStreamStats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	oldPool := s.LivepeerNode.OrchestratorPool
+	s.LivepeerNode.OrchestratorPool = nil
+	defer func() {
+		s.LivepeerNode.OrchestratorPool = oldPool
+		s.LivepeerNode.Balances = nil
+	}()
+
+	mid := core.ManifestID(t.Name())
+	_, err := s.StreamStats(mid)
+	assert.Equal(errUnknownStream, err)
+
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid})
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+
+	// No orchestrators
+	oldRetry := SegmentRetry
+	defer func() { SegmentRetry = oldRetry }()
+	SegmentRetry.MaxAttempts = 1
+	assert.Nil(processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy"), Duration: 2}))
+
+	// Renditions come back
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	buf, err := proto.Marshal(&net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{
+			&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+			&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts"},
+		}}},
+	})
+	require.Nil(err)
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf)
+	})
+	mux.HandleFunc("/rendition.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rendition"))
+	})
+	sess := StubBroadcastSession(ts.URL)
+	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
+	sess.BroadcasterOS = drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn.sessManager = bsmWithSessList([]*BroadcastSession{sess})
+	assert.Nil(processSegment(cxn, &stream.HLSSegment{SeqNo: 2, Data: []byte("dummy"), Duration: 2}))
+
+	// Payments are counted per orchestrator, along with the balance left
+	addr := ethcommon.HexToAddress("0x00000000000000000000000000000000000000aa")
+	paid := StubBroadcastSession("https://paid.example:8935")
+	paid.OrchestratorInfo.TicketParams = &net.TicketParams{Recipient: addr.Bytes()}
+	paid.ticketsSent, paid.evSent = 2, big.NewRat(10, 1)
+	cxn.stats.orchestratorUsed(paid, true)
+	paid.ticketsSent, paid.evSent = 1, big.NewRat(5, 1)
+	cxn.stats.orchestratorUsed(paid, false)
+	s.LivepeerNode.Balances = core.NewAddressBalances(time.Minute)
+	defer s.LivepeerNode.Balances.StopCleanup()
+	s.LivepeerNode.Balances.Credit(addr, mid, big.NewRat(3, 1))
+
+	resp := httpGetResp(streamStatsHandler(s))
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	w := httptest.NewRecorder()
+	streamStatsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/streamStats/"+string(mid), nil))
+	require.Equal(http.StatusOK, w.Code)
+	var stats StreamStats
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &stats))
+
+	assert.Equal(mid, stats.ManifestID)
+	assert.Equal(2, stats.SegmentsIngested)
+	assert.Equal(1, stats.SegmentsTranscoded)
+	assert.Equal(1, stats.SegmentsFailed)
+	assert.Len(stats.RenditionLatency, 2)
+	lat := stats.RenditionLatency["P144p30fps16x9"]
+	assert.Equal(1, lat.Samples)
+	assert.True(lat.P50 > 0 && lat.P50 == lat.P99)
+	assert.Equal(3, stats.TicketsSent)
+	assert.Equal(big.NewRat(15, 1), stats.EVSpent)
+
+	require.Len(stats.Orchestrators, 2)
+	orchStats, paidStats := stats.Orchestrators[0], stats.Orchestrators[1]
+	assert.Equal("https://paid.example:8935", paidStats.Transcoder)
+	assert.Equal(addr, *paidStats.Address)
+	assert.Equal(1, paidStats.Segments)
+	assert.Equal(1, paidStats.Failures)
+	assert.Equal(3, paidStats.TicketsSent)
+	assert.Equal(big.NewRat(15, 1), paidStats.EVSpent)
+	assert.Equal(big.NewRat(3, 1), paidStats.Balance)
+	assert.Equal(ts.URL, orchStats.Transcoder)
+	assert.Nil(orchStats.Address)
+	assert.Equal(1, orchStats.Segments)
+	assert.Equal(0, orchStats.TicketsSent)
+	assert.Nil(orchStats.Balance)
+
+	// Segments no longer in flight aren't tracked
+	cxn.stats.mu.Lock()
+	assert.Empty(cxn.stats.ingestedAt)
+	cxn.stats.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	streamStatsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/streamStats/nonexistent", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+}
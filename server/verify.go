@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/verification"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+)
+
+// SegmentVerifier checks the renditions of a sample of segments. Nil if
+// verification is off.
+var SegmentVerifier *verification.Policy
+
+// rendition is a transcoded segment waiting to be verified
+type rendition struct {
+	profile ffmpeg.VideoProfile
+	url     string
+	// Set if the broadcaster already downloaded the rendition
+	data   []byte
+	pixels int64
+}
+
+// verifySegment runs SegmentVerifier on the renditions of a segment. The
+// session is removed if any of them fails.
+func verifySegment(cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment, renditions []*rendition) error {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source.ts")
+	if err := ioutil.WriteFile(source, seg.Data, 0644); err != nil {
+		return err
+	}
+
+	for i, r := range renditions {
+		if r == nil {
+			continue
+		}
+		data := r.data
+		if data == nil {
+			// Uploaded straight to our storage, or left in the orchestrator's
+			if data, err = fetchRendition(r.url, sess.BroadcasterOS); err != nil {
+				glog.Errorf("Error fetching rendition for verification nonce=%d seqNo=%d url=%s: %v", cxn.nonce, seg.SeqNo, r.url, err)
+				return err
+			}
+		}
+		fname := filepath.Join(dir, fmt.Sprintf("%d.ts", i))
+		if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+			return err
+		}
+		params := &verification.Params{
+			Fname:    fname,
+			Source:   source,
+			Profile:  r.profile,
+			Duration: seg.Duration,
+			Pixels:   r.pixels,
+		}
+		if err := SegmentVerifier.Verify(params); err != nil {
+			glog.Errorf("Rendition failed verification nonce=%d manifestID=%s seqNo=%d orch=%s profile=%s: %v",
+				cxn.nonce, cxn.mid, seg.SeqNo, sess.OrchestratorInfo.Transcoder, r.profile.Name, err)
+			cxn.sessManager.evictSession(sess)
+			if monitor.Enabled {
+				monitor.SegmentVerified(cxn.nonce, seg.SeqNo, err.(*verification.Error).Verifier)
+			}
+			return err
+		}
+	}
+	if monitor.Enabled {
+		monitor.SegmentVerified(cxn.nonce, seg.SeqNo, "")
+	}
+	return nil
+}
+
+func fetchRendition(uri string, bos drivers.OSSession) ([]byte, error) {
+	if localOS, ok := bos.(localOSSession); ok {
+		if u, err := url.ParseRequestURI(uri); err == nil && !u.IsAbs() {
+			data := localOS.GetData(uri)
+			if data == nil {
+				return nil, errors.New("error fetching data from local storage")
+			}
+			return data, nil
+		}
+	}
+	return drivers.GetSegmentData(uri)
+}
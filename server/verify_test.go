@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/verification"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySegment(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { SegmentVerifier = nil }()
+
+	var checked []string
+	var verifyErr error
+	SegmentVerifier = &verification.Policy{
+		SampleRate: 1,
+		Verifiers: map[string]verification.Verifier{
+			"stub": verification.VerifierFunc(func(p *verification.Params) error {
+				data, _ := ioutil.ReadFile(p.Fname)
+				source, _ := ioutil.ReadFile(p.Source)
+				assert.Equal("source", string(source))
+				assert.Equal(2.0, p.Duration)
+				checked = append(checked, p.Profile.Name+":"+string(data))
+				return verifyErr
+			}),
+		},
+	}
+
+	bos := drivers.NewMemoryDriver(nil).NewSession("foo")
+	uri, err := bos.SaveData("P240p30fps16x9/1.ts", []byte("stored"))
+	require.Nil(t, err)
+	sess := StubBroadcastSession("transcoder1")
+	sess.BroadcasterOS = bos
+	cxn := &rtmpConnection{mid: "foo", sessManager: bsmWithSessList([]*BroadcastSession{sess})}
+	seg := &stream.HLSSegment{SeqNo: 1, Data: []byte("source"), Duration: 2}
+	renditions := []*rendition{
+		&rendition{profile: ffmpeg.P144p30fps16x9, url: "ignored", data: []byte("downloaded")},
+		nil, // failed to insert
+		&rendition{profile: ffmpeg.P240p30fps16x9, url: uri},
+	}
+
+	// Renditions that weren't downloaded are fetched from storage
+	assert.Nil(verifySegment(cxn, sess, seg, renditions))
+	assert.Equal([]string{"P144p30fps16x9:downloaded", "P240p30fps16x9:stored"}, checked)
+	assert.Len(cxn.sessManager.sessList, 1)
+
+	// Failing to fetch isn't held against the orchestrator
+	renditions[2].url = "/stream/foo/nonexistent.ts"
+	assert.EqualError(verifySegment(cxn, sess, seg, renditions), "error fetching data from local storage")
+	assert.Len(cxn.sessManager.sessList, 1)
+
+	// Failing a check removes the session
+	verifyErr = errors.New("bad rendition")
+	assert.EqualError(verifySegment(cxn, sess, seg, renditions), "stub verification failed: bad rendition")
+	assert.Len(cxn.sessManager.sessList, 0)
+}
+
+func TestTranscodeSegment_Verification(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { SegmentVerifier = nil }()
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{
+			&net.TranscodedSegmentData{Url: ts.URL + "/rendition.ts", Pixels: 100},
+		}}},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(err)
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf)
+	})
+	mux.HandleFunc("/rendition.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rendition"))
+	})
+
+	verified := make(chan *verification.Params, 1)
+	var data []byte
+	SegmentVerifier = &verification.Policy{
+		SampleRate: 1,
+		Verifiers: map[string]verification.Verifier{
+			"stub": verification.VerifierFunc(func(p *verification.Params) error {
+				data, _ = ioutil.ReadFile(p.Fname)
+				verified <- p
+				return errors.New("bad rendition")
+			}),
+		},
+	}
+
+	sess := StubBroadcastSession(ts.URL)
+	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	cxn := &rtmpConnection{
+		mid:         core.ManifestID("foo"),
+		nonce:       7,
+		pl:          &stubPlaylistManager{core.ManifestID("foo")},
+		profile:     &ffmpeg.P144p30fps16x9,
+		sessManager: bsmWithSessList([]*BroadcastSession{sess}),
+	}
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy"), Duration: 2}, "dummy", nil)
+	assert.Nil(err)
+
+	select {
+	case p := <-verified:
+		assert.Equal("rendition", string(data))
+		assert.Equal(ffmpeg.P144p30fps16x9, p.Profile)
+		assert.Equal(int64(100), p.Pixels)
+		assert.Equal(2.0, p.Duration)
+	case <-time.After(time.Second):
+		t.Fatal("Segment was not verified")
+	}
+	// The orchestrator is evicted once verification fails
+	time.Sleep(20 * time.Millisecond)
+	bsm := cxn.sessManager
+	bsm.sessLock.Lock()
+	assert.Len(bsm.sessList, 0)
+	assert.Len(bsm.cooling, 0)
+	assert.True(bsm.evicted[ts.URL])
+	bsm.sessLock.Unlock()
+
+	// and isn't brought back by a refresh
+	bsm.refreshSessions()
+	assert.Nil(bsm.selectSession())
+}
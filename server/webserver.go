@@ -113,10 +113,18 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		}
 
 		profiles := []ffmpeg.VideoProfile{}
-		for _, pName := range strings.Split(transcodingOptions, ",") {
-			p, ok := ffmpeg.VideoProfileLookup[pName]
-			if ok {
-				profiles = append(profiles, p)
+		if strings.HasPrefix(strings.TrimSpace(transcodingOptions), "[") {
+			// JSON list of custom profiles
+			if profiles, err = lpcommon.ParseProfilesJSON([]byte(transcodingOptions)); err != nil {
+				glog.Errorf("Invalid transcoding options: %v", err)
+				return
+			}
+		} else {
+			for _, pName := range strings.Split(transcodingOptions, ",") {
+				p, ok := ffmpeg.VideoProfileLookup[pName]
+				if ok {
+					profiles = append(profiles, p)
+				}
 			}
 		}
 		if len(profiles) == 0 {
@@ -731,18 +739,9 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		w.Write([]byte(s.LastManifestID()))
 	})
 
-	mux.HandleFunc("/localStreams", func(w http.ResponseWriter, r *http.Request) {
-		// XXX fetch local streams?
-		ret := make([]map[string]string, 0)
-		js, err := json.Marshal(ret)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(js)
-	})
+	mux.Handle("/localStreams", localStreamsHandler(s))
+	mux.Handle("/endStream", mustHaveFormParams(endStreamHandler(s), "manifestID"))
+	mux.Handle("/streamStats/", streamStatsHandler(s))
 
 	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(fmt.Sprintf("\n\nLatestPlaylist: %v", s.LatestPlaylist())))
@@ -1030,6 +1029,12 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		w.Write([]byte(fmt.Sprintf("%v", s.LivepeerNode.NodeType == core.OrchestratorNode)))
 	})
 
+	mux.Handle("/drain", drainHandler(s.LivepeerNode))
+	mux.Handle("/transcoderTokens", transcoderTokensHandler(s.LivepeerNode))
+	mux.Handle("/issueTranscoderToken", mustHaveFormParams(issueTranscoderTokenHandler(s.LivepeerNode), "name"))
+	mux.Handle("/revokeTranscoderToken", mustHaveFormParams(revokeTranscoderTokenHandler(s.LivepeerNode), "name"))
+	mux.Handle("/disconnectTranscoder", mustHaveFormParams(disconnectTranscoderHandler(s.LivepeerNode), "id"))
+
 	mux.HandleFunc("/EthChainID", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth == nil {
 			w.Write([]byte("0"))
@@ -0,0 +1,87 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// How far the frame count and duration of a rendition may be off from the
+// source, as a fraction of the expected value
+var FrameTolerance = 0.1
+var DurationTolerance = 0.1
+
+// ExpectedCodec is the video codec renditions should be encoded with
+var ExpectedCodec = "H264"
+
+func verifyResolution(p *Params) error {
+	w, h, err := ffmpeg.VideoProfileResolution(p.Profile)
+	if err != nil {
+		return err
+	}
+	media, err := p.decode()
+	if err != nil {
+		return err
+	}
+	if media.Frames <= 0 {
+		return errors.New("no frames")
+	}
+	if perFrame := media.Pixels / int64(media.Frames); perFrame != int64(w*h) {
+		return fmt.Errorf("expected %dx%d or %d pixels per frame, got %d", w, h, w*h, perFrame)
+	}
+	return nil
+}
+
+func verifyFrames(p *Params) error {
+	// Nothing to compare against if the source frame rate is kept
+	if p.Profile.Framerate == 0 || p.Duration <= 0 {
+		return nil
+	}
+	media, err := p.decode()
+	if err != nil {
+		return err
+	}
+	expected := p.Duration * float64(p.Profile.Framerate)
+	if math.Abs(float64(media.Frames)-expected) > math.Max(FrameTolerance*expected, 1) {
+		return fmt.Errorf("expected %.0f frames, got %d", expected, media.Frames)
+	}
+	return nil
+}
+
+func verifyDuration(p *Params) error {
+	if p.Duration <= 0 {
+		return nil
+	}
+	ts, err := p.probe()
+	if err != nil {
+		return err
+	}
+	if dur := ts.duration(); math.Abs(dur-p.Duration) > DurationTolerance*p.Duration {
+		return fmt.Errorf("expected %.3fs, got %.3fs", p.Duration, dur)
+	}
+	return nil
+}
+
+func verifyCodec(p *Params) error {
+	ts, err := p.probe()
+	if err != nil {
+		return err
+	}
+	if codec := ts.codec(); codec != ExpectedCodec {
+		return fmt.Errorf("expected %s video, got %s", ExpectedCodec, codec)
+	}
+	return nil
+}
+
+func verifyPixels(p *Params) error {
+	media, err := p.decode()
+	if err != nil {
+		return err
+	}
+	if media.Pixels != p.Pixels {
+		return fmt.Errorf("reported %d pixels, got %d", p.Pixels, media.Pixels)
+	}
+	return nil
+}
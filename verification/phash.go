@@ -0,0 +1,144 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// Mean number of bits, out of 64, the hashes of the rendition's frames may
+// differ from those of the source
+var PerceptualHashThreshold = 10.0
+
+// Number of frames compared, spread over the segment
+var perceptualHashFrames = 5
+
+// verifyPerceptualHash scales the source into the requested profile locally
+// and compares it with the rendition frame by frame
+func verifyPerceptualHash(p *Params) error {
+	if p.Source == "" {
+		return errors.New("no source segment")
+	}
+	w, h, err := ffmpeg.VideoProfileResolution(p.Profile)
+	if err != nil {
+		return err
+	}
+	rendition, err := rawFrames(p.Fname, p.Profile)
+	if err != nil {
+		return err
+	}
+	source, err := rawFrames(p.Source, p.Profile)
+	if err != nil {
+		return err
+	}
+	a, err := frameHashes(rendition, w, h, perceptualHashFrames)
+	if err != nil {
+		return err
+	}
+	b, err := frameHashes(source, w, h, perceptualHashFrames)
+	if err != nil {
+		return err
+	}
+	if dist := hashDistance(a, b); dist > PerceptualHashThreshold {
+		return fmt.Errorf("frames differ from the source by %.1f bits", dist)
+	}
+	return nil
+}
+
+// rawFrames decodes a segment into raw YUV 4:2:0 frames in the given profile
+func rawFrames(fname string, profile ffmpeg.VideoProfile) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	oname := filepath.Join(dir, common.RandName()+".yuv")
+	in := &ffmpeg.TranscodeOptionsIn{Fname: fname}
+	out := []ffmpeg.TranscodeOptions{{
+		Oname:        oname,
+		Profile:      profile,
+		Muxer:        ffmpeg.ComponentOptions{Name: "rawvideo"},
+		VideoEncoder: ffmpeg.ComponentOptions{Name: "rawvideo"},
+		AudioEncoder: ffmpeg.ComponentOptions{Name: "drop"},
+	}}
+	if _, err := ffmpeg.Transcode3(in, out); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(oname)
+}
+
+// frameHashes returns the average hashes of count frames spread evenly over
+// raw YUV 4:2:0 data
+func frameHashes(raw []byte, w, h, count int) ([]uint64, error) {
+	frameSize := w * h * 3 / 2
+	frames := len(raw) / frameSize
+	if frames == 0 {
+		return nil, errors.New("no frames")
+	}
+	if count > frames {
+		count = frames
+	}
+	hashes := make([]uint64, count)
+	for i := range hashes {
+		n := 0
+		if count > 1 {
+			n = i * (frames - 1) / (count - 1)
+		}
+		// The luma plane comes first
+		hashes[i] = averageHash(raw[n*frameSize:n*frameSize+w*h], w, h)
+	}
+	return hashes, nil
+}
+
+// averageHash shrinks a luma plane to 8x8 blocks and sets a bit for every
+// block brighter than the mean
+func averageHash(luma []byte, w, h int) uint64 {
+	var blocks [64]uint64
+	var counts [64]uint64
+	for y := 0; y < h; y++ {
+		row := y * 8 / h * 8
+		for x := 0; x < w; x++ {
+			b := row + x*8/w
+			blocks[b] += uint64(luma[y*w+x])
+			counts[b]++
+		}
+	}
+	var total uint64
+	for i := range blocks {
+		if counts[i] > 0 {
+			blocks[i] /= counts[i]
+		}
+		total += blocks[i]
+	}
+	mean := total / 64
+	var hash uint64
+	for i, v := range blocks {
+		if v > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// hashDistance returns the mean number of differing bits between two sets
+// of hashes
+func hashDistance(a, b []uint64) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n == 0 {
+		return 64
+	}
+	total := 0
+	for i := 0; i < n; i++ {
+		total += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return float64(total) / float64(n)
+}
@@ -0,0 +1,159 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+)
+
+const tsPacketSize = 188
+
+// Stream types of the video codecs in the PMT
+var tsVideoCodecs = map[byte]string{
+	0x01: "MPEG1",
+	0x02: "MPEG2",
+	0x10: "MPEG4",
+	0x1b: "H264",
+	0x24: "HEVC",
+}
+
+var errNoVideo = errors.New("no video stream")
+
+// tsInfo is what probeTS finds out about the video stream of a segment
+type tsInfo struct {
+	streamType byte
+	// Number of PES packets, which carry one frame each
+	frames int
+	// Lowest and highest presentation timestamps, in 90kHz units
+	minPTS, maxPTS int64
+}
+
+func (i *tsInfo) codec() string {
+	if c, ok := tsVideoCodecs[i.streamType]; ok {
+		return c
+	}
+	return fmt.Sprintf("unknown (stream type 0x%02x)", i.streamType)
+}
+
+// duration in seconds, from the first frame to the end of the last one
+func (i *tsInfo) duration() float64 {
+	if i.frames < 2 {
+		return 0
+	}
+	span := float64(i.maxPTS-i.minPTS) / 90000
+	return span * float64(i.frames) / float64(i.frames-1)
+}
+
+// probeTS reads the codec and timestamps of the video stream of an MPEG-TS
+// segment from the PAT, PMT and PES headers
+func probeTS(data []byte) (*tsInfo, error) {
+	if len(data) < tsPacketSize || data[0] != 0x47 {
+		return nil, errors.New("not an MPEG-TS segment")
+	}
+	pmtPID, videoPID := -1, -1
+	var info *tsInfo
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != 0x47 {
+			return nil, fmt.Errorf("lost sync at offset %d", off)
+		}
+		pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+		start := pkt[1]&0x40 != 0
+		payload := tsPayload(pkt)
+		if !start || payload == nil {
+			continue
+		}
+		switch {
+		case pid == 0 && pmtPID < 0:
+			pmtPID = parsePAT(payload)
+		case pid == pmtPID && info == nil:
+			videoPID, info = parsePMT(payload)
+		case pid == videoPID && info != nil:
+			pts, ok := parsePTS(payload)
+			if !ok {
+				continue
+			}
+			if info.frames == 0 || pts < info.minPTS {
+				info.minPTS = pts
+			}
+			if info.frames == 0 || pts > info.maxPTS {
+				info.maxPTS = pts
+			}
+			info.frames++
+		}
+	}
+	if info == nil {
+		return nil, errNoVideo
+	}
+	return info, nil
+}
+
+// tsPayload returns the payload of a packet, skipping the adaptation field
+func tsPayload(pkt []byte) []byte {
+	afc := pkt[3] >> 4 & 0x3
+	if afc&0x1 == 0 {
+		return nil
+	}
+	i := 4
+	if afc&0x2 != 0 {
+		i += 1 + int(pkt[4])
+	}
+	if i >= len(pkt) {
+		return nil
+	}
+	return pkt[i:]
+}
+
+// psiSection returns the body of the section at the start of a PSI payload,
+// between the section header and the CRC
+func psiSection(payload []byte) []byte {
+	i := 1 + int(payload[0]) // pointer field
+	if i+8 > len(payload) {
+		return nil
+	}
+	length := int(payload[i+1]&0x0f)<<8 | int(payload[i+2])
+	end := i + 3 + length - 4
+	if end > len(payload) || end < i+8 {
+		return nil
+	}
+	return payload[i+8 : end]
+}
+
+// parsePAT returns the PMT PID of the first program
+func parsePAT(payload []byte) int {
+	section := psiSection(payload)
+	for j := 0; j+4 <= len(section); j += 4 {
+		program := int(section[j])<<8 | int(section[j+1])
+		if program != 0 {
+			return int(section[j+2]&0x1f)<<8 | int(section[j+3])
+		}
+	}
+	return -1
+}
+
+// parsePMT returns the PID and type of the first video stream
+func parsePMT(payload []byte) (int, *tsInfo) {
+	section := psiSection(payload)
+	if len(section) < 4 {
+		return -1, nil
+	}
+	j := 4 + (int(section[2]&0x0f)<<8 | int(section[3]))
+	for j+5 <= len(section) {
+		streamType := section[j]
+		pid := int(section[j+1]&0x1f)<<8 | int(section[j+2])
+		if _, ok := tsVideoCodecs[streamType]; ok {
+			return pid, &tsInfo{streamType: streamType}
+		}
+		j += 5 + (int(section[j+3]&0x0f)<<8 | int(section[j+4]))
+	}
+	return -1, nil
+}
+
+// parsePTS returns the presentation timestamp of a PES packet, if it has one
+func parsePTS(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 || payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	b := payload[9:14]
+	pts := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+	return pts, true
+}
@@ -0,0 +1,145 @@
+package verification
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// Params describe a transcoded rendition to be checked
+type Params struct {
+	// Local file holding the rendition
+	Fname string
+	// Local file holding the source segment
+	Source string
+	// Profile the rendition was requested in
+	Profile ffmpeg.VideoProfile
+	// Duration of the source segment, in seconds
+	Duration float64
+	// Pixels the orchestrator reported encoding
+	Pixels int64
+
+	// Cached so the checks share a single decode and probe of the rendition
+	media    *ffmpeg.MediaInfo
+	mediaErr error
+	ts       *tsInfo
+	tsErr    error
+}
+
+// Verifier checks a rendition against what was requested, returning an error
+// describing the mismatch if there is one
+type Verifier interface {
+	Verify(p *Params) error
+}
+
+// VerifierFunc adapts a function to a Verifier
+type VerifierFunc func(p *Params) error
+
+func (f VerifierFunc) Verify(p *Params) error {
+	return f(p)
+}
+
+// Builtin lists the checks that can be enabled by name
+var Builtin = map[string]Verifier{
+	"resolution": VerifierFunc(verifyResolution),
+	"frames":     VerifierFunc(verifyFrames),
+	"duration":   VerifierFunc(verifyDuration),
+	"codec":      VerifierFunc(verifyCodec),
+	"pixels":     VerifierFunc(verifyPixels),
+	"phash":      VerifierFunc(verifyPerceptualHash),
+}
+
+// DefaultVerifiers are the checks run unless others are configured. The
+// perceptual hash check re-transcodes the source, so it is left out.
+var DefaultVerifiers = []string{"resolution", "frames", "duration", "codec"}
+
+// Error reports the check a rendition failed
+type Error struct {
+	Verifier string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s verification failed: %v", e.Verifier, e.Err)
+}
+
+// Policy decides which segments are verified and runs the checks on them.
+// Checks other than the builtin ones can be added to Verifiers.
+type Policy struct {
+	// Checks to run, by name
+	Verifiers map[string]Verifier
+	// Fraction of segments to verify, between 0 and 1
+	SampleRate float64
+}
+
+// NewPolicy creates a policy running the named builtin checks on the given
+// fraction of segments
+func NewPolicy(sampleRate float64, names []string) (*Policy, error) {
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("Invalid verification sample rate %v; should be between 0 and 1", sampleRate)
+	}
+	verifiers := make(map[string]Verifier)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		v, ok := Builtin[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown verifier %s", name)
+		}
+		verifiers[name] = v
+	}
+	return &Policy{Verifiers: verifiers, SampleRate: sampleRate}, nil
+}
+
+// ShouldVerify picks whether to verify the next segment
+func (p *Policy) ShouldVerify() bool {
+	if p == nil || len(p.Verifiers) == 0 {
+		return false
+	}
+	return rand.Float64() < p.SampleRate
+}
+
+// Verify runs the checks on a rendition, in order of name, and returns an
+// *Error for the first one that fails
+func (p *Policy) Verify(params *Params) error {
+	names := make([]string, 0, len(p.Verifiers))
+	for name := range p.Verifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.Verifiers[name].Verify(params); err != nil {
+			return &Error{Verifier: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// decode returns the frame and pixel counts of the rendition
+func (p *Params) decode() (*ffmpeg.MediaInfo, error) {
+	if p.media == nil && p.mediaErr == nil {
+		res, err := ffmpeg.Transcode3(&ffmpeg.TranscodeOptionsIn{Fname: p.Fname}, nil)
+		if err != nil {
+			p.mediaErr = err
+		} else {
+			p.media = &res.Decoded
+		}
+	}
+	return p.media, p.mediaErr
+}
+
+// probe returns the stream info of the rendition
+func (p *Params) probe() (*tsInfo, error) {
+	if p.ts == nil && p.tsErr == nil {
+		data, err := ioutil.ReadFile(p.Fname)
+		if err != nil {
+			p.tsErr = err
+		} else {
+			p.ts, p.tsErr = probeTS(data)
+		}
+	}
+	return p.ts, p.tsErr
+}
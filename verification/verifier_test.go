@@ -0,0 +1,209 @@
+package verification
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewPolicy(0.5, DefaultVerifiers)
+	assert.Nil(err)
+	assert.Len(p.Verifiers, 4)
+	assert.Equal(0.5, p.SampleRate)
+
+	p, err = NewPolicy(1, []string{"pixels", " phash"})
+	assert.Nil(err)
+	assert.Contains(p.Verifiers, "phash")
+
+	_, err = NewPolicy(0.5, []string{"resolution", "foo"})
+	assert.EqualError(err, "Unknown verifier foo")
+	_, err = NewPolicy(1.5, DefaultVerifiers)
+	assert.EqualError(err, "Invalid verification sample rate 1.5; should be between 0 and 1")
+	_, err = NewPolicy(-1, DefaultVerifiers)
+	assert.NotNil(err)
+}
+
+func TestPolicy_ShouldVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	var p *Policy
+	assert.False(p.ShouldVerify())
+
+	p, _ = NewPolicy(1, DefaultVerifiers)
+	assert.True(p.ShouldVerify())
+	p.SampleRate = 0
+	assert.False(p.ShouldVerify())
+
+	// Nothing to verify with
+	p, _ = NewPolicy(1, nil)
+	assert.False(p.ShouldVerify())
+}
+
+func TestPolicy_Verify(t *testing.T) {
+	assert := assert.New(t)
+
+	var ran []string
+	check := func(name string, err error) Verifier {
+		return VerifierFunc(func(p *Params) error {
+			ran = append(ran, name)
+			return err
+		})
+	}
+	p := &Policy{Verifiers: map[string]Verifier{
+		"c": check("c", nil),
+		"a": check("a", nil),
+		"b": check("b", errors.New("bad")),
+	}}
+	err := p.Verify(&Params{})
+	assert.EqualError(err, "b verification failed: bad")
+	verr, ok := err.(*Error)
+	assert.True(ok)
+	assert.Equal("b", verr.Verifier)
+	assert.Equal([]string{"a", "b"}, ran)
+
+	delete(p.Verifiers, "b")
+	ran = nil
+	assert.Nil(p.Verify(&Params{}))
+	assert.Equal([]string{"a", "c"}, ran)
+}
+
+func TestDecodedChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	// 256x144 at 30fps for 2s
+	p := &Params{
+		Profile:  ffmpeg.P144p30fps16x9,
+		Duration: 2,
+		Pixels:   60 * 256 * 144,
+		media:    &ffmpeg.MediaInfo{Frames: 60, Pixels: 60 * 256 * 144},
+	}
+	assert.Nil(verifyResolution(p))
+	assert.Nil(verifyFrames(p))
+	assert.Nil(verifyPixels(p))
+
+	// Within the tolerance
+	p.media = &ffmpeg.MediaInfo{Frames: 55, Pixels: 55 * 256 * 144}
+	assert.Nil(verifyFrames(p))
+
+	p.media = &ffmpeg.MediaInfo{Frames: 30, Pixels: 30 * 426 * 240}
+	assert.EqualError(verifyResolution(p), "expected 256x144 or 36864 pixels per frame, got 102240")
+	assert.EqualError(verifyFrames(p), "expected 60 frames, got 30")
+	assert.EqualError(verifyPixels(p), "reported 2211840 pixels, got 3067200")
+
+	p.media = &ffmpeg.MediaInfo{}
+	assert.EqualError(verifyResolution(p), "no frames")
+
+	// Frame rate of the source is kept
+	p.Profile.Framerate = 0
+	assert.Nil(verifyFrames(p))
+
+	// Decode errors are passed on
+	p = &Params{Profile: ffmpeg.P144p30fps16x9, Duration: 2, mediaErr: errors.New("decode error")}
+	assert.EqualError(verifyResolution(p), "decode error")
+	assert.EqualError(verifyFrames(p), "decode error")
+	assert.EqualError(verifyPixels(p), "decode error")
+}
+
+func TestProbeTS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	info, err := probeTS(data)
+	require.Nil(err)
+	assert.Equal("H264", info.codec())
+	assert.Equal(217, info.frames)
+	assert.InDelta(8.68, info.duration(), 0.01)
+
+	_, err = probeTS([]byte("not a segment"))
+	assert.EqualError(err, "not an MPEG-TS segment")
+	// No PMT yet
+	_, err = probeTS(data[:188])
+	assert.Equal(errNoVideo, err)
+	corrupt := append([]byte{}, data[:188*2]...)
+	corrupt[188] = 0
+	_, err = probeTS(corrupt)
+	assert.EqualError(err, "lost sync at offset 188")
+
+	info = &tsInfo{streamType: 0x42}
+	assert.Equal("unknown (stream type 0x42)", info.codec())
+	assert.Equal(0.0, info.duration())
+}
+
+func TestProbedChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Params{Fname: "../core/test.ts", Duration: 8.7}
+	assert.Nil(verifyCodec(p))
+	assert.Nil(verifyDuration(p))
+
+	p = &Params{Fname: "../core/test.ts", Duration: 4}
+	assert.EqualError(verifyDuration(p), "expected 4.000s, got 8.682s")
+
+	p = &Params{Fname: "../core/test.ts", ts: &tsInfo{streamType: 0x24}}
+	assert.EqualError(verifyCodec(p), "expected H264 video, got HEVC")
+
+	p = &Params{Fname: "nonexistent.ts", Duration: 2}
+	assert.NotNil(verifyCodec(p))
+	assert.NotNil(verifyDuration(p))
+}
+
+func TestFrameHashes(t *testing.T) {
+	assert := assert.New(t)
+	w, h := 32, 16
+	frameSize := w * h * 3 / 2
+
+	// Left half bright in the first frame, right half in the second
+	frame := func(brightLeft bool) []byte {
+		f := make([]byte, frameSize)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if (x < w/2) == brightLeft {
+					f[y*w+x] = 200
+				}
+			}
+		}
+		return f
+	}
+	left, right := frame(true), frame(false)
+	raw := append(append([]byte{}, left...), right...)
+
+	hashes, err := frameHashes(raw, w, h, 5)
+	assert.Nil(err)
+	assert.Len(hashes, 2)
+	assert.Equal(averageHash(left[:w*h], w, h), hashes[0])
+	assert.Equal(averageHash(right[:w*h], w, h), hashes[1])
+	// Every block flips
+	assert.Equal(^hashes[0], hashes[1])
+
+	assert.Equal(0.0, hashDistance(hashes, hashes))
+	assert.Equal(64.0, hashDistance(hashes[:1], hashes[1:]))
+	assert.Equal(64.0, hashDistance(nil, hashes))
+
+	_, err = frameHashes(raw[:frameSize-1], w, h, 5)
+	assert.EqualError(err, "no frames")
+
+	// Evenly spread
+	raw = nil
+	for i := 0; i < 9; i++ {
+		raw = append(raw, frame(i%4 == 0)...)
+	}
+	hashes, err = frameHashes(raw, w, h, 3)
+	assert.Nil(err)
+	assert.Equal([]uint64{averageHash(left, w, h), averageHash(left, w, h), averageHash(left, w, h)}, hashes)
+}
+
+func TestVerifyPerceptualHash_Errors(t *testing.T) {
+	assert := assert.New(t)
+	assert.EqualError(verifyPerceptualHash(&Params{Profile: ffmpeg.P144p30fps16x9}), "no source segment")
+	p := &Params{Source: "source.ts", Profile: ffmpeg.VideoProfile{Resolution: "foo"}}
+	assert.NotNil(verifyPerceptualHash(p))
+}